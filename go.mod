@@ -13,6 +13,7 @@ require (
 	github.com/xuri/excelize/v2 v2.7.0
 	go.uber.org/zap v1.27.0
 	golang.org/x/image v0.0.0-20220902085622-e7cb96979f69
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/mysql v1.4.7
 	gorm.io/driver/postgres v1.4.8
 	gorm.io/driver/sqlite v1.4.4
@@ -44,5 +45,4 @@ require (
 	golang.org/x/sys v0.5.0 // indirect
 	golang.org/x/text v0.7.0 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
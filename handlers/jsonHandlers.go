@@ -111,17 +111,28 @@ type FilePatch struct {
 }
 
 type FileEntry struct {
-	Path   string     `json:"path"`
-	Type   string     `json:"type"`
-	Status string     `json:"status"`
-	Size   int        `json:"size,omitempty"`
-	Hash   string     `json:"hash,omitempty"`
-	Patch  *FilePatch `json:"patch,omitempty"`
+	Path     string     `json:"path"`
+	Type     string     `json:"type"`
+	Status   string     `json:"status"`
+	Size     int        `json:"size,omitempty"`
+	Hash     string     `json:"hash,omitempty"`
+	BaseHash string     `json:"base_hash,omitempty"` // 升级前（基准版本）文件的哈希，用于检测本地修改
+	Merge    string     `json:"merge,omitempty"`     // 合并策略，three-way 表示与本地修改按键三方合并
+	Patch    *FilePatch `json:"patch,omitempty"`
+	Base     *FilePatch `json:"base,omitempty"` // 基准版本文件的完整副本，三方合并时使用
+}
+
+// ConflictPolicy 按路径通配符指定本地修改冲突的处理策略
+type ConflictPolicy struct {
+	Pattern string `json:"pattern"`
+	Policy  string `json:"policy"`
 }
 
 type UpdatePackage struct {
-	Version     string      `json:"version"`
-	Description string      `json:"description"`
-	Timestamp   string      `json:"timestamp"`
-	Files       []FileEntry `json:"files"`
+	Version          string           `json:"version"`
+	BaseVersion      string           `json:"base_version,omitempty"` // 升级包适用的已安装版本
+	Description      string           `json:"description"`
+	Timestamp        string           `json:"timestamp"`
+	ConflictPolicies []ConflictPolicy `json:"conflict_policies,omitempty"`
+	Files            []FileEntry      `json:"files"`
 }
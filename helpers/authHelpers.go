@@ -0,0 +1,360 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 认证方式
+const (
+	AuthNone  = ""
+	AuthToken = "token" // Authorization: Bearer <token>
+	AuthBasic = "basic" // HTTP 基本认证
+	AuthNetrc = "netrc" // 按主机名从 .netrc 查找用户名与密码
+	AuthHMAC  = "hmac"  // 对 method+path+时间戳+请求体摘要签名
+)
+
+// HMAC 签名使用的请求头
+const (
+	HMACTimestampHeader = "X-ReWi-Timestamp"
+	HMACContentHeader   = "X-ReWi-Content-SHA256"
+)
+
+// AuthProvider 为发出的每个请求添加认证信息
+//
+// 实现的 String 方法不能包含密钥，日志与 --verbose 输出只会显示 String 的结果。
+type AuthProvider interface {
+	Authenticate(req *http.Request) error
+	String() string
+}
+
+// AuthConfig 认证配置，可以从 YAML/JSON 文件读取，命令行参数覆盖文件中的值
+type AuthConfig struct {
+	Type       string `yaml:"type" json:"type"`                                 // token、basic、netrc、hmac，为空时不认证
+	TokenEnv   string `yaml:"token_env,omitempty" json:"token_env,omitempty"`   // 读取令牌的环境变量
+	TokenFile  string `yaml:"token_file,omitempty" json:"token_file,omitempty"` // 读取令牌的文件
+	Username   string `yaml:"username,omitempty" json:"username,omitempty"`
+	PassEnv    string `yaml:"password_env,omitempty" json:"password_env,omitempty"` // 读取密码的环境变量
+	Netrc      string `yaml:"netrc,omitempty" json:"netrc,omitempty"`               // .netrc 路径，默认 $NETRC 或 ~/.netrc
+	KeyID      string `yaml:"key_id,omitempty" json:"key_id,omitempty"`             // HMAC 密钥标识
+	SecretEnv  string `yaml:"secret_env,omitempty" json:"secret_env,omitempty"`     // 读取 HMAC 密钥的环境变量
+	SecretFile string `yaml:"secret_file,omitempty" json:"secret_file,omitempty"`   // 读取 HMAC 密钥的文件
+}
+
+// LoadAuthConfig 读取认证配置文件（YAML 或 JSON）
+func LoadAuthConfig(path string) (*AuthConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg AuthConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// NewAuthProvider 按配置创建认证方式，Type 为空时返回 nil
+func NewAuthProvider(cfg AuthConfig) (AuthProvider, error) {
+	switch strings.ToLower(cfg.Type) {
+	case AuthNone, "none":
+		return nil, nil
+	case AuthToken:
+		token, err := readSecret("token", cfg.TokenEnv, cfg.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return &TokenAuth{Token: token}, nil
+	case AuthBasic:
+		if cfg.Username == "" {
+			return nil, fmt.Errorf("basic auth requires a username")
+		}
+		password, err := readSecret("password", cfg.PassEnv, "")
+		if err != nil {
+			return nil, err
+		}
+		return &BasicAuth{Username: cfg.Username, Password: password}, nil
+	case AuthNetrc:
+		netrc, err := LoadNetrc(cfg.Netrc)
+		if err != nil {
+			return nil, err
+		}
+		return netrc, nil
+	case AuthHMAC:
+		if cfg.KeyID == "" {
+			return nil, fmt.Errorf("hmac auth requires a key id")
+		}
+		secret, err := readSecret("hmac secret", cfg.SecretEnv, cfg.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		return &HMACAuth{KeyID: cfg.KeyID, Secret: []byte(secret)}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth type %q (token, basic, netrc, hmac)", cfg.Type)
+	}
+}
+
+// readSecret 优先从文件读取，其次从环境变量读取，去掉首尾空白
+func readSecret(what, env, file string) (string, error) {
+	var value string
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("read %s file: %w", what, err)
+		}
+		value = string(data)
+	case env != "":
+		value = os.Getenv(env)
+		if value == "" {
+			return "", fmt.Errorf("%s environment variable %s is not set", what, env)
+		}
+	default:
+		return "", fmt.Errorf("no %s source configured (file or environment variable)", what)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("empty %s", what)
+	}
+	return value, nil
+}
+
+// TokenAuth 发送 Authorization: Bearer <token>
+type TokenAuth struct {
+	Token string
+}
+
+func (a *TokenAuth) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+func (a *TokenAuth) String() string {
+	return "bearer token"
+}
+
+// BasicAuth HTTP 基本认证
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a *BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+func (a *BasicAuth) String() string {
+	return "basic auth as " + a.Username
+}
+
+// netrcEntry .netrc 中的一台主机，machine 为空表示 default
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// NetrcAuth 按请求的主机名从 .netrc 查找用户名与密码，找不到时不认证
+type NetrcAuth struct {
+	Path    string
+	entries []netrcEntry
+}
+
+// LoadNetrc 读取 .netrc；path 为空时使用 $NETRC 或 ~/.netrc
+func LoadNetrc(path string) (*NetrcAuth, error) {
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("locate .netrc: %w", err)
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read netrc: %w", err)
+	}
+	return &NetrcAuth{Path: path, entries: parseNetrc(data)}, nil
+}
+
+// parseNetrc 解析 machine/default/login/password，忽略 account 与 macdef
+func parseNetrc(data []byte) []netrcEntry {
+	var (
+		entries []netrcEntry
+		current *netrcEntry
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		// macdef 定义到空行为止
+		if strings.HasPrefix(line, "macdef") {
+			for scanner.Scan() && strings.TrimSpace(scanner.Text()) != "" {
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			next := func() string {
+				if i+1 < len(fields) {
+					i++
+					return fields[i]
+				}
+				return ""
+			}
+			switch fields[i] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: next()})
+				current = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, netrcEntry{})
+				current = &entries[len(entries)-1]
+			case "login":
+				if value := next(); current != nil {
+					current.login = value
+				}
+			case "password":
+				if value := next(); current != nil {
+					current.password = value
+				}
+			case "account":
+				next()
+			}
+		}
+	}
+	return entries
+}
+
+// lookup 返回主机对应的条目，没有时使用 default
+func (a *NetrcAuth) lookup(host string) *netrcEntry {
+	var fallback *netrcEntry
+	for i := range a.entries {
+		e := &a.entries[i]
+		if e.machine == host {
+			return e
+		}
+		if e.machine == "" && fallback == nil {
+			fallback = e
+		}
+	}
+	return fallback
+}
+
+func (a *NetrcAuth) Authenticate(req *http.Request) error {
+	if e := a.lookup(req.URL.Hostname()); e != nil && e.login != "" {
+		req.SetBasicAuth(e.login, e.password)
+	}
+	return nil
+}
+
+func (a *NetrcAuth) String() string {
+	return "netrc " + a.Path
+}
+
+// HMACAuth 用共享密钥对请求签名
+//
+// 签名内容为 method、path（含查询参数）、Unix 时间戳与请求体 SHA-256 摘要，以换行分隔：
+//
+//	Authorization: HMAC-SHA256 KeyId=<id>, Signature=<hex(hmac-sha256(secret, content))>
+//
+// 时间戳与请求体摘要分别放在 X-ReWi-Timestamp 与 X-ReWi-Content-SHA256 中，服务器据此验证并拒绝过期请求。
+type HMACAuth struct {
+	KeyID  string
+	Secret []byte
+	now    func() time.Time
+}
+
+func (a *HMACAuth) Authenticate(req *http.Request) error {
+	bodyHash := sha256.New()
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return fmt.Errorf("hmac auth: request body cannot be re-read for signing")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(bodyHash, body)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("hmac auth: hash body: %w", err)
+		}
+	}
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	timestamp := strconv.FormatInt(now().Unix(), 10)
+	contentHash := hex.EncodeToString(bodyHash.Sum(nil))
+
+	req.Header.Set(HMACTimestampHeader, timestamp)
+	req.Header.Set(HMACContentHeader, contentHash)
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 KeyId=%s, Signature=%s",
+		a.KeyID, SignHMAC(a.Secret, req.Method, req.URL.RequestURI(), timestamp, contentHash)))
+	return nil
+}
+
+func (a *HMACAuth) String() string {
+	return "hmac key " + a.KeyID
+}
+
+// SignHMAC 计算 HMACAuth 的签名，服务器验证时使用同样的算法
+func SignHMAC(secret []byte, method, path, timestamp, contentHash string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{strings.ToUpper(method), path, timestamp, contentHash}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RedactURL 隐藏 URL 中的密码，用于日志与命令行输出
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// authTransport 在每次尝试发出前添加认证信息，镜像改写后的地址与重试都会重新签名
+type authTransport struct {
+	auth AuthProvider
+	next http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// 重定向到其他主机时不发送凭据
+	if req.Response != nil && req.Response.Request != nil && req.Response.Request.URL.Host != req.URL.Host {
+		return t.next.RoundTrip(req)
+	}
+	authed := req.Clone(req.Context())
+	if err := t.auth.Authenticate(authed); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(authed)
+}
+
+// withAuth 配置了 Auth 时在 next 外包装一层认证
+func (nm *NetManager) withAuth(next http.RoundTripper) http.RoundTripper {
+	if nm.Auth == nil {
+		return next
+	}
+	return &authTransport{auth: nm.Auth, next: next}
+}
@@ -0,0 +1,118 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetrc(t *testing.T) {
+	data := []byte(`# comment
+machine updates.example.com login alice password s3cret
+macdef init
+cd /pub
+
+machine other.example.com
+  login bob
+  password hunter2
+  account ignored
+default login anonymous password guest
+`)
+	netrc := &NetrcAuth{entries: parseNetrc(data)}
+
+	e := netrc.lookup("updates.example.com")
+	require.NotNil(t, e)
+	assert.Equal(t, "alice", e.login)
+	assert.Equal(t, "s3cret", e.password)
+
+	e = netrc.lookup("other.example.com")
+	require.NotNil(t, e)
+	assert.Equal(t, "bob", e.login)
+	assert.Equal(t, "hunter2", e.password)
+
+	e = netrc.lookup("unknown.example.com")
+	require.NotNil(t, e)
+	assert.Equal(t, "anonymous", e.login)
+}
+
+func TestNewAuthProvider(t *testing.T) {
+	t.Setenv("TEST_REWI_TOKEN", "  abc123\n")
+	auth, err := NewAuthProvider(AuthConfig{Type: AuthToken, TokenEnv: "TEST_REWI_TOKEN"})
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", auth.(*TokenAuth).Token)
+	assert.NotContains(t, auth.String(), "abc123")
+
+	file := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(file, []byte("from-file\n"), 0600))
+	auth, err = NewAuthProvider(AuthConfig{Type: AuthHMAC, KeyID: "k1", SecretFile: file, SecretEnv: "TEST_REWI_TOKEN"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("from-file"), auth.(*HMACAuth).Secret)
+
+	auth, err = NewAuthProvider(AuthConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+
+	_, err = NewAuthProvider(AuthConfig{Type: AuthToken, TokenEnv: "TEST_REWI_UNSET"})
+	assert.Error(t, err)
+	_, err = NewAuthProvider(AuthConfig{Type: "kerberos"})
+	assert.Error(t, err)
+}
+
+func TestHMACAuth(t *testing.T) {
+	secret := []byte("shared")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timestamp := r.Header.Get(HMACTimestampHeader)
+		content := r.Header.Get(HMACContentHeader)
+		want := "HMAC-SHA256 KeyId=k1, Signature=" + SignHMAC(secret, r.Method, r.URL.RequestURI(), timestamp, content)
+		if r.Header.Get("Authorization") != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	nm := newTestNetManager(srv.URL + "/p/d/j/version.txt?channel=stable")
+	nm.Auth = &HMACAuth{KeyID: "k1", Secret: secret, now: func() time.Time { return time.Unix(1700000000, 0) }}
+	got, err := nm.GetRemoteVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ok", got)
+
+	nm.Auth = &HMACAuth{KeyID: "k1", Secret: []byte("wrong")}
+	_, err = nm.GetRemoteVersion(context.Background())
+	assert.Error(t, err)
+}
+
+func TestAuthTransportRedirect(t *testing.T) {
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization")
+		w.Write([]byte("v2"))
+	}))
+	defer other.Close()
+
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("Authorization")
+		// 127.0.0.1 与 localhost 视为不同的主机
+		http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1)+"/version.txt", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	nm := newTestNetManager(srv.URL + "/version.txt")
+	nm.FollowRedirects = true
+	nm.Auth = &TokenAuth{Token: "abc123"}
+	got, err := nm.GetRemoteVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "v2", got)
+	assert.Equal(t, "Bearer abc123", received)
+	assert.Empty(t, leaked)
+}
@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// errChecksumMismatch 下载内容与期望摘要不一致，文件已删除，可以重新下载
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// hashAlgorithms 支持的摘要算法
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// sidecarAlgorithms 自动获取摘要文件时依次尝试的扩展名
+var sidecarAlgorithms = []string{"sha256", "md5"}
+
+// checksum 期望的文件摘要
+type checksum struct {
+	algorithm string
+	newHash   func() hash.Hash
+	hex       string
+}
+
+func (c *checksum) String() string {
+	return c.algorithm + ":" + c.hex
+}
+
+// parseChecksum 解析 "algorithm:hex"；省略算法时按摘要长度推断
+func parseChecksum(value string) (*checksum, error) {
+	algorithm, digest, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok {
+		digest = algorithm
+		switch len(digest) {
+		case 32:
+			algorithm = "md5"
+		case 40:
+			algorithm = "sha1"
+		case 64:
+			algorithm = "sha256"
+		case 128:
+			algorithm = "sha512"
+		default:
+			return nil, fmt.Errorf("invalid checksum %q, expected algorithm:hex", value)
+		}
+	}
+	algorithm = strings.ToLower(algorithm)
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q (md5, sha1, sha256, sha512)", algorithm)
+	}
+	digest = strings.ToLower(digest)
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != newHash().Size()*2 {
+		return nil, fmt.Errorf("invalid %s digest %q", algorithm, digest)
+	}
+	return &checksum{algorithm: algorithm, newHash: newHash, hex: digest}, nil
+}
+
+// resolveChecksum 返回本次下载的期望摘要：优先使用 Checksum，其次按需获取 <url>.sha256 / <url>.md5
+func (nm *NetManager) resolveChecksum(ctx context.Context, client *http.Client) (*checksum, error) {
+	if nm.Checksum != "" {
+		return parseChecksum(nm.Checksum)
+	}
+	if !nm.ChecksumSidecar {
+		return nil, nil
+	}
+
+	for _, algorithm := range sidecarAlgorithms {
+		sidecarURL := nm.ReqURL + "." + algorithm
+		req, err := nm.createRequest(ctx, sidecarURL)
+		if err != nil {
+			return nil, err
+		}
+		req.Method = http.MethodGet
+		req.Body = nil
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("fetch %s: %w", sidecarURL, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", sidecarURL, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch %s: unexpected status code: %d", sidecarURL, resp.StatusCode)
+		}
+
+		// 摘要文件内容为 "<hex>" 或 "<hex>  <filename>"
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty checksum file %s", sidecarURL)
+		}
+		return parseChecksum(algorithm + ":" + fields[0])
+	}
+	return nil, fmt.Errorf("no checksum file found for %s (tried %s)", nm.ReqURL, strings.Join(sidecarAlgorithms, ", "))
+}
+
+// streamDigest 边下载边计算的摘要，n 为已计入的字节数
+type streamDigest struct {
+	h hash.Hash
+	n int64
+}
+
+func (d *streamDigest) Write(p []byte) (int, error) {
+	n, err := d.h.Write(p)
+	d.n += int64(n)
+	return n, err
+}
+
+// syncTo 使摘要恰好覆盖文件的前 offset 字节，续传时已有的数据需要重新计入
+func (d *streamDigest) syncTo(path string, offset int64) error {
+	if d.n == offset {
+		return nil
+	}
+	d.h.Reset()
+	d.n = 0
+	if offset == 0 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(d, f, offset)
+	return err
+}
+
+// verify 校验文件摘要；边下载边计算的摘要覆盖了整个文件时不再重新读取文件
+func (c *checksum) verify(path string, size int64, digest *streamDigest) error {
+	var actual string
+	if digest != nil && digest.n == size {
+		actual = hex.EncodeToString(digest.h.Sum(nil))
+	} else {
+		var err error
+		if actual, err = CalculateFileHash(path, c.newHash); err != nil {
+			return err
+		}
+	}
+	if actual != c.hex {
+		return fmt.Errorf("%w: expected %s, got %s:%s", errChecksumMismatch, c, c.algorithm, actual)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChecksum(t *testing.T) {
+	md5Hex := fmt.Sprintf("%x", md5.Sum([]byte("x")))
+	sha256Hex := fmt.Sprintf("%x", sha256.Sum256([]byte("x")))
+
+	sum, err := parseChecksum("SHA256:" + strings.ToUpper(sha256Hex))
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:"+sha256Hex, sum.String())
+
+	// 省略算法时按长度推断
+	sum, err = parseChecksum(md5Hex)
+	require.NoError(t, err)
+	assert.Equal(t, "md5", sum.algorithm)
+
+	for _, bad := range []string{"crc32:00000000", "md5:" + sha256Hex, "sha256:zz", "abc"} {
+		_, err := parseChecksum(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	content := bytes.Repeat([]byte("payload "), 4096)
+	sha256Hex := fmt.Sprintf("%x", sha256.Sum256(content))
+	md5Hex := fmt.Sprintf("%x", md5.Sum(content))
+
+	t.Run("自动获取 sha256 摘要文件", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/pkg.tar.gz":
+				w.Write(content)
+			case "/pkg.tar.gz.sha256":
+				fmt.Fprintf(w, "%s  pkg.tar.gz\n", sha256Hex)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer srv.Close()
+
+		nm := newTestNetManager(srv.URL + "/pkg.tar.gz")
+		nm.ChecksumSidecar = true
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.NoError(t, nm.DownloadFile(dest))
+		assert.FileExists(t, dest)
+	})
+
+	t.Run("没有 sha256 时使用 md5", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/pkg.tar.gz":
+				w.Write(content)
+			case "/pkg.tar.gz.md5":
+				fmt.Fprint(w, strings.Repeat("0", 32))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer srv.Close()
+
+		nm := newTestNetManager(srv.URL + "/pkg.tar.gz")
+		nm.ChecksumSidecar = true
+		nm.Retries = 0
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		err := nm.DownloadFile(dest)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "md5:")
+		assert.NoFileExists(t, dest)
+	})
+
+	t.Run("摘要不一致时删除并重新下载", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				corrupted := append([]byte(nil), content...)
+				corrupted[0] ^= 0xff
+				w.Write(corrupted)
+				return
+			}
+			w.Write(content)
+		}))
+		defer srv.Close()
+
+		nm := newTestNetManager(srv.URL)
+		nm.Checksum = "md5:" + md5Hex
+		nm.Retries = 1
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.NoError(t, nm.DownloadFile(dest))
+
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("续传时摘要覆盖已有数据", func(t *testing.T) {
+		srv, _ := flakyServer(t, content)
+		nm := newTestNetManager(srv.URL)
+		nm.Checksum = "sha256:" + sha256Hex
+		nm.Retries = 1
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.NoError(t, nm.DownloadFile(dest))
+	})
+}
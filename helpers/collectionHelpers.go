@@ -0,0 +1,549 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Collection 按顺序执行的一组请求，用于部署后的接口冒烟测试
+//
+//	name: smoke
+//	variables:
+//	  base: https://api.example.com
+//	requests:
+//	  - name: login
+//	    method: POST
+//	    url: "{{base}}/login"
+//	    headers: {Content-Type: application/json}
+//	    body: '{"user": "{{env.API_USER}}"}'
+//	    extract: {token: $.data.token}
+//	    assert: {status: 200, json: {$.data.role: admin}}
+//	  - name: list
+//	    url: "{{base}}/items"
+//	    headers: {Authorization: "Bearer {{token}}"}
+//	    assert: {status: [200, 204], body_contains: [items]}
+type Collection struct {
+	Name      string              `yaml:"name"`
+	Variables map[string]string   `yaml:"variables"`
+	Headers   map[string]string   `yaml:"headers"` // 所有请求共用的请求头
+	Requests  []CollectionRequest `yaml:"requests"`
+
+	dir string // 集合文件所在目录，@file 相对于该目录
+}
+
+// CollectionRequest 集合中的一个请求，字符串中的 {{name}} 替换为变量，{{env.NAME}} 替换为环境变量
+type CollectionRequest struct {
+	Name    string            `yaml:"name"`
+	Method  string            `yaml:"method"` // 默认 GET，有请求体时默认 POST
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"` // @file 从文件读取
+	Form    []string          `yaml:"form"` // name=value 或 name=@file[;type=mime]
+	Extract map[string]string `yaml:"extract"`
+	Assert  RequestAssert     `yaml:"assert"`
+}
+
+// RequestAssert 对响应的断言
+type RequestAssert struct {
+	Status       StatusList             `yaml:"status"`        // 允许的状态码，为空时要求 2xx
+	Headers      map[string]string      `yaml:"headers"`       // 响应头包含该值，值为空时只要求存在
+	BodyContains []string               `yaml:"body_contains"` // 响应体包含的文本
+	JSON         map[string]interface{} `yaml:"json"`          // JSON 路径 -> 期望值
+	MaxTime      time.Duration          `yaml:"max_time"`      // 最长响应时间，如 500ms
+}
+
+// StatusList 状态码列表，YAML 中可以写单个状态码或列表
+type StatusList []int
+
+func (s *StatusList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var code int
+		if err := node.Decode(&code); err != nil {
+			return err
+		}
+		*s = StatusList{code}
+		return nil
+	}
+	var codes []int
+	if err := node.Decode(&codes); err != nil {
+		return err
+	}
+	*s = codes
+	return nil
+}
+
+// LoadCollection 读取 YAML 集合文件
+func LoadCollection(path string) (*Collection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Collection
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(c.Requests) == 0 {
+		return nil, fmt.Errorf("%s has no requests", path)
+	}
+	for i, r := range c.Requests {
+		if r.URL == "" {
+			return nil, fmt.Errorf("request %d (%s) has no url", i+1, r.Name)
+		}
+		if r.Name == "" {
+			c.Requests[i].Name = fmt.Sprintf("request %d", i+1)
+		}
+	}
+	if c.Name == "" {
+		c.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	c.dir = filepath.Dir(path)
+	return &c, nil
+}
+
+// RequestResult 一个请求的执行结果
+type RequestResult struct {
+	Name     string
+	Method   string
+	URL      string // 已隐藏凭据
+	Status   int
+	Duration time.Duration
+	Failures []string // 未通过的断言
+	Err      error    // 请求未能发出或未收到响应
+}
+
+// Passed 请求是否成功且断言全部通过
+func (r *RequestResult) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// CollectionReport 集合的执行结果
+type CollectionReport struct {
+	Name     string
+	Results  []RequestResult
+	Duration time.Duration
+}
+
+// Failed 未通过的请求数
+func (r *CollectionReport) Failed() int {
+	failed := 0
+	for i := range r.Results {
+		if !r.Results[i].Passed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// CollectionOptions 执行集合的参数
+type CollectionOptions struct {
+	Variables map[string]string // 覆盖集合中的变量
+	FailFast  bool              // 第一个失败的请求后停止
+}
+
+// RunCollection 使用 nm 的超时、重试、认证与 TLS 配置按顺序执行集合中的请求
+func (nm *NetManager) RunCollection(ctx context.Context, c *Collection, opts CollectionOptions) (*CollectionReport, error) {
+	client, err := nm.prepareHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string)
+	for k, v := range c.Variables {
+		vars[k] = v
+	}
+	for k, v := range opts.Variables {
+		vars[k] = v
+	}
+
+	report := &CollectionReport{Name: c.Name}
+	start := time.Now()
+	for _, spec := range c.Requests {
+		result := nm.runCollectionRequest(ctx, client, c, spec, vars)
+		report.Results = append(report.Results, result)
+		if ctx.Err() != nil {
+			break
+		}
+		if opts.FailFast && !result.Passed() {
+			break
+		}
+	}
+	report.Duration = time.Since(start)
+	return report, ctx.Err()
+}
+
+// runCollectionRequest 执行一个请求并检查断言，提取的变量写入 vars
+func (nm *NetManager) runCollectionRequest(ctx context.Context, client *http.Client, c *Collection, spec CollectionRequest, vars map[string]string) RequestResult {
+	result := RequestResult{Name: spec.Name, Method: strings.ToUpper(spec.Method)}
+	if result.Method == "" {
+		result.Method = http.MethodGet
+		if spec.Body != "" || len(spec.Form) > 0 {
+			result.Method = http.MethodPost
+		}
+	}
+
+	// 复制 NetManager，只替换本次请求的内容
+	req := *nm
+	req.ReqMethod = result.Method
+	req.ReqHeaders = nil
+	req.ReqForm = nil
+	var err error
+	if req.ReqURL, err = expandVars(spec.URL, vars); err != nil {
+		result.URL, result.Err = spec.URL, err
+		return result
+	}
+	result.URL = RedactURL(req.ReqURL)
+	if req.ReqBody, err = expandVars(spec.Body, vars); err != nil {
+		result.Err = err
+		return result
+	}
+	if strings.HasPrefix(req.ReqBody, "@") {
+		req.ReqBody = "@" + c.resolvePath(req.ReqBody[1:])
+	}
+	for _, field := range spec.Form {
+		if field, err = expandVars(field, vars); err != nil {
+			result.Err = err
+			return result
+		}
+		if name, value, ok := strings.Cut(field, "="); ok && strings.HasPrefix(value, "@") {
+			field = name + "=@" + c.resolvePath(value[1:])
+		}
+		req.ReqForm = append(req.ReqForm, field)
+	}
+	for _, headers := range []map[string]string{c.Headers, spec.Headers} {
+		for _, k := range sortedKeys(headers) {
+			value, err := expandVars(headers[k], vars)
+			if err != nil {
+				result.Err = err
+				return result
+			}
+			req.ReqHeaders = append(req.ReqHeaders, k+":"+value)
+		}
+	}
+
+	httpReq, err := req.NewRequest(ctx)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	start := time.Now()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Err = err
+		return result
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, nm.MaxBodySize))
+	resp.Body.Close()
+	result.Duration = time.Since(start)
+	result.Status = resp.StatusCode
+	if err != nil {
+		result.Err = fmt.Errorf("read body: %w", err)
+		return result
+	}
+
+	// 响应体不是 JSON 时只有用到 JSON 路径的断言与提取会失败
+	var doc interface{}
+	jsonErr := json.Unmarshal(body, &doc)
+
+	result.Failures = checkAssertions(spec.Assert, resp, body, doc, jsonErr, result.Duration, vars)
+	for _, name := range sortedKeys(spec.Extract) {
+		value, err := extractValue(spec.Extract[name], resp, doc, jsonErr)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("extract %s: %v", name, err))
+			continue
+		}
+		vars[name] = value
+	}
+	return result
+}
+
+// checkAssertions 返回未通过的断言
+func checkAssertions(a RequestAssert, resp *http.Response, body []byte, doc interface{}, jsonErr error, elapsed time.Duration, vars map[string]string) []string {
+	var failures []string
+	if len(a.Status) == 0 {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			failures = append(failures, fmt.Sprintf("status %d, expected 2xx", resp.StatusCode))
+		}
+	} else if !containsInt(a.Status, resp.StatusCode) {
+		failures = append(failures, fmt.Sprintf("status %d, expected %v", resp.StatusCode, []int(a.Status)))
+	}
+
+	for _, name := range sortedKeys(a.Headers) {
+		expected, err := expandVars(a.Headers[name], vars)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		values := resp.Header.Values(name)
+		switch {
+		case len(values) == 0:
+			failures = append(failures, fmt.Sprintf("header %s missing", name))
+		case expected != "" && !strings.Contains(strings.Join(values, ", "), expected):
+			failures = append(failures, fmt.Sprintf("header %s is %q, expected to contain %q", name, strings.Join(values, ", "), expected))
+		}
+	}
+
+	for _, text := range a.BodyContains {
+		expected, err := expandVars(text, vars)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		if !strings.Contains(string(body), expected) {
+			failures = append(failures, fmt.Sprintf("body does not contain %q", expected))
+		}
+	}
+
+	paths := make([]string, 0, len(a.JSON))
+	for path := range a.JSON {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if jsonErr != nil {
+			failures = append(failures, fmt.Sprintf("%s: body is not JSON: %v", path, jsonErr))
+			continue
+		}
+		actual, err := JSONPath(doc, path)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		expected := a.JSON[path]
+		if s, ok := expected.(string); ok {
+			if expected, err = expandVars(s, vars); err != nil {
+				failures = append(failures, err.Error())
+				continue
+			}
+		}
+		if !jsonEqual(actual, expected) {
+			got, _ := json.Marshal(actual)
+			want, _ := json.Marshal(expected)
+			failures = append(failures, fmt.Sprintf("%s is %s, expected %s", path, got, want))
+		}
+	}
+
+	if a.MaxTime > 0 && elapsed > a.MaxTime {
+		failures = append(failures, fmt.Sprintf("took %v, expected at most %v", elapsed.Round(time.Millisecond), a.MaxTime))
+	}
+	return failures
+}
+
+// extractValue 按 $.path、header:Name 或 status 提取变量
+func extractValue(source string, resp *http.Response, doc interface{}, jsonErr error) (string, error) {
+	switch {
+	case source == "status":
+		return strconv.Itoa(resp.StatusCode), nil
+	case strings.HasPrefix(source, "header:"):
+		name := strings.TrimSpace(strings.TrimPrefix(source, "header:"))
+		value := resp.Header.Get(name)
+		if value == "" {
+			return "", fmt.Errorf("header %s missing", name)
+		}
+		return value, nil
+	}
+	if jsonErr != nil {
+		return "", fmt.Errorf("body is not JSON: %v", jsonErr)
+	}
+	value, err := JSONPath(doc, source)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// jsonPathToken 匹配 .name、["name"] 与 [index]
+var jsonPathToken = regexp.MustCompile(`^(?:\.([^.\[]+)|\["([^"]*)"\]|\[(\d+)\])`)
+
+// JSONPath 按 $.a.b[0]["c d"] 形式的路径取值，路径只支持字段与数组下标
+func JSONPath(doc interface{}, path string) (interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid JSON path %q, expected $.field", path)
+	}
+	current, rest := doc, path[1:]
+	for rest != "" {
+		m := jsonPathToken.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("invalid JSON path %q at %q", path, rest)
+		}
+		rest = rest[len(m[0]):]
+		if m[3] != "" {
+			index, _ := strconv.Atoi(m[3])
+			list, ok := current.([]interface{})
+			if !ok || index >= len(list) {
+				return nil, fmt.Errorf("%s: index %d not found", path, index)
+			}
+			current = list[index]
+			continue
+		}
+		key := m[1] + m[2]
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is not an object", path, key)
+		}
+		if current, ok = object[key]; !ok {
+			return nil, fmt.Errorf("%s: field %s not found", path, key)
+		}
+	}
+	return current, nil
+}
+
+// jsonEqual 以 JSON 编码比较，YAML 的 int 与 JSON 的 float64 视为相同
+func jsonEqual(a, b interface{}) bool {
+	da, errA := json.Marshal(a)
+	db, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(da) == string(db)
+}
+
+// collectionVar 匹配 {{name}} 与 {{env.NAME}}
+var collectionVar = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// expandVars 替换变量，未定义的变量返回错误
+func expandVars(s string, vars map[string]string) (string, error) {
+	var missing []string
+	out := collectionVar.ReplaceAllStringFunc(s, func(match string) string {
+		name := collectionVar.FindStringSubmatch(match)[1]
+		if strings.HasPrefix(name, "env.") {
+			if value, ok := os.LookupEnv(strings.TrimPrefix(name, "env.")); ok {
+				return value
+			}
+		} else if value, ok := vars[name]; ok {
+			return value
+		}
+		missing = append(missing, name)
+		return match
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+func (c *Collection) resolvePath(path string) string {
+	if path == "-" || filepath.IsAbs(path) || c.dir == "" {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTable 以表格输出结果，未通过的请求在表格后列出错误与断言
+func (r *CollectionReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tNAME\tMETHOD\tURL\tSTATUS\tTIME")
+	for _, res := range r.Results {
+		mark, status := "PASS", strconv.Itoa(res.Status)
+		if !res.Passed() {
+			mark = "FAIL"
+		}
+		if res.Status == 0 {
+			status = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%v\n", mark, res.Name, res.Method, res.URL, status, res.Duration.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, res := range r.Results {
+		if res.Passed() {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", res.Name)
+		if res.Err != nil {
+			fmt.Fprintf(w, "  error: %v\n", res.Err)
+		}
+		for _, failure := range res.Failures {
+			fmt.Fprintf(w, "  %s\n", failure)
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d passed, %d failed in %v\n", len(r.Results)-r.Failed(), r.Failed(), r.Duration.Round(time.Millisecond))
+	return err
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit 以 JUnit XML 输出结果，请求失败记为 error，断言未通过记为 failure
+func (r *CollectionReport) WriteJUnit(w io.Writer) error {
+	suite := junitSuite{Name: r.Name, Tests: len(r.Results), Time: seconds(r.Duration)}
+	for _, res := range r.Results {
+		tc := junitCase{Name: res.Name, ClassName: r.Name, Time: seconds(res.Duration)}
+		switch {
+		case res.Err != nil:
+			suite.Errors++
+			tc.Error = &junitMessage{Message: res.Err.Error(), Text: res.Method + " " + res.URL}
+		case len(res.Failures) > 0:
+			suite.Failures++
+			tc.Failure = &junitMessage{Message: res.Failures[0], Text: res.Method + " " + res.URL + "\n" + strings.Join(res.Failures, "\n")}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
@@ -0,0 +1,140 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCollection = `name: smoke
+variables:
+  user: alice
+headers:
+  X-Client: smoke
+requests:
+  - name: login
+    url: "{{base}}/login"
+    body: '{"user": "{{user}}"}'
+    extract:
+      token: $.data.token
+      request_id: header:X-Request-Id
+    assert:
+      status: 200
+      json:
+        $.data.roles[0]: admin
+        $.data.count: 2
+  - name: upload
+    url: "{{base}}/upload"
+    headers:
+      Authorization: "Bearer {{token}}"
+    form: ["file=@data.txt"]
+    assert:
+      status: [200, 201]
+      headers: {Content-Type: text/plain}
+      body_contains: ["data.txt {{request_id}}"]
+  - name: missing
+    url: "{{base}}/missing"
+    assert:
+      body_contains: [items]
+`
+
+func TestRunCollection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			if r.Method != http.MethodPost || r.Header.Get("X-Client") != "smoke" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("X-Request-Id", "req-1")
+			w.Write([]byte(`{"data": {"token": "t0k", "roles": ["admin"], "count": 2}}`))
+		case "/upload":
+			if r.Header.Get("Authorization") != "Bearer t0k" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, header, err := r.FormFile("file")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(header.Filename + " req-1"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "smoke.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testCollection), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.txt"), []byte("data"), 0644))
+	c, err := LoadCollection(path)
+	require.NoError(t, err)
+
+	nm := NewNetManager()
+	nm.Retries = 0
+	report, err := nm.RunCollection(context.Background(), c, CollectionOptions{Variables: map[string]string{"base": srv.URL}})
+	require.NoError(t, err)
+	require.Len(t, report.Results, 3)
+	assert.True(t, report.Results[0].Passed(), report.Results[0].Failures)
+	assert.True(t, report.Results[1].Passed(), "%v %v", report.Results[1].Err, report.Results[1].Failures)
+	assert.Equal(t, http.StatusCreated, report.Results[1].Status)
+	missing := report.Results[2]
+	assert.Equal(t, http.StatusNotFound, missing.Status)
+	assert.Equal(t, []string{"status 404, expected 2xx", `body does not contain "items"`}, missing.Failures)
+	assert.Equal(t, 1, report.Failed())
+
+	var table bytes.Buffer
+	require.NoError(t, report.WriteTable(&table))
+	assert.Contains(t, table.String(), "2 passed, 1 failed")
+
+	var junit bytes.Buffer
+	require.NoError(t, report.WriteJUnit(&junit))
+	var suite junitSuite
+	require.NoError(t, xml.Unmarshal(junit.Bytes(), &suite))
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	require.NotNil(t, suite.Cases[2].Failure)
+	assert.Equal(t, "status 404, expected 2xx", suite.Cases[2].Failure.Message)
+
+	// 未定义的变量记为请求错误，fail-fast 时停止
+	report, err = nm.RunCollection(context.Background(), c, CollectionOptions{FailFast: true})
+	require.NoError(t, err)
+	require.Len(t, report.Results, 1)
+	assert.EqualError(t, report.Results[0].Err, "undefined variable base")
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := map[string]interface{}{
+		"a":     map[string]interface{}{"b": []interface{}{"x", map[string]interface{}{"c": 1.0}}},
+		"d e":   true,
+		"empty": nil,
+	}
+	for path, expected := range map[string]interface{}{
+		"$":           doc,
+		"$.a.b[0]":    "x",
+		"$.a.b[1].c":  1.0,
+		`$["d e"]`:    true,
+		"$.empty":     nil,
+		`$.a["b"][0]`: "x",
+	} {
+		value, err := JSONPath(doc, path)
+		require.NoError(t, err, path)
+		assert.Equal(t, expected, value, path)
+	}
+	for _, path := range []string{"a.b", "$.a.b[2]", "$.a.x", "$.a.b.c", "$.a..b"} {
+		_, err := JSONPath(doc, path)
+		assert.Error(t, err, path)
+	}
+}
@@ -0,0 +1,293 @@
+package helpers
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Re-Wi/GoKitReWi/handlers"
+)
+
+// 本地修改冲突的处理策略
+const (
+	ConflictAbort     = "abort"      // 终止升级
+	ConflictOverwrite = "overwrite"  // 用新版本覆盖本地修改
+	ConflictKeepLocal = "keep-local" // 保留本地文件，跳过该条目
+	ConflictKeepBoth  = "keep-both"  // 保留本地文件，新版本另存为 <path>.new
+)
+
+// Conflict 一条冲突记录
+type Conflict struct {
+	Path         string `json:"path"`
+	Status       string `json:"status"`               // 升级包中的文件状态
+	Policy       string `json:"policy"`               // 生效的策略
+	Action       string `json:"action"`               // 实际执行的动作
+	LocalHash    string `json:"local_hash"`           // 本地文件哈希，文件不存在时为空
+	ExpectedHash string `json:"expected_hash"`        // 升级包期望的本地文件哈希
+	Unresolved   bool   `json:"unresolved,omitempty"` // 文件中写入了冲突标记，需手动编辑后才能使用
+}
+
+// ConflictResolver 根据路径通配符选择冲突处理策略，并记录所有冲突
+type ConflictResolver struct {
+	Rules   []handlers.ConflictPolicy // 按顺序匹配，先匹配的生效
+	Default string                    // 没有规则匹配时的策略，默认 abort
+
+	mu        sync.Mutex
+	conflicts []Conflict
+}
+
+// ParseConflictPolicies 解析 "glob=policy" 格式的策略列表
+func ParseConflictPolicies(specs []string) ([]handlers.ConflictPolicy, error) {
+	rules := make([]handlers.ConflictPolicy, 0, len(specs))
+	for _, spec := range specs {
+		idx := strings.LastIndex(spec, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid conflict policy %q, expected glob=policy", spec)
+		}
+		rule := handlers.ConflictPolicy{
+			Pattern: strings.TrimSpace(spec[:idx]),
+			Policy:  strings.TrimSpace(spec[idx+1:]),
+		}
+		if err := ValidateConflictPolicy(rule.Policy); err != nil {
+			return nil, err
+		}
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", rule.Pattern, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ValidateConflictPolicy 校验策略名称
+func ValidateConflictPolicy(policy string) error {
+	switch policy {
+	case ConflictAbort, ConflictOverwrite, ConflictKeepLocal, ConflictKeepBoth:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict policy %q (abort, overwrite, keep-local, keep-both)", policy)
+}
+
+// matchGlob 通配符匹配；不含 "/" 的模式同时匹配文件名，"dir/" 结尾的模式匹配整个目录
+func matchGlob(pattern, relPath string) bool {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(relPath+"/", pattern)
+	}
+	if ok, _ := path.Match(pattern, relPath); ok {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(relPath))
+		return ok
+	}
+	return false
+}
+
+// PolicyFor 返回路径对应的冲突处理策略
+func (cr *ConflictResolver) PolicyFor(relPath string) string {
+	for _, rule := range cr.Rules {
+		if matchGlob(rule.Pattern, relPath) {
+			return rule.Policy
+		}
+	}
+	if cr.Default != "" {
+		return cr.Default
+	}
+	return ConflictAbort
+}
+
+func (cr *ConflictResolver) record(c Conflict) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.conflicts = append(cr.conflicts, c)
+}
+
+// Conflicts 返回已记录的冲突（按路径排序）
+func (cr *ConflictResolver) Conflicts() []Conflict {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	result := append([]Conflict(nil), cr.conflicts...)
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// WriteConflictReport 将冲突记录写入 JSON 文件
+func WriteConflictReport(conflicts []Conflict, filename string) error {
+	if conflicts == nil {
+		conflicts = []Conflict{}
+	}
+	data, err := json.MarshalIndent(conflicts, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// localHash 计算已安装文件的哈希，文件不存在时返回空字符串
+func localHash(path string) (string, error) {
+	exists, isFile, _, err := PathInfo(path)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", nil
+	}
+	if !isFile {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	return CalculateFileHash(path, md5.New)
+}
+
+// detectConflict 检查已安装文件是否与升级包的预期一致
+// 返回 nil 表示没有冲突
+func (pa *PatchApp) detectConflict(file handlers.FileEntry) (*Conflict, error) {
+	installed := filepath.Join(pa.TargetDir, file.Path)
+	hash, err := localHash(installed)
+	if err != nil {
+		return nil, err
+	}
+
+	var expected string
+	switch file.Status {
+	case "added":
+		// 本地不存在，或已经是新版本内容，均不算冲突
+		if hash == "" || hash == file.Hash {
+			return nil, nil
+		}
+	case "modified", "deleted":
+		// 三方合并的配置文件由合并流程处理本地修改
+		if file.Status == "modified" && file.Merge != "" {
+			return nil, nil
+		}
+		// 旧版升级包没有基准哈希，无法检测
+		if file.BaseHash == "" || hash == file.BaseHash {
+			return nil, nil
+		}
+		// 删除的文件本地已不存在，视为已完成
+		if file.Status == "deleted" && hash == "" {
+			return nil, nil
+		}
+		expected = file.BaseHash
+	default:
+		return nil, nil
+	}
+
+	return &Conflict{
+		Path:         file.Path,
+		Status:       file.Status,
+		Policy:       pa.Conflicts.PolicyFor(file.Path),
+		LocalHash:    hash,
+		ExpectedHash: expected,
+	}, nil
+}
+
+// scanConflicts 在修改任何文件之前检查所有条目
+// 所有冲突都会被记录；存在 abort 策略的冲突时返回错误，此时不应用任何条目
+func (pa *PatchApp) scanConflicts(files []handlers.FileEntry) error {
+	pa.pending = make(map[string]*Conflict)
+
+	var aborted []string
+	for _, file := range files {
+		conflict, err := pa.detectConflict(file)
+		if err != nil {
+			return fmt.Errorf("check %s: %w", file.Path, err)
+		}
+		if conflict == nil {
+			continue
+		}
+		if conflict.Policy == ConflictAbort {
+			conflict.Action = "aborted"
+			pa.Conflicts.record(*conflict)
+			aborted = append(aborted, file.Path)
+			continue
+		}
+		pa.pending[filepath.Clean(file.Path)+"\x00"+file.Status] = conflict
+	}
+
+	if len(aborted) > 0 {
+		// 中止时其余冲突也计入报告，便于一次性处理
+		for _, c := range pa.pending {
+			c.Action = "not applied"
+			pa.Conflicts.record(*c)
+		}
+		return fmt.Errorf("%d file(s) modified locally with policy abort: %s", len(aborted), strings.Join(aborted, ", "))
+	}
+	return nil
+}
+
+// conflictFor 返回条目的冲突；经过 scanConflicts 时直接使用扫描结果
+func (pa *PatchApp) conflictFor(file handlers.FileEntry) (*Conflict, error) {
+	if pa.pending != nil {
+		return pa.pending[filepath.Clean(file.Path)+"\x00"+file.Status], nil
+	}
+	return pa.detectConflict(file)
+}
+
+// resolveConflict 按策略处理一个冲突条目
+func (pa *PatchApp) resolveConflict(file handlers.FileEntry, c *Conflict) error {
+	staged := filepath.Join(pa.NewTempDir, file.Path)
+
+	switch c.Policy {
+	case ConflictAbort:
+		c.Action = "aborted"
+		return fmt.Errorf("%s was modified locally (expected %s, got %s)", file.Path, c.ExpectedHash, c.LocalHash)
+
+	case ConflictKeepLocal:
+		// 新版本目录中保存的就是本地文件，不做处理
+		c.Action = "kept local file"
+		return nil
+
+	case ConflictOverwrite:
+		switch file.Status {
+		case "deleted":
+			c.Action = "deleted local file"
+			return pa.ProcessDeleted(file)
+		case "added":
+			c.Action = "overwrote local file"
+			if err := os.Remove(staged); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return pa.copyAdded(file, staged)
+		default:
+			c.Action = "overwrote local file"
+			return pa.patchFromPristine(file, staged)
+		}
+
+	case ConflictKeepBoth:
+		switch file.Status {
+		case "deleted":
+			c.Action = "kept local file"
+			return nil
+		case "added":
+			c.Action = "wrote " + file.Path + ".new"
+			return pa.copyAdded(file, staged+".new")
+		default:
+			c.Action = "wrote " + file.Path + ".new"
+			return pa.patchFromPristine(file, staged+".new")
+		}
+	}
+	return ValidateConflictPolicy(c.Policy)
+}
+
+// patchFromPristine 本地文件已被修改，只能基于未修改的旧版本文件生成新版本
+func (pa *PatchApp) patchFromPristine(file handlers.FileEntry, dest string) error {
+	if pa.PristineDir == nil {
+		return fmt.Errorf("%s was modified locally and no pristine copy is available to rebuild it", file.Path)
+	}
+	dir, err := pa.PristineDir()
+	if err != nil {
+		return fmt.Errorf("prepare pristine copy: %w", err)
+	}
+	pristine := filepath.Join(dir, file.Path)
+	if err := VerifyFileHash(pristine, file.BaseHash, md5.New); err != nil {
+		return fmt.Errorf("pristine copy of %s: %w", file.Path, err)
+	}
+	return pa.applyPatch(file, pristine, dest)
+}
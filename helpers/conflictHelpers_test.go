@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"context"
+	"crypto/md5"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Re-Wi/GoKitReWi/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConflictPolicyFor(t *testing.T) {
+	rules, err := ParseConflictPolicies([]string{
+		"conf/*.yaml=keep-both",
+		"*.log=keep-local",
+		"data/=overwrite",
+	})
+	require.NoError(t, err)
+	cr := &ConflictResolver{Rules: rules}
+
+	assert.Equal(t, ConflictKeepBoth, cr.PolicyFor("conf/app.yaml"))
+	assert.Equal(t, ConflictKeepLocal, cr.PolicyFor("var/run/app.log"))
+	assert.Equal(t, ConflictOverwrite, cr.PolicyFor("data/a/b.bin"))
+	assert.Equal(t, ConflictAbort, cr.PolicyFor("bin/app"))
+
+	_, err = ParseConflictPolicies([]string{"*.yaml=merge"})
+	assert.Error(t, err)
+	_, err = ParseConflictPolicies([]string{"keep-local"})
+	assert.Error(t, err)
+}
+
+func TestApplyFilesConflicts(t *testing.T) {
+	pa := &PatchApp{
+		TargetDir:    t.TempDir(),
+		PatchTempDir: t.TempDir(),
+		NewTempDir:   t.TempDir(),
+	}
+	// 已安装的文件被运维人员修改过
+	for _, dir := range []string{pa.TargetDir, pa.NewTempDir} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "local.conf"), []byte("edited"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "old.conf"), []byte("edited"), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(pa.TargetDir, "untouched.conf"), []byte("v1"), 0644))
+
+	added := addedEntry(t, pa.PatchTempDir, "local.conf", "shipped")
+	files := []handlers.FileEntry{
+		added,
+		{Path: "old.conf", Status: "deleted", BaseHash: "d41d8cd98f00b204e9800998ecf8427e"},
+	}
+
+	t.Run("默认终止", func(t *testing.T) {
+		pa.Conflicts = &ConflictResolver{}
+		err := pa.ApplyFiles(context.Background(), files, 2)
+		assert.Error(t, err)
+		assert.Len(t, pa.Conflicts.Conflicts(), 2)
+		assert.FileExists(t, filepath.Join(pa.NewTempDir, "old.conf"))
+	})
+
+	t.Run("保留两份", func(t *testing.T) {
+		pa.Conflicts = &ConflictResolver{Default: ConflictKeepBoth}
+		require.NoError(t, pa.ApplyFiles(context.Background(), files, 2))
+
+		data, err := os.ReadFile(filepath.Join(pa.NewTempDir, "local.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, "edited", string(data))
+		assert.NoError(t, VerifyFileHash(filepath.Join(pa.NewTempDir, "local.conf.new"), added.Hash, md5.New))
+		assert.FileExists(t, filepath.Join(pa.NewTempDir, "old.conf"))
+
+		conflicts := pa.Conflicts.Conflicts()
+		require.Len(t, conflicts, 2)
+		assert.Equal(t, "local.conf", conflicts[0].Path)
+		assert.Equal(t, ConflictKeepBoth, conflicts[0].Policy)
+	})
+
+	t.Run("修改的文件没有原始副本", func(t *testing.T) {
+		pa.Conflicts = &ConflictResolver{Default: ConflictOverwrite}
+		modified := handlers.FileEntry{
+			Path:     "untouched.conf",
+			Status:   "modified",
+			BaseHash: "0000",
+			Patch:    &handlers.FilePatch{Path: "files/untouched.conf.patch"},
+		}
+		err := pa.ApplyFiles(context.Background(), []handlers.FileEntry{modified}, 1)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "pristine")
+	})
+}
@@ -25,10 +25,15 @@ type DiffGenerator struct {
 	OutputDir     string
 	Workers       int
 	IncludeBin    bool
+	Conflicts     []handlers.ConflictPolicy // 写入升级包的冲突处理策略
+	MergePatterns []string                  // 按键三方合并的配置文件通配符（仅 JSON/YAML）
 	UpdatePackage handlers.UpdatePackage
+	mu            sync.Mutex
 }
 
 func (dg *DiffGenerator) AddFile(file handlers.FileEntry) {
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
 	dg.UpdatePackage.Files = append(dg.UpdatePackage.Files, file)
 }
 
@@ -152,10 +157,12 @@ This is a simple README file for my project.
 
 	// 创建升级包实例
 	dg.UpdatePackage = handlers.UpdatePackage{
-		Version:     filepath.Clean(dg.TargetRef), // 版本号,
-		Description: "升级包描述",
-		Timestamp:   time.Now().Format("2006-01-02 15:04:05"),
-		Files:       []handlers.FileEntry{}, // 初始化文件列表
+		Version:          filepath.Clean(dg.TargetRef), // 版本号,
+		BaseVersion:      filepath.Clean(dg.BaseRef),
+		Description:      "升级包描述",
+		Timestamp:        time.Now().Format("2006-01-02 15:04:05"),
+		ConflictPolicies: dg.Conflicts,
+		Files:            []handlers.FileEntry{}, // 初始化文件列表
 	}
 
 	// ================== 1. 准备版本代码 ==================
@@ -450,7 +457,7 @@ func (dg *DiffGenerator) generateAdditionDiff(targetFile, outputDir, relFilePath
 		Size:   int(fileInfo.Size()),
 		Hash:   md5Hash,
 		Patch: &handlers.FilePatch{
-			Path: filepath.Clean(filepath.Join("files", filepath.Base(relFilePath))),
+			Path: filepath.Clean(filepath.Join("files", relFilePath)),
 			Size: int(fileInfo.Size()),
 			Hash: md5Hash,
 		},
@@ -538,29 +545,75 @@ func (dg *DiffGenerator) generateModificationDiff(baseFile, targetFile, outputDi
 	}
 	fmt.Printf("MD5 Hash: %s\n", o_md5Hash)
 
-	dg.AddFile(handlers.FileEntry{
-		Path:   relFilePath,
-		Type:   GetFileTypeSmart(baseFile),
-		Status: "modified",
-		Size:   int(b_fileInfo.Size()),
-		Hash:   b_md5Hash,
+	// 基准文件哈希，升级时用于检测本地修改
+	base_md5Hash, err := CalculateFileHash(baseFile, md5.New)
+	if err != nil {
+		return fmt.Errorf("Error calculating MD5: %w", err)
+	}
+
+	entry := handlers.FileEntry{
+		Path:     relFilePath,
+		Type:     GetFileTypeSmart(baseFile),
+		Status:   "modified",
+		Size:     int(b_fileInfo.Size()),
+		Hash:     b_md5Hash,
+		BaseHash: base_md5Hash,
 		Patch: &handlers.FilePatch{
-			Path: filepath.Clean(filepath.Join("files", filepath.Base(relFilePath)+".patch")),
+			Path: filepath.Clean(filepath.Join("files", relFilePath+".patch")),
 			Size: int(o_fileInfo.Size()),
 			Hash: o_md5Hash,
 		},
-	})
+	}
+
+	// 需要三方合并的配置文件，额外附带基准版本的完整副本
+	if dg.shouldMerge(relFilePath) {
+		// 与补丁文件放在同一目录，与清单中的 files/<relFilePath>.base 对应
+		baseCopy := strings.TrimSuffix(outputFile, ".patch") + ".base"
+		if err := CopyFile(baseFile, baseCopy); err != nil {
+			return fmt.Errorf("Error copying base file: %w", err)
+		}
+		baseInfo, err := os.Stat(baseCopy)
+		if err != nil {
+			return fmt.Errorf("获取文件信息失败: %w", err)
+		}
+		entry.Merge = MergeThreeWay
+		entry.Base = &handlers.FilePatch{
+			Path: filepath.Clean(filepath.Join("files", relFilePath+".base")),
+			Size: int(baseInfo.Size()),
+			Hash: base_md5Hash,
+		}
+	}
+
+	dg.AddFile(entry)
 
 	fmt.Printf("Successfully generated patch file !  %d KB \n", o_fileInfo.Size())
 	return nil
 }
 
+// shouldMerge 判断文件是否按键三方合并
+func (dg *DiffGenerator) shouldMerge(relFilePath string) bool {
+	if MergeFormat(relFilePath) == "" {
+		return false
+	}
+	for _, pattern := range dg.MergePatterns {
+		if matchGlob(pattern, relFilePath) {
+			return true
+		}
+	}
+	return false
+}
+
 func (dg *DiffGenerator) generateDeletionDiff(baseFile, relFilePath string) error {
+	baseHash, err := CalculateFileHash(baseFile, md5.New)
+	if err != nil {
+		return fmt.Errorf("Error calculating MD5: %w", err)
+	}
 
 	dg.AddFile(handlers.FileEntry{
-		Path:   relFilePath,
-		Type:   GetFileTypeSmart(baseFile),
-		Status: "deleted",
+		Path:     relFilePath,
+		Type:     GetFileTypeSmart(baseFile),
+		Status:   "deleted",
+		BaseHash: baseHash,
 	})
 
 	// content, err := os.ReadFile(baseFile)
@@ -0,0 +1,231 @@
+package helpers
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// RepoRef 更新服务器上的一个版本，格式为 platform/dependency/project@version
+type RepoRef struct {
+	Platform   string
+	Dependency string
+	Project    string
+	Version    string // 为空或 latest 时使用服务器上清单中的通道版本，没有清单时使用 version.txt
+
+	// 以下字段只在服务器有 manifest.json 时使用
+	Channel   string // 发布通道，默认 stable
+	DeviceID  string // 判断灰度范围的设备标识，为空时只使用完全发布的版本
+	Installed string // 已安装版本，用于选择适用的增量包
+
+	ClientVersion string // 当前 upgradeReWi 版本，低于清单的 min_client_version 时拒绝升级；为空时不检查
+}
+
+// ParseRepoRef 解析 platform/dependency/project[@version]
+func ParseRepoRef(ref string) (*RepoRef, error) {
+	name, version, _ := strings.Cut(ref, "@")
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid repository %q, expected platform/dependency/project@version", ref)
+	}
+	if version == "latest" {
+		version = ""
+	}
+	return &RepoRef{Platform: parts[0], Dependency: parts[1], Project: parts[2], Version: version}, nil
+}
+
+// ResolveRepoURL 返回版本升级包的下载地址
+//
+// 服务器有 manifest.json 时按通道与灰度选择版本，并优先选择基准版本为 Installed 的增量包；
+// 否则为 <base>/<platform>/<dependency>/<project>/<version>.tar.gz，未指定版本时先读取 version.txt。
+func (nm *NetManager) ResolveRepoURL(ctx context.Context, ref *RepoRef) (string, error) {
+	pkg, err := nm.ResolveRepoPackage(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return pkg.URL, nil
+}
+
+// ResolveRepoPackage 同 ResolveRepoURL，返回的升级包 URL 为绝对地址；
+// 来自清单时带有清单记录的大小与摘要，没有清单时只有 URL
+func (nm *NetManager) ResolveRepoPackage(ctx context.Context, ref *RepoRef) (*ReleasePackage, error) {
+	manifest, err := nm.FetchManifest(ctx, ref.Platform, ref.Dependency, ref.Project)
+	switch {
+	case err == nil:
+		return resolveManifestPackage(manifest, nm.ReqURL, ref)
+	case !errors.Is(err, ErrNoManifest):
+		return nil, fmt.Errorf("get manifest: %w", err)
+	}
+
+	version := ref.Version
+	if version == "" {
+		if err := nm.BuildReqURL(ref.Platform, ref.Dependency, ref.Project, "version.txt"); err != nil {
+			return nil, err
+		}
+		latest, err := nm.GetRemoteVersion(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get latest version: %w", err)
+		}
+		version = latest
+	}
+	if err := nm.BuildReqURL(ref.Platform, ref.Dependency, ref.Project, url.PathEscape(version)+".tar.gz"); err != nil {
+		return nil, err
+	}
+	return &ReleasePackage{URL: nm.ReqURL}, nil
+}
+
+// resolveManifestPackage 在清单中选择升级包，返回 URL 已解析为绝对地址的副本
+func resolveManifestPackage(manifest *Manifest, manifestURL string, ref *RepoRef) (*ReleasePackage, error) {
+	// 旧客户端可能不理解清单中新增的字段，按其选择的升级包不可靠
+	if ref.ClientVersion != "" && manifest.MinClientVersion != "" {
+		if cmp, err := CompareVersions(ref.ClientVersion, manifest.MinClientVersion); err == nil && cmp < 0 {
+			return nil, fmt.Errorf("manifest requires upgradeReWi %s or newer (running %s), run self-update first", manifest.MinClientVersion, ref.ClientVersion)
+		}
+	}
+	var (
+		release *Release
+		err     error
+	)
+	if ref.Version != "" {
+		if release = manifest.Release(ref.Version); release == nil {
+			return nil, fmt.Errorf("version %s not found in manifest", ref.Version)
+		}
+	} else if release, err = manifest.Resolve(ref.Channel, ref.DeviceID); err != nil {
+		return nil, err
+	}
+	if ref.Installed == release.Version {
+		return nil, fmt.Errorf("%s is already installed", release.Version)
+	}
+	// 切换到更稳定的通道或灰度被暂停时，通道版本可能低于已安装版本；只有显式指定版本时才降级
+	if cmp, err := CompareVersions(release.Version, ref.Installed); err == nil && cmp < 0 && ref.Version == "" {
+		return nil, fmt.Errorf("installed version %s is newer than %s on channel %s, use @%s to downgrade", ref.Installed, release.Version, displayChannel(ref.Channel), release.Version)
+	}
+
+	// 升级包一次只能应用一个：有直接适用的增量包时使用增量包，否则使用完整包
+	var chosen *ReleasePackage
+	for i := range release.Packages {
+		p := &release.Packages[i]
+		if ref.Installed != "" && p.BaseVersion == ref.Installed {
+			chosen = p
+			break
+		}
+		if p.Full() && chosen == nil {
+			chosen = p
+		}
+	}
+	if chosen == nil {
+		return nil, fmt.Errorf("no package of %s applies to installed version %s", release.Version, ref.Installed)
+	}
+	pkg := *chosen
+	if pkg.URL, err = chosen.ResolveURL(manifestURL); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+func displayChannel(channel string) string {
+	if channel == "" {
+		return ChannelStable
+	}
+	return channel
+}
+
+// DownloadVerified 下载 fileURL 到 cacheDir，并用服务器上的 <fileURL>.md5 校验
+// 缓存中已有校验通过的同名文件时不再下载。成功后同时写入 <file>.md5，返回本地文件路径。
+func (nm *NetManager) DownloadVerified(ctx context.Context, fileURL, cacheDir string) (string, error) {
+	dest, err := cachePath(fileURL, cacheDir)
+	if err != nil {
+		return "", err
+	}
+
+	// MD5 文件内容为 "<hash>" 或 "<hash>  <filename>"
+	checksumURL, _ := url.Parse(fileURL) // cachePath 已校验过 URL
+	checksumURL.Path += ".md5"
+	nm.ReqURL = checksumURL.String()
+	sum, err := nm.GetRemoteVersion(ctx)
+	if err != nil {
+		return "", fmt.Errorf("fetch checksum %s: %w", nm.ReqURL, err)
+	}
+	fields := strings.Fields(sum)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum %s", nm.ReqURL)
+	}
+	expected := fields[0]
+
+	if err := nm.downloadToCache(ctx, fileURL, dest, "md5:"+expected); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(dest+".md5", []byte(expected), 0644); err != nil {
+		return "", fmt.Errorf("write checksum: %w", err)
+	}
+	return dest, nil
+}
+
+// DownloadPackage 下载清单中的升级包到 cacheDir，用清单记录的 SHA256 校验，不再获取 .md5 文件，
+// 只发布 manifest.json 的静态服务器也可以使用；清单没有记录 SHA256 时同 DownloadVerified。
+// 成功后同样写入 <file>.md5（清单没有 MD5 时由下载的文件计算），返回本地文件路径。
+func (nm *NetManager) DownloadPackage(ctx context.Context, pkg *ReleasePackage, cacheDir string) (string, error) {
+	if pkg.SHA256 == "" {
+		return nm.DownloadVerified(ctx, pkg.URL, cacheDir)
+	}
+	dest, err := cachePath(pkg.URL, cacheDir)
+	if err != nil {
+		return "", err
+	}
+	if err := nm.downloadToCache(ctx, pkg.URL, dest, "sha256:"+pkg.SHA256); err != nil {
+		return "", err
+	}
+	sum := pkg.MD5
+	if sum == "" {
+		if sum, err = CalculateFileHash(dest, md5.New); err != nil {
+			return "", err
+		}
+	}
+	if err := os.WriteFile(dest+".md5", []byte(sum), 0644); err != nil {
+		return "", fmt.Errorf("write checksum: %w", err)
+	}
+	return dest, nil
+}
+
+// cachePath 下载文件在 cacheDir 中的路径，文件名取 URL 的最后一段
+func cachePath(fileURL, cacheDir string) (string, error) {
+	parsed, err := url.Parse(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	name := path.Base(parsed.Path)
+	if name == "/" || name == "." {
+		return "", fmt.Errorf("cannot determine file name from %s", fileURL)
+	}
+	return filepath.Join(cacheDir, name), nil
+}
+
+// downloadToCache 缓存中的文件与摘要 expected（algorithm:hex）不一致时重新下载
+func (nm *NetManager) downloadToCache(ctx context.Context, fileURL, dest, expected string) error {
+	c, err := parseChecksum(expected)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("create cache dir: %w", err)
+	}
+	if VerifyFileHash(dest, c.hex, c.newHash) == nil {
+		fmt.Printf("Using cached %s\n", dest)
+		return nil
+	}
+	// DownloadFile 校验通过后才会把 .part 文件放入缓存，中断的下载下次继续
+	nm.ReqURL = fileURL
+	nm.Checksum = c.String()
+	err = nm.DownloadFileContext(ctx, dest)
+	nm.Checksum = ""
+	if err != nil {
+		return fmt.Errorf("download %s: %w", fileURL, err)
+	}
+	return nil
+}
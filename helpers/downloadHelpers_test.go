@@ -0,0 +1,135 @@
+package helpers
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepoRef(t *testing.T) {
+	ref, err := ParseRepoRef("linux/app/server@v1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, RepoRef{Platform: "linux", Dependency: "app", Project: "server", Version: "v1.2.0"}, *ref)
+
+	ref, err = ParseRepoRef("linux/app/server@latest")
+	require.NoError(t, err)
+	assert.Empty(t, ref.Version)
+
+	_, err = ParseRepoRef("linux/server@v1")
+	assert.Error(t, err)
+}
+
+func TestDownloadVerified(t *testing.T) {
+	content := []byte("package content")
+	sum := fmt.Sprintf("%x", md5.Sum(content))
+	var downloads int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/linux/app/server/version.txt":
+			fmt.Fprintln(w, "v2")
+		case "/linux/app/server/v2.tar.gz":
+			atomic.AddInt32(&downloads, 1)
+			w.Write(content)
+		case "/linux/app/server/v2.tar.gz.md5":
+			fmt.Fprintf(w, "%s  v2.tar.gz\n", sum)
+		case "/bad.tar.gz":
+			w.Write([]byte("tampered"))
+		case "/bad.tar.gz.md5":
+			w.Write([]byte(sum))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	nm := NewNetManager()
+	nm.BaseURL = srv.URL
+	nm.Retries = 1
+	cacheDir := t.TempDir()
+
+	t.Run("解析最新版本并下载", func(t *testing.T) {
+		pkgURL, err := nm.ResolveRepoURL(context.Background(), &RepoRef{Platform: "linux", Dependency: "app", Project: "server"})
+		require.NoError(t, err)
+		assert.Equal(t, srv.URL+"/linux/app/server/v2.tar.gz", pkgURL)
+
+		path, err := nm.DownloadVerified(context.Background(), pkgURL, cacheDir)
+		require.NoError(t, err)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+
+		md5Data, err := os.ReadFile(path + ".md5")
+		require.NoError(t, err)
+		assert.Equal(t, sum, string(md5Data))
+	})
+
+	t.Run("使用缓存", func(t *testing.T) {
+		_, err := nm.DownloadVerified(context.Background(), srv.URL+"/linux/app/server/v2.tar.gz", cacheDir)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&downloads))
+	})
+
+	t.Run("校验失败不写入缓存", func(t *testing.T) {
+		_, err := nm.DownloadVerified(context.Background(), srv.URL+"/bad.tar.gz", cacheDir)
+		require.Error(t, err)
+		assert.NoFileExists(t, filepath.Join(cacheDir, "bad.tar.gz"))
+		assert.NoFileExists(t, filepath.Join(cacheDir, "bad.tar.gz.part"))
+	})
+}
+
+func TestDownloadPackage(t *testing.T) {
+	content := []byte("package content")
+	digest := sha256.Sum256(content)
+	manifest := Manifest{
+		Project:  "server",
+		Channels: map[string]string{ChannelStable: "v2.0.0"},
+		Releases: []Release{{Version: "v2.0.0", Packages: []ReleasePackage{{URL: "v2.0.0.tar.gz", Size: int64(len(content)), SHA256: hex.EncodeToString(digest[:])}}}},
+	}
+	// 静态服务器只发布清单与升级包，没有 .md5 文件
+	var body atomic.Value
+	body.Store(content)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/linux/app/server/manifest.json":
+			json.NewEncoder(w).Encode(manifest)
+		case "/linux/app/server/v2.0.0.tar.gz":
+			w.Write(body.Load().([]byte))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	nm := NewNetManager()
+	nm.BaseURL = srv.URL
+	nm.Retries = 0
+	pkg, err := nm.ResolveRepoPackage(context.Background(), &RepoRef{Platform: "linux", Dependency: "app", Project: "server"})
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/linux/app/server/v2.0.0.tar.gz", pkg.URL)
+	assert.Equal(t, manifest.Releases[0].Packages[0].SHA256, pkg.SHA256)
+
+	path, err := nm.DownloadPackage(context.Background(), pkg, t.TempDir())
+	require.NoError(t, err)
+	md5Data, err := os.ReadFile(path + ".md5")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", md5.Sum(content)), string(md5Data))
+
+	// 内容与清单中的摘要不一致时失败
+	body.Store([]byte("tampered"))
+	cacheDir := t.TempDir()
+	_, err = nm.DownloadPackage(context.Background(), pkg, cacheDir)
+	require.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "v2.0.0.tar.gz"))
+}
@@ -0,0 +1,749 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Fixture 一次录制的请求与响应
+type Fixture struct {
+	Request    FixtureRequest  `json:"request"`
+	Response   FixtureResponse `json:"response"`
+	RecordedAt time.Time       `json:"recorded_at,omitempty"`
+	Duration   time.Duration   `json:"duration,omitempty"`
+}
+
+// FixtureRequest 录制的请求，凭据（认证头、Cookie、URL 密码与敏感查询参数）已隐藏
+type FixtureRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"` // base64 表示 Body 是二进制内容的 base64 编码
+	BodyOmitted  bool        `json:"body_omitted,omitempty"`  // 内容超过录制上限，没有保存
+	BodySize     int64       `json:"body_size,omitempty"`     // 省略的内容大小，未知时为 0
+}
+
+// FixtureResponse 录制的响应
+type FixtureResponse struct {
+	Status       int         `json:"status"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+	BodyOmitted  bool        `json:"body_omitted,omitempty"`
+	BodySize     int64       `json:"body_size,omitempty"`
+}
+
+// fixtureFile 自有 JSON 格式的文件结构
+type fixtureFile struct {
+	Fixtures []Fixture `json:"fixtures"`
+}
+
+// LoadFixtures 读取录制文件，同时支持自有 JSON 格式与浏览器等导出的 HAR
+func LoadFixtures(path string) ([]Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var probe struct {
+		Log      json.RawMessage `json:"log"`
+		Fixtures json.RawMessage `json:"fixtures"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if probe.Log != nil {
+		fixtures, err := parseHAR(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		return fixtures, nil
+	}
+	var file fixtureFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return file.Fixtures, nil
+}
+
+// SaveFixtures 保存录制文件，扩展名为 .har 时保存为 HAR，否则为自有 JSON 格式
+func SaveFixtures(path string, fixtures []Fixture) error {
+	var v interface{} = fixtureFile{Fixtures: fixtures}
+	if strings.EqualFold(filepath.Ext(path), ".har") {
+		v = buildHAR(fixtures)
+	}
+	// 录制的响应体多为 HTML 与 JSON，不转义 <>& 便于阅读与 diff
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// encodeFixtureBody 文本内容原样保存，二进制内容保存为 base64
+func encodeFixtureBody(data []byte) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+func decodeFixtureBody(body, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+// redactHeaders 返回隐藏凭据后的请求头副本
+func redactHeaders(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		for _, v := range values {
+			out.Add(name, redactHeader(name, v))
+		}
+	}
+	return out
+}
+
+// DefaultFixtureMaxBody 默认的单个请求体或响应体录制上限
+const DefaultFixtureMaxBody = 1 << 20
+
+// fixtureOmittedComment HAR 中标记省略内容的注释
+const fixtureOmittedComment = "body omitted: larger than the recording limit"
+
+// FixtureRecorder 记录经过网络的请求与响应，可以并发使用
+type FixtureRecorder struct {
+	// MaxBodySize 单个请求体或响应体的录制上限，超过时只记录大小并标记为省略；
+	// 0 表示 DefaultFixtureMaxBody，负数表示不限制
+	MaxBodySize int64
+
+	mu       sync.Mutex
+	fixtures []Fixture
+}
+
+// NewFixtureRecorder 创建录制器，fixtures 为已有的录制，新的录制追加在后面
+func NewFixtureRecorder(fixtures ...Fixture) *FixtureRecorder {
+	return &FixtureRecorder{fixtures: fixtures}
+}
+
+// Fixtures 返回已录制的请求与响应
+func (r *FixtureRecorder) Fixtures() []Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Fixture(nil), r.fixtures...)
+}
+
+// Save 保存到 path，格式见 SaveFixtures
+func (r *FixtureRecorder) Save(path string) error {
+	return SaveFixtures(path, r.Fixtures())
+}
+
+// Wrap 返回录制经过 next 的请求与响应的 RoundTripper
+func (r *FixtureRecorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recordTransport{recorder: r, next: next}
+}
+
+// withRecorder 在基础传输层录制，重试与镜像切换的每次尝试都单独记录，缓存命中不经过网络因此不记录
+func (nm *NetManager) withRecorder(next http.RoundTripper) http.RoundTripper {
+	if nm.Recorder == nil {
+		return next
+	}
+	return nm.Recorder.Wrap(next)
+}
+
+type recordTransport struct {
+	recorder *FixtureRecorder
+	next     http.RoundTripper
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limit := t.recorder.MaxBodySize
+	if limit == 0 {
+		limit = DefaultFixtureMaxBody
+	}
+
+	var (
+		reqBody    []byte
+		reqOmitted bool
+	)
+	switch {
+	case req.GetBody != nil:
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		reqBody, reqOmitted, err = readUpTo(body, limit)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("record request body: %w", err)
+		}
+	case req.Body != nil && req.Body != http.NoBody:
+		data, omitted, err := readUpTo(req.Body, limit)
+		if err != nil {
+			req.Body.Close()
+			return nil, fmt.Errorf("record request body: %w", err)
+		}
+		// 超过上限时已读的部分与剩余内容一起发送
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), req.Body), req.Body}
+		reqBody, reqOmitted = data, omitted
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	f := Fixture{
+		Request: FixtureRequest{
+			Method:  req.Method,
+			URL:     redactQuery(req.URL.String()),
+			Headers: redactHeaders(req.Header),
+		},
+		Response: FixtureResponse{
+			Status:  resp.StatusCode,
+			Headers: redactHeaders(resp.Header),
+		},
+		RecordedAt: start.UTC().Truncate(time.Second),
+		Duration:   time.Since(start).Round(time.Millisecond),
+	}
+	if reqOmitted {
+		f.Request.BodyOmitted = true
+		if req.ContentLength > 0 {
+			f.Request.BodySize = req.ContentLength
+		}
+	} else {
+		f.Request.Body, f.Request.BodyEncoding = encodeFixtureBody(reqBody)
+	}
+
+	// 响应体边读边交给上层，只保留不超过上限的内容，读完或关闭时写入录制
+	resp.Body = &recordBody{
+		ReadCloser: resp.Body,
+		limit:      limit,
+		length:     resp.ContentLength,
+		done: func(body []byte, size int64, omitted bool) {
+			f.Duration = time.Since(start).Round(time.Millisecond)
+			if omitted {
+				f.Response.BodyOmitted, f.Response.BodySize = true, size
+			} else {
+				f.Response.Body, f.Response.BodyEncoding = encodeFixtureBody(body)
+			}
+			t.recorder.mu.Lock()
+			t.recorder.fixtures = append(t.recorder.fixtures, f)
+			t.recorder.mu.Unlock()
+		},
+	}
+	return resp, nil
+}
+
+// readUpTo 读取不超过 limit 字节，超过时 omitted 为 true，data 为已读的 limit+1 字节；limit 为负数时不限制
+func readUpTo(r io.Reader, limit int64) (data []byte, omitted bool, err error) {
+	if limit < 0 {
+		data, err = io.ReadAll(r)
+		return data, false, err
+	}
+	data, err = io.ReadAll(io.LimitReader(r, limit+1))
+	return data, int64(len(data)) > limit, err
+}
+
+// recordBody 录制经过的响应体，超过上限后丢弃已保存的内容，只统计大小
+type recordBody struct {
+	io.ReadCloser
+	limit   int64
+	length  int64 // 响应头中的长度，未知时为 -1
+	buf     []byte
+	size    int64
+	omitted bool
+	once    sync.Once
+	done    func(body []byte, size int64, omitted bool)
+}
+
+func (b *recordBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.capture(p[:n])
+	if err == io.EOF {
+		b.finish(true)
+	} else if err != nil {
+		b.finish(false)
+	}
+	return n, err
+}
+
+func (b *recordBody) capture(p []byte) {
+	b.size += int64(len(p))
+	if b.omitted {
+		return
+	}
+	if b.limit >= 0 && b.size > b.limit {
+		b.omitted, b.buf = true, nil
+		return
+	}
+	b.buf = append(b.buf, p...)
+}
+
+func (b *recordBody) Close() error {
+	if !b.omitted {
+		// 上层没有读完时补读剩余内容，最多读到超过上限为止
+		rest := io.Reader(b.ReadCloser)
+		if b.limit >= 0 {
+			rest = io.LimitReader(rest, b.limit-b.size+1)
+		}
+		data, err := io.ReadAll(rest)
+		b.capture(data)
+		b.finish(err == nil && !b.omitted)
+	}
+	b.finish(false)
+	return b.ReadCloser.Close()
+}
+
+// finish 写入录制；complete 表示读到了响应体末尾，大小确定
+func (b *recordBody) finish(complete bool) {
+	b.once.Do(func() {
+		omitted, size := b.omitted, b.size
+		if !complete {
+			omitted, size = true, 0
+			if b.length > 0 {
+				size = b.length
+			}
+		}
+		b.done(b.buf, size, omitted)
+	})
+}
+
+// FixtureMatch 回放时请求与录制的匹配规则，默认比较方法、scheme、主机、路径与查询参数
+type FixtureMatch struct {
+	IgnoreHost  bool     // 不比较 scheme 与主机，录制的线上请求可以由本地服务回放
+	IgnoreQuery []string // 不参与比较的查询参数，如时间戳与随机数
+	Headers     []string // 需要一致的请求头
+	Body        bool     // 比较请求体，JSON 请求体按内容比较，忽略格式与字段顺序
+}
+
+// FixtureMissError 没有与请求匹配的录制
+type FixtureMissError struct {
+	Method string
+	URL    string
+}
+
+func (e *FixtureMissError) Error() string {
+	return fmt.Sprintf("no recorded fixture matches %s %s", e.Method, e.URL)
+}
+
+// FixtureReplayer 按匹配规则回放录制的响应，既是 RoundTripper 也是 http.Handler
+//
+// 同一请求有多条录制时按录制顺序依次返回（例如先 503 后 200 的重试），用完后重复返回最后一条。
+type FixtureReplayer struct {
+	match    FixtureMatch
+	mu       sync.Mutex
+	fixtures []Fixture
+	used     []int
+}
+
+// NewFixtureReplayer 创建回放器
+func NewFixtureReplayer(fixtures []Fixture, match FixtureMatch) *FixtureReplayer {
+	return &FixtureReplayer{match: match, fixtures: fixtures, used: make([]int, len(fixtures))}
+}
+
+// NewFixtureServer 启动回放录制的测试服务，请求只按路径与查询参数匹配，调用方负责 Close
+func NewFixtureServer(fixtures []Fixture, match FixtureMatch) *httptest.Server {
+	match.IgnoreHost = true
+	return httptest.NewServer(NewFixtureReplayer(fixtures, match))
+}
+
+// Unused 返回从未被请求过的录制，用于确认测试覆盖了所有录制的请求
+func (r *FixtureReplayer) Unused() []Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Fixture
+	for i, n := range r.used {
+		if n == 0 {
+			unused = append(unused, r.fixtures[i])
+		}
+	}
+	return unused
+}
+
+// lookup 返回与请求匹配的下一条录制
+func (r *FixtureReplayer) lookup(req *http.Request, body []byte) (*Fixture, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := -1
+	for i := range r.fixtures {
+		if !r.match.matches(&r.fixtures[i], req, body) {
+			continue
+		}
+		if r.used[i] == 0 {
+			r.used[i]++
+			return &r.fixtures[i], nil
+		}
+		last = i
+	}
+	if last < 0 {
+		return nil, &FixtureMissError{Method: req.Method, URL: redactQuery(req.URL.String())}
+	}
+	r.used[last]++
+	return &r.fixtures[last], nil
+}
+
+// RoundTrip 返回录制的响应，没有匹配的录制时返回 *FixtureMissError
+func (r *FixtureReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.lookup(req, body)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := f.responseBody()
+	if err != nil {
+		return nil, err
+	}
+	header := f.Response.Headers.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Response.Status, http.StatusText(f.Response.Status)),
+		StatusCode:    f.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// ServeHTTP 返回录制的响应，没有匹配的录制时返回 404 与 X-Fixture-Miss 响应头
+func (r *FixtureReplayer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := r.lookup(req, body)
+	if err != nil {
+		w.Header().Set("X-Fixture-Miss", "1")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	respBody, err := f.responseBody()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for name, values := range f.Response.Headers {
+		// 长度以回放的响应体为准
+		if name == "Content-Length" {
+			continue
+		}
+		w.Header()[name] = values
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(respBody)))
+	w.WriteHeader(f.Response.Status)
+	w.Write(respBody)
+}
+
+// responseBody 返回录制的响应体，录制时省略了内容的响应不能回放
+func (f *Fixture) responseBody() ([]byte, error) {
+	if f.Response.BodyOmitted {
+		return nil, fmt.Errorf("fixture for %s %s has no recorded body (%d bytes, larger than the recording limit)", f.Request.Method, f.Request.URL, f.Response.BodySize)
+	}
+	body, err := decodeFixtureBody(f.Response.Body, f.Response.BodyEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("decode fixture body: %w", err)
+	}
+	return body, nil
+}
+
+// readRequestBody 读取请求体并恢复，以便继续使用
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// matches 请求是否与录制匹配；录制中的凭据已隐藏，请求先以同样的方式隐藏再比较
+func (m FixtureMatch) matches(f *Fixture, req *http.Request, body []byte) bool {
+	if !strings.EqualFold(f.Request.Method, req.Method) {
+		return false
+	}
+	recorded, err := url.Parse(f.Request.URL)
+	if err != nil {
+		return false
+	}
+	actual, err := url.Parse(redactQuery(req.URL.String()))
+	if err != nil {
+		return false
+	}
+	if !m.IgnoreHost && (recorded.Scheme != actual.Scheme || recorded.Host != actual.Host) {
+		return false
+	}
+	if recorded.EscapedPath() != actual.EscapedPath() || !m.sameQuery(recorded.Query(), actual.Query()) {
+		return false
+	}
+	for _, name := range m.Headers {
+		if f.Request.Headers.Get(name) != redactHeader(name, req.Header.Get(name)) {
+			return false
+		}
+	}
+	// 录制时省略了的请求体无法比较，只按其余条件匹配
+	if m.Body && !f.Request.BodyOmitted {
+		recordedBody, err := decodeFixtureBody(f.Request.Body, f.Request.BodyEncoding)
+		if err != nil {
+			return false
+		}
+		if !bytes.Equal(recordedBody, body) {
+			var a, b interface{}
+			if json.Unmarshal(recordedBody, &a) != nil || json.Unmarshal(body, &b) != nil || !jsonEqual(a, b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sameQuery 比较查询参数，参数顺序不影响结果
+func (m FixtureMatch) sameQuery(a, b url.Values) bool {
+	for _, name := range m.IgnoreQuery {
+		a.Del(name)
+		b.Del(name)
+	}
+	return a.Encode() == b.Encode()
+}
+
+// HAR 1.2 中用到的部分
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harNameValues 按名称排序输出请求头或查询参数
+func harNameValues(values map[string][]string) []harNameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := []harNameValue{}
+	for _, name := range names {
+		for _, v := range values[name] {
+			out = append(out, harNameValue{Name: name, Value: v})
+		}
+	}
+	return out
+}
+
+// buildHAR 将录制转换为 HAR，可以用浏览器开发者工具等查看
+func buildHAR(fixtures []Fixture) harFile {
+	har := harFile{Log: harLog{Version: "1.2", Creator: harCreator{Name: "upgradeReWi", Version: "1.0"}, Entries: []harEntry{}}}
+	for _, f := range fixtures {
+		ms := float64(f.Duration) / float64(time.Millisecond)
+		entry := harEntry{
+			StartedDateTime: f.RecordedAt,
+			Time:            ms,
+			Request: harRequest{
+				Method:      f.Request.Method,
+				URL:         f.Request.URL,
+				HTTPVersion: "HTTP/1.1",
+				Headers:     harNameValues(f.Request.Headers),
+				QueryString: []harNameValue{},
+				HeadersSize: -1,
+				BodySize:    len(f.Request.Body),
+			},
+			Response: harResponse{
+				Status:      f.Response.Status,
+				StatusText:  http.StatusText(f.Response.Status),
+				HTTPVersion: "HTTP/1.1",
+				Headers:     harNameValues(f.Response.Headers),
+				Content: harContent{
+					Size:     len(f.Response.Body),
+					MimeType: f.Response.Headers.Get("Content-Type"),
+					Text:     f.Response.Body,
+					Encoding: f.Response.BodyEncoding,
+				},
+				RedirectURL: f.Response.Headers.Get("Location"),
+				HeadersSize: -1,
+				BodySize:    len(f.Response.Body),
+			},
+			Timings: harTimings{Wait: ms},
+		}
+		if u, err := url.Parse(f.Request.URL); err == nil {
+			entry.Request.QueryString = harNameValues(u.Query())
+		}
+		if f.Request.Body != "" {
+			entry.Request.PostData = &harPostData{MimeType: f.Request.Headers.Get("Content-Type"), Text: f.Request.Body}
+		}
+		if f.Request.BodyOmitted {
+			entry.Request.BodySize = int(f.Request.BodySize)
+			entry.Request.PostData = &harPostData{MimeType: f.Request.Headers.Get("Content-Type"), Comment: fixtureOmittedComment}
+		}
+		if f.Response.BodyOmitted {
+			entry.Response.BodySize = int(f.Response.BodySize)
+			entry.Response.Content.Size = int(f.Response.BodySize)
+			entry.Response.Content.Comment = fixtureOmittedComment
+		}
+		har.Log.Entries = append(har.Log.Entries, entry)
+	}
+	return har
+}
+
+// parseHAR 读取 HAR 中的请求与响应，HAR 不区分二进制请求体，请求体按文本处理
+//
+// HTTP/2 的伪首部（:authority 等）被忽略；HAR 中的响应体已经解压，因此同时去掉 Content-Encoding。
+func parseHAR(data []byte) ([]Fixture, error) {
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, err
+	}
+	fixtures := make([]Fixture, 0, len(har.Log.Entries))
+	for _, e := range har.Log.Entries {
+		f := Fixture{
+			Request: FixtureRequest{
+				Method:  e.Request.Method,
+				URL:     e.Request.URL,
+				Headers: make(http.Header),
+			},
+			Response: FixtureResponse{
+				Status:       e.Response.Status,
+				Headers:      make(http.Header),
+				Body:         e.Response.Content.Text,
+				BodyEncoding: e.Response.Content.Encoding,
+			},
+			RecordedAt: e.StartedDateTime,
+			Duration:   time.Duration(e.Time * float64(time.Millisecond)),
+		}
+		for _, h := range e.Request.Headers {
+			if !strings.HasPrefix(h.Name, ":") {
+				f.Request.Headers.Add(h.Name, h.Value)
+			}
+		}
+		for _, h := range e.Response.Headers {
+			if !strings.HasPrefix(h.Name, ":") {
+				f.Response.Headers.Add(h.Name, h.Value)
+			}
+		}
+		f.Response.Headers.Del("Content-Encoding")
+		if e.Request.PostData != nil {
+			f.Request.Body = e.Request.PostData.Text
+			if e.Request.PostData.Comment == fixtureOmittedComment {
+				f.Request.BodyOmitted, f.Request.BodySize = true, int64(e.Request.BodySize)
+			}
+		}
+		if e.Response.Content.Comment == fixtureOmittedComment {
+			f.Response.BodyOmitted, f.Response.BodySize = true, int64(e.Response.Content.Size)
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
@@ -0,0 +1,175 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version.txt":
+			// 第一次返回 503，录制中保留重试的过程
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("v1.2.0\n"))
+		case "/blob":
+			w.Write([]byte{0xff, 0x00, 0xfe})
+		}
+	}))
+	defer srv.Close()
+
+	recorder := NewFixtureRecorder()
+	nm := newTestNetManager(srv.URL + "/version.txt?token=abc&t=1")
+	nm.Auth = &TokenAuth{Token: "secret"}
+	nm.Recorder = recorder
+	version, err := nm.GetRemoteVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", version)
+	nm.ReqURL = srv.URL + "/blob"
+	_, err = nm.GetRemoteVersion(context.Background())
+	require.NoError(t, err)
+
+	fixtures := recorder.Fixtures()
+	require.Len(t, fixtures, 3)
+	assert.Equal(t, http.StatusServiceUnavailable, fixtures[0].Response.Status)
+	assert.Equal(t, "Bearer <redacted>", fixtures[1].Request.Headers.Get("Authorization"))
+	assert.Equal(t, srv.URL+"/version.txt?t=1&token=REDACTED", fixtures[1].Request.URL)
+	assert.Equal(t, "base64", fixtures[2].Response.BodyEncoding)
+
+	dir := t.TempDir()
+	for _, name := range []string{"session.json", "session.har"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, recorder.Save(path))
+			loaded, err := LoadFixtures(path)
+			require.NoError(t, err)
+			require.Len(t, loaded, 3)
+
+			// 回放时重试同样先得到 503 再得到 200，查询参数顺序与凭据不影响匹配
+			replayer := NewFixtureReplayer(loaded, FixtureMatch{})
+			replay := newTestNetManager(srv.URL + "/version.txt?t=1&token=other")
+			replay.HTTPClient = &http.Client{Transport: replayer}
+			version, err := replay.GetRemoteVersion(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "v1.2.0", version)
+			assert.Len(t, replayer.Unused(), 1)
+
+			replay.ReqURL = srv.URL + "/blob"
+			_, err = replay.GetRemoteVersion(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, replayer.Unused())
+		})
+	}
+
+	// 没有匹配的录制时不重试
+	replay := newTestNetManager(srv.URL + "/version.txt?token=abc&t=2")
+	replay.HTTPClient = &http.Client{Transport: NewFixtureReplayer(fixtures, FixtureMatch{})}
+	_, err = replay.GetRemoteVersion(context.Background())
+	var miss *FixtureMissError
+	require.True(t, errors.As(err, &miss), err)
+	assert.Equal(t, "GET", miss.Method)
+	replay.HTTPClient = &http.Client{Transport: NewFixtureReplayer(fixtures, FixtureMatch{IgnoreQuery: []string{"t"}})}
+	_, err = replay.GetRemoteVersion(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestRecordBodyLimit(t *testing.T) {
+	large := strings.Repeat("x", 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/large" {
+			io.WriteString(w, large)
+			return
+		}
+		io.WriteString(w, "small")
+	}))
+	defer srv.Close()
+
+	recorder := NewFixtureRecorder()
+	recorder.MaxBodySize = 10
+	client := &http.Client{Transport: recorder.Wrap(nil)}
+	for _, path := range []string{"/large", "/small"} {
+		resp, err := client.Post(srv.URL+path, "text/plain", strings.NewReader(large))
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		if path == "/large" {
+			assert.Equal(t, large, string(body), "the caller still gets the whole body")
+		}
+	}
+
+	fixtures := recorder.Fixtures()
+	require.Len(t, fixtures, 2)
+	assert.True(t, fixtures[0].Request.BodyOmitted)
+	assert.Equal(t, int64(100), fixtures[0].Request.BodySize)
+	assert.Empty(t, fixtures[0].Request.Body)
+	assert.True(t, fixtures[0].Response.BodyOmitted)
+	assert.Equal(t, int64(100), fixtures[0].Response.BodySize)
+	assert.Empty(t, fixtures[0].Response.Body)
+	assert.False(t, fixtures[1].Response.BodyOmitted)
+	assert.Equal(t, "small", fixtures[1].Response.Body)
+
+	// 省略的标记在 HAR 中保留，回放省略了内容的响应时报错
+	path := filepath.Join(t.TempDir(), "session.har")
+	require.NoError(t, recorder.Save(path))
+	loaded, err := LoadFixtures(path)
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	assert.True(t, loaded[0].Request.BodyOmitted)
+	assert.True(t, loaded[0].Response.BodyOmitted)
+	assert.Equal(t, int64(100), loaded[0].Response.BodySize)
+
+	replay := &http.Client{Transport: NewFixtureReplayer(loaded, FixtureMatch{})}
+	_, err = replay.Post(srv.URL+"/large", "text/plain", strings.NewReader(large))
+	assert.ErrorContains(t, err, "has no recorded body (100 bytes")
+}
+
+func TestFixtureServer(t *testing.T) {
+	fixtures := []Fixture{
+		{
+			Request:  FixtureRequest{Method: "POST", URL: "https://api.example.com/items", Body: `{"name": "a", "size": 1}`},
+			Response: FixtureResponse{Status: http.StatusCreated, Headers: http.Header{"Content-Type": {"application/json"}}, Body: `{"id": 1}`},
+		},
+		{
+			Request:  FixtureRequest{Method: "POST", URL: "https://api.example.com/items", Body: `{"name": "b"}`},
+			Response: FixtureResponse{Status: http.StatusConflict},
+		},
+	}
+	srv := NewFixtureServer(fixtures, FixtureMatch{Body: true})
+	defer srv.Close()
+
+	post := func(body string) (*http.Response, string) {
+		resp, err := http.Post(srv.URL+"/items", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	resp, body := post(`{"size":1,"name":"a"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `{"id": 1}`, body)
+	resp, _ = post(`{"name":"b"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, body = post(`{"name":"c"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-Fixture-Miss"))
+	assert.Contains(t, body, "POST")
+}
@@ -0,0 +1,353 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CacheStatusHeader 响应来自本地缓存时的状态：hit、revalidated 或 stale
+const CacheStatusHeader = "X-ReWi-Cache"
+
+// 缓存状态
+const (
+	CacheHit         = "hit"         // 缓存仍然新鲜，没有访问服务器
+	CacheRevalidated = "revalidated" // 服务器返回 304，使用缓存的内容
+	CacheStale       = "stale"       // 服务器不可达，使用过期的缓存
+)
+
+// HTTPCache 以 URL 为键的磁盘缓存，保存 GET 响应及其 ETag/Last-Modified
+//
+// 遵守 Cache-Control 的 max-age、no-cache 与 no-store；没有 max-age 的响应每次都带
+// If-None-Match/If-Modified-Since 重新验证，服务器返回 304 时直接使用缓存的内容。
+type HTTPCache struct {
+	Dir          string // 缓存目录
+	MaxEntrySize int64  // 超过该大小的响应不缓存，避免缓存升级包等大文件
+	StaleIfError bool   // 服务器不可达或返回 5xx 时使用过期的缓存
+
+	now func() time.Time
+}
+
+// NewHTTPCache 在 dir 中创建缓存，单个响应最大 8MB
+func NewHTTPCache(dir string) *HTTPCache {
+	return &HTTPCache{Dir: dir, MaxEntrySize: 8 << 20, now: time.Now}
+}
+
+// DefaultHTTPCacheDir 用户缓存目录下的 upgradeReWi/http
+func DefaultHTTPCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "upgradeReWi", "http"), nil
+}
+
+// cacheEntry 缓存的响应头，响应体保存在同名的 .body 文件中
+type cacheEntry struct {
+	URL      string      `json:"url"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+func (c *HTTPCache) paths(rawURL string) (meta, body string) {
+	sum := sha256.Sum256([]byte(rawURL))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.Dir, key+".json"), filepath.Join(c.Dir, key+".body")
+}
+
+func (c *HTTPCache) load(rawURL string) *cacheEntry {
+	metaPath, bodyPath := c.paths(rawURL)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if json.Unmarshal(data, &entry) != nil || entry.URL != rawURL {
+		return nil
+	}
+	if _, err := os.Stat(bodyPath); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+func (c *HTTPCache) saveEntry(entry *cacheEntry) error {
+	metaPath, _ := c.paths(entry.URL)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp := metaPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, metaPath)
+}
+
+// cacheDirectives 解析 Cache-Control
+func cacheDirectives(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// age 缓存的时长
+func (c *HTTPCache) age(entry *cacheEntry) time.Duration {
+	age := c.now().Sub(entry.StoredAt)
+	if age < 0 {
+		return 0
+	}
+	return age
+}
+
+// fresh 缓存是否仍可不经验证直接使用：max-age 优先，其次 Expires
+func (c *HTTPCache) fresh(entry *cacheEntry) bool {
+	directives := cacheDirectives(entry.Header)
+	if _, ok := directives["no-cache"]; ok {
+		return false
+	}
+	if value, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(value)
+		return err == nil && c.age(entry) < time.Duration(seconds)*time.Second
+	}
+	if expires, err := http.ParseTime(entry.Header.Get("Expires")); err == nil {
+		return c.now().Before(expires)
+	}
+	return false
+}
+
+// response 用缓存的内容构造响应
+func (c *HTTPCache) response(req *http.Request, entry *cacheEntry, status string) (*http.Response, error) {
+	_, bodyPath := c.paths(entry.URL)
+	file, err := os.Open(bodyPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	header := entry.Header.Clone()
+	header.Set(CacheStatusHeader, status)
+	header.Set("Age", strconv.Itoa(int(c.age(entry).Seconds())))
+	if status == CacheStale {
+		header.Add("Warning", `110 - "Response is Stale"`)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          file,
+		ContentLength: info.Size(),
+		Request:       req,
+	}, nil
+}
+
+// cacheable 请求是否可以使用缓存：只缓存不带 Range、条件头与凭据的 GET 请求
+//
+// 缓存以 URL 为键且明文保存，带 Authorization 或 Cookie 的响应不能提供给其他凭据使用。
+func cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" {
+		return false
+	}
+	_, noStore := cacheDirectives(req.Header)["no-store"]
+	return !noStore
+}
+
+// cacheTransport 在重试之外查询与更新 HTTPCache
+type cacheTransport struct {
+	cache  *HTTPCache
+	next   http.RoundTripper
+	logger *zap.Logger
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheable(req) {
+		return t.next.RoundTrip(req)
+	}
+	key := req.URL.String()
+	entry := t.cache.load(key)
+	if entry != nil && t.cache.fresh(entry) {
+		if resp, err := t.cache.response(req, entry, CacheHit); err == nil {
+			return resp, nil
+		}
+	}
+
+	// 已有缓存时发送条件请求
+	try := req
+	if entry != nil {
+		try = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			try.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			try.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(try)
+	if entry != nil && t.cache.StaleIfError && (err != nil || resp.StatusCode >= 500) && req.Context().Err() == nil {
+		if stale, staleErr := t.cache.response(req, entry, CacheStale); staleErr == nil {
+			fields := []zap.Field{zap.String("url", req.URL.Redacted()), zap.Duration("age", t.cache.age(entry).Round(time.Second))}
+			if err != nil {
+				fields = append(fields, zap.Error(err))
+			} else {
+				fields = append(fields, zap.Int("status", resp.StatusCode))
+				resp.Body.Close()
+			}
+			t.logger.Warn("Server unreachable, using cached response", fields...)
+			return stale, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		// 304 可能带有新的 Cache-Control/ETag/Expires
+		for _, name := range []string{"Cache-Control", "ETag", "Expires", "Last-Modified", "Date"} {
+			if values := resp.Header.Values(name); len(values) > 0 {
+				entry.Header[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+		entry.StoredAt = t.cache.now()
+		if err := t.cache.saveEntry(entry); err != nil {
+			t.logger.Warn("Failed to update cache entry", zap.Error(err))
+		}
+		return t.cache.response(req, entry, CacheRevalidated)
+
+	case resp.StatusCode == http.StatusOK:
+		_, noStore := cacheDirectives(resp.Header)["no-store"]
+		if !noStore && resp.ContentLength <= t.cache.MaxEntrySize {
+			resp.Body = t.cache.tee(key, resp, t.logger)
+		}
+	}
+	return resp, nil
+}
+
+// cachingBody 读取响应体的同时写入缓存，完整读完后才写入缓存目录
+type cachingBody struct {
+	io.ReadCloser
+	cache  *HTTPCache
+	entry  *cacheEntry
+	tmp    *os.File
+	length int64 // Content-Length，未知时为 -1
+	n      int64
+	failed bool
+	logger *zap.Logger
+}
+
+// tee 返回写入缓存的响应体；无法创建缓存文件时返回原响应体
+func (c *HTTPCache) tee(key string, resp *http.Response, logger *zap.Logger) io.ReadCloser {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		logger.Warn("Failed to create cache dir", zap.Error(err))
+		return resp.Body
+	}
+	tmp, err := os.CreateTemp(c.Dir, "body-*.tmp")
+	if err != nil {
+		logger.Warn("Failed to create cache file", zap.Error(err))
+		return resp.Body
+	}
+	header := resp.Header.Clone()
+	for _, name := range []string{"Connection", "Keep-Alive", "Transfer-Encoding", "Set-Cookie", CacheStatusHeader} {
+		header.Del(name)
+	}
+	return &cachingBody{
+		ReadCloser: resp.Body,
+		cache:      c,
+		entry:      &cacheEntry{URL: key, Status: resp.StatusCode, Header: header, StoredAt: c.now()},
+		tmp:        tmp,
+		length:     resp.ContentLength,
+		logger:     logger,
+	}
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.failed {
+		b.n += int64(n)
+		if b.n > b.cache.MaxEntrySize {
+			b.failed = true
+		} else if _, werr := b.tmp.Write(p[:n]); werr != nil {
+			b.failed = true
+		}
+	}
+	if err == io.EOF {
+		b.commit()
+	}
+	return n, err
+}
+
+// commit 响应体完整时把临时文件移入缓存
+func (b *cachingBody) commit() {
+	if b.tmp == nil {
+		return
+	}
+	tmp := b.tmp
+	b.tmp = nil
+	closeErr := tmp.Close()
+	if b.failed || closeErr != nil || (b.length >= 0 && b.n != b.length) {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	_, bodyPath := b.cache.paths(b.entry.URL)
+	err := os.Rename(tmp.Name(), bodyPath)
+	if err == nil {
+		err = b.cache.saveEntry(b.entry)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		b.logger.Warn("Failed to store cache entry", zap.Error(err))
+	}
+}
+
+func (b *cachingBody) Close() error {
+	if b.tmp != nil {
+		// 没有读完的响应不缓存
+		b.tmp.Close()
+		_ = os.Remove(b.tmp.Name())
+		b.tmp = nil
+	}
+	return b.ReadCloser.Close()
+}
+
+// withCache 配置了 Cache 时在 next 外包装一层缓存
+// 认证信息在缓存之后才添加，配置了 Auth 时所有请求都不经过缓存
+func (nm *NetManager) withCache(next http.RoundTripper) http.RoundTripper {
+	if nm.Cache == nil || nm.Auth != nil {
+		return next
+	}
+	if nm.Cache.now == nil {
+		nm.Cache.now = time.Now
+	}
+	return &cacheTransport{cache: nm.Cache, next: next, logger: nm.Logger}
+}
@@ -0,0 +1,151 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPCache(t *testing.T) {
+	old := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = old }()
+
+	// versionServer 支持 If-None-Match，cacheControl 为响应的 Cache-Control
+	versionServer := func(t *testing.T, cacheControl string) (*httptest.Server, *int32, *int32) {
+		var requests, notModified int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("ETag", `"v1"`)
+			if cacheControl != "" {
+				w.Header().Set("Cache-Control", cacheControl)
+			}
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte("v1.2.0\n"))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &requests, &notModified
+	}
+	newManager := func(t *testing.T, url string) *NetManager {
+		nm := newTestNetManager(url)
+		nm.Cache = NewHTTPCache(t.TempDir())
+		return nm
+	}
+
+	t.Run("条件请求与 304", func(t *testing.T) {
+		srv, requests, notModified := versionServer(t, "")
+		nm := newManager(t, srv.URL+"/version.txt")
+
+		got, err := nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v1.2.0", got)
+		assert.Empty(t, nm.RespCache)
+
+		got, err = nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v1.2.0", got)
+		assert.Equal(t, CacheRevalidated, nm.RespCache)
+		assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+		assert.Equal(t, int32(1), atomic.LoadInt32(notModified))
+	})
+
+	t.Run("max-age 内不请求服务器", func(t *testing.T) {
+		srv, requests, _ := versionServer(t, "max-age=60")
+		nm := newManager(t, srv.URL+"/version.txt")
+
+		for i := 0; i < 3; i++ {
+			got, err := nm.GetRemoteVersion(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "v1.2.0", got)
+		}
+		assert.Equal(t, CacheHit, nm.RespCache)
+		assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+		// 过期后重新验证
+		nm.Cache.now = func() time.Time { return time.Now().Add(time.Minute) }
+		_, err := nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, CacheRevalidated, nm.RespCache)
+		assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+	})
+
+	t.Run("no-store 不缓存", func(t *testing.T) {
+		srv, requests, notModified := versionServer(t, "no-store")
+		nm := newManager(t, srv.URL+"/version.txt")
+		for i := 0; i < 2; i++ {
+			_, err := nm.GetRemoteVersion(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, nm.RespCache)
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+		assert.Equal(t, int32(0), atomic.LoadInt32(notModified))
+	})
+
+	t.Run("离线时使用过期缓存", func(t *testing.T) {
+		srv, _, _ := versionServer(t, "")
+		nm := newManager(t, srv.URL+"/version.txt")
+		nm.Retries = 1
+		_, err := nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+
+		srv.Close()
+		_, err = nm.GetRemoteVersion(context.Background())
+		require.Error(t, err)
+
+		nm.Cache.StaleIfError = true
+		nm.Cache.now = func() time.Time { return time.Now().Add(time.Hour) }
+		got, err := nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v1.2.0", got)
+		assert.Equal(t, CacheStale, nm.RespCache)
+		assert.GreaterOrEqual(t, nm.RespAge, 59*time.Minute)
+	})
+
+	t.Run("带凭据的请求不缓存", func(t *testing.T) {
+		srv, requests, notModified := versionServer(t, "max-age=60")
+		nm := newManager(t, srv.URL+"/version.txt")
+		nm.Auth = &TokenAuth{Token: "secret"}
+		for i := 0; i < 2; i++ {
+			_, err := nm.GetRemoteVersion(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, nm.RespCache)
+		}
+
+		nm.Auth = nil
+		nm.ReqHeaders = []string{"Authorization: Bearer other"}
+		_, err := nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, nm.RespCache)
+		assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+		assert.Equal(t, int32(0), atomic.LoadInt32(notModified))
+		entries, err := os.ReadDir(nm.Cache.Dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("下载描述文件", func(t *testing.T) {
+		srv, _, notModified := versionServer(t, "")
+		nm := newManager(t, srv.URL+"/description.json")
+		dir := t.TempDir()
+		for i := 0; i < 2; i++ {
+			dest := filepath.Join(dir, "description.json")
+			require.NoError(t, nm.DownloadFile(dest))
+			data, err := os.ReadFile(dest)
+			require.NoError(t, err)
+			assert.Equal(t, "v1.2.0\n", string(data))
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(notModified))
+	})
+}
@@ -0,0 +1,404 @@
+package helpers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Re-Wi/GoKitReWi/handlers"
+)
+
+// ManifestFile 项目目录下的版本清单文件名，与 version.txt 放在一起
+const ManifestFile = "manifest.json"
+
+// ErrNoManifest 服务器上没有 manifest.json，调用方应回退到 version.txt
+var ErrNoManifest = errors.New("manifest not found")
+
+// Manifest 项目的版本清单
+type Manifest struct {
+	Project          string            `json:"project"`
+	Channels         map[string]string `json:"channels"`                     // 通道 -> 该通道的最新版本，更早的版本同样属于该通道
+	MinClientVersion string            `json:"min_client_version,omitempty"` // 读取该清单所需的最低 upgradeReWi 版本
+	Releases         []Release         `json:"releases"`                     // 按版本从新到旧排列
+	GeneratedAt      time.Time         `json:"generated_at"`
+}
+
+// Release 一个发布版本
+type Release struct {
+	Version     string           `json:"version"`
+	PublishedAt time.Time        `json:"published_at"`
+	Notes       string           `json:"notes,omitempty"`
+	Rollout     map[string]int   `json:"rollout,omitempty"` // 通道 -> 灰度百分比，未列出的通道为 100
+	Packages    []ReleasePackage `json:"packages"`
+}
+
+// ReleasePackage 升级到某个版本的一个升级包
+type ReleasePackage struct {
+	URL         string `json:"url"`                    // 相对于清单的地址或绝对地址
+	BaseVersion string `json:"base_version,omitempty"` // 增量包适用的已安装版本，为空表示完整包
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	MD5         string `json:"md5"`
+}
+
+// Full 是否为不依赖已安装版本的完整包
+func (p ReleasePackage) Full() bool {
+	return p.BaseVersion == ""
+}
+
+// ResolveURL 以清单地址为基准解析升级包地址
+func (p ReleasePackage) ResolveURL(manifestURL string) (string, error) {
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid manifest URL: %w", err)
+	}
+	ref, err := url.Parse(p.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid package URL %q: %w", p.URL, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// ParseManifest 解析并校验清单
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	for _, r := range m.Releases {
+		if r.Version == "" {
+			return nil, fmt.Errorf("manifest release without version")
+		}
+	}
+	for channel, version := range m.Channels {
+		if m.Release(version) == nil {
+			return nil, fmt.Errorf("channel %s points to unknown version %s", channel, version)
+		}
+	}
+	sortReleases(m.Releases)
+	return &m, nil
+}
+
+// LoadManifest 读取本地清单文件，文件不存在时返回 ErrNoManifest
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoManifest
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// SaveManifest 写入清单，先写临时文件再重命名，客户端不会读到写了一半的清单
+func SaveManifest(path string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Release 返回指定版本，不存在时返回 nil
+func (m *Manifest) Release(version string) *Release {
+	for i := range m.Releases {
+		if m.Releases[i].Version == version {
+			return &m.Releases[i]
+		}
+	}
+	return nil
+}
+
+// Latest 返回通道的最新版本，通道不存在时返回错误
+func (m *Manifest) Latest(channel string) (*Release, error) {
+	if channel == "" {
+		channel = ChannelStable
+	}
+	version, ok := m.Channels[channel]
+	if !ok {
+		return nil, fmt.Errorf("channel %q not found in manifest", channel)
+	}
+	release := m.Release(version)
+	if release == nil {
+		return nil, fmt.Errorf("channel %s points to unknown version %s", channel, version)
+	}
+	return release, nil
+}
+
+// UpgradeStep 升级路径中的一步
+type UpgradeStep struct {
+	From    string // 为空表示安装完整包
+	To      string
+	Package ReleasePackage
+}
+
+// UpgradePath 返回从已安装版本 from 升级到 to 下载量最小的升级包序列
+//
+// 增量包只能用于其 BaseVersion，完整包可用于任何版本；from 为空（尚未安装）时只能使用完整包起步。
+func (m *Manifest) UpgradePath(from, to string) ([]UpgradeStep, error) {
+	if m.Release(to) == nil {
+		return nil, fmt.Errorf("version %s not found in manifest", to)
+	}
+	if from == to {
+		return nil, nil
+	}
+
+	// 以版本为节点、升级包大小为边权的最短路径，清单中的版本数很少，直接 O(n^2) 选点
+	const start = ""
+	dist := map[string]int64{start: 0}
+	prev := make(map[string]UpgradeStep)
+	done := make(map[string]bool)
+	if from != "" {
+		delete(dist, start)
+		dist[from] = 0
+	}
+	for {
+		current, best := "", int64(-1)
+		for version, d := range dist {
+			if !done[version] && (best < 0 || d < best) {
+				current, best = version, d
+			}
+		}
+		if best < 0 {
+			return nil, fmt.Errorf("no upgrade path from %s to %s", displayVersion(from), to)
+		}
+		if current == to {
+			break
+		}
+		done[current] = true
+		for _, r := range m.Releases {
+			for _, p := range r.Packages {
+				if !p.Full() && p.BaseVersion != current {
+					continue
+				}
+				if r.Version == current {
+					continue
+				}
+				if d, ok := dist[r.Version]; !ok || best+p.Size < d {
+					dist[r.Version] = best + p.Size
+					prev[r.Version] = UpgradeStep{From: current, To: r.Version, Package: p}
+				}
+			}
+		}
+	}
+
+	var path []UpgradeStep
+	for version := to; version != from && version != start; {
+		step := prev[version]
+		path = append([]UpgradeStep{step}, path...)
+		version = step.From
+	}
+	return path, nil
+}
+
+func displayVersion(version string) string {
+	if version == "" {
+		return "a fresh install"
+	}
+	return version
+}
+
+// FetchManifest 下载项目的 manifest.json，服务器返回 404 时返回 ErrNoManifest
+// 成功后 nm.ReqURL 为清单地址，可用于解析升级包的相对地址
+func (nm *NetManager) FetchManifest(ctx context.Context, platform, dependency, project string) (*Manifest, error) {
+	if err := nm.BuildReqURL(platform, dependency, project, ManifestFile); err != nil {
+		return nil, err
+	}
+	body, err := nm.GetRemoteVersion(ctx)
+	if err != nil {
+		if nm.RespCode == http.StatusNotFound {
+			return nil, ErrNoManifest
+		}
+		return nil, err
+	}
+	return ParseManifest([]byte(body))
+}
+
+// ManifestOptions 生成清单的参数
+type ManifestOptions struct {
+	Project          string
+	Channel          string // 指向最新版本的通道，默认 stable
+	MinClientVersion string // 为空时保留原清单中的值
+	Notes            string // 最新版本的发布说明，为空时使用 package.json 中的 description
+	Rollout          int    // 最新版本新加入 Channel 时的灰度百分比，0 表示 100
+}
+
+// GenerateManifest 扫描项目目录中的 *.tar.gz 升级包生成清单
+//
+// 版本号与基准版本取自包内的 package.json，没有时以文件名为版本号并视为完整包。
+// 已有 manifest.json 时保留其中的通道、灰度、发布时间与发布说明，Channel 通道更新为最新版本。
+func GenerateManifest(dir string, opts ManifestOptions) (*Manifest, error) {
+	old, err := LoadManifest(filepath.Join(dir, ManifestFile))
+	if err != nil && !errors.Is(err, ErrNoManifest) {
+		return nil, err
+	}
+	if old == nil {
+		old = &Manifest{}
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.tar.gz"))
+	if err != nil {
+		return nil, err
+	}
+	releases := make(map[string]*Release)
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		pkg, err := readPackageInfo(name)
+		if err != nil {
+			return nil, err
+		}
+		version := strings.TrimSuffix(filepath.Base(name), ".tar.gz")
+		if pkg != nil && pkg.Version != "" {
+			version = pkg.Version
+		}
+
+		entry := ReleasePackage{URL: url.PathEscape(filepath.Base(name)), Size: info.Size()}
+		if pkg != nil {
+			entry.BaseVersion = pkg.BaseVersion
+		}
+
+		// 发布时间与说明优先取自完整包
+		release, ok := releases[version]
+		if !ok || entry.Full() {
+			if !ok {
+				release = &Release{Version: version}
+				releases[version] = release
+			}
+			release.PublishedAt = info.ModTime().UTC()
+			if pkg != nil {
+				if t, err := time.ParseInLocation("2006-01-02 15:04:05", pkg.Timestamp, time.Local); err == nil {
+					release.PublishedAt = t.UTC()
+				}
+				release.Notes = pkg.Description
+			}
+			if prior := old.Release(version); prior != nil {
+				release.PublishedAt, release.Notes, release.Rollout = prior.PublishedAt, prior.Notes, prior.Rollout
+			}
+		}
+		if entry.SHA256, entry.MD5, err = fileDigests(name); err != nil {
+			return nil, err
+		}
+		release.Packages = append(release.Packages, entry)
+	}
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("no *.tar.gz packages in %s", dir)
+	}
+
+	m := &Manifest{
+		Project:          opts.Project,
+		Channels:         make(map[string]string),
+		MinClientVersion: old.MinClientVersion,
+		GeneratedAt:      time.Now().UTC(),
+	}
+	if m.Project == "" {
+		m.Project = old.Project
+	}
+	if opts.MinClientVersion != "" {
+		m.MinClientVersion = opts.MinClientVersion
+	}
+	for _, r := range releases {
+		sort.Slice(r.Packages, func(i, j int) bool { return r.Packages[i].BaseVersion < r.Packages[j].BaseVersion })
+		m.Releases = append(m.Releases, *r)
+	}
+	sortReleases(m.Releases)
+
+	latest := &m.Releases[0]
+	if opts.Notes != "" {
+		latest.Notes = opts.Notes
+	}
+	for channel, version := range old.Channels {
+		if m.Release(version) != nil {
+			m.Channels[channel] = version
+		}
+	}
+	channel := opts.Channel
+	if channel == "" {
+		channel = ChannelStable
+	}
+	if m.Channels[channel] != latest.Version && opts.Rollout > 0 {
+		if err := m.Promote(channel, latest.Version, opts.Rollout); err != nil {
+			return nil, err
+		}
+	}
+	m.Channels[channel] = latest.Version
+	return m, nil
+}
+
+// sortReleases 按版本从新到旧排序，无法比较的版本号按发布时间排序
+func sortReleases(releases []Release) {
+	sort.SliceStable(releases, func(i, j int) bool {
+		if c, err := CompareVersions(releases[i].Version, releases[j].Version); err == nil {
+			return c > 0
+		}
+		return releases[i].PublishedAt.After(releases[j].PublishedAt)
+	})
+}
+
+// readPackageInfo 读取升级包中的 package.json，没有时返回 nil
+func readPackageInfo(tarPath string) (*handlers.UpdatePackage, error) {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", tarPath, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", tarPath, err)
+		}
+		if payloadKey(header.Name) != "package.json" {
+			continue
+		}
+		var pkg handlers.UpdatePackage
+		if err := json.NewDecoder(tr).Decode(&pkg); err != nil {
+			return nil, fmt.Errorf("parse package.json in %s: %w", tarPath, err)
+		}
+		return &pkg, nil
+	}
+}
+
+// fileDigests 一次读取同时计算 SHA-256 与 MD5
+func fileDigests(path string) (sha, md string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	s, m := sha256.New(), md5.New()
+	if _, err := io.Copy(io.MultiWriter(s, m), file); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(s.Sum(nil)), hex.EncodeToString(m.Sum(nil)), nil
+}
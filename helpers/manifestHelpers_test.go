@@ -0,0 +1,144 @@
+package helpers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Re-Wi/GoKitReWi/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestPackage 写入只包含 package.json 与一段填充数据的升级包
+func writeTestPackage(t *testing.T, path string, pkg handlers.UpdatePackage, padding int) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	data, err := json.Marshal(pkg)
+	require.NoError(t, err)
+	for name, content := range map[string][]byte{"package.json": data, "payload": make([]byte, padding)} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err = tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+}
+
+func TestGenerateManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPackage(t, filepath.Join(dir, "v1.1.0.tar.gz"), handlers.UpdatePackage{Version: "v1.1.0", Description: "first", Timestamp: "2026-01-01 08:00:00"}, 0)
+	writeTestPackage(t, filepath.Join(dir, "v1.2.0.tar.gz"), handlers.UpdatePackage{Version: "v1.2.0", Description: "second"}, 0)
+	writeTestPackage(t, filepath.Join(dir, "v1.2.0-from-v1.1.0.tar.gz"), handlers.UpdatePackage{Version: "v1.2.0", BaseVersion: "v1.1.0", Description: "delta"}, 0)
+
+	m, err := GenerateManifest(dir, ManifestOptions{Project: "app", MinClientVersion: "v1.0.0"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{ChannelStable: "v1.2.0"}, m.Channels)
+	assert.Equal(t, "v1.0.0", m.MinClientVersion)
+	require.Len(t, m.Releases, 2)
+	assert.Equal(t, "v1.2.0", m.Releases[0].Version)
+	assert.Equal(t, "second", m.Releases[0].Notes, "notes come from the full package")
+	require.Len(t, m.Releases[0].Packages, 2)
+	assert.True(t, m.Releases[0].Packages[0].Full())
+	assert.Equal(t, "v1.1.0", m.Releases[0].Packages[1].BaseVersion)
+	assert.Len(t, m.Releases[0].Packages[0].SHA256, 64)
+	assert.Len(t, m.Releases[0].Packages[0].MD5, 32)
+	assert.Equal(t, 2026, m.Releases[1].PublishedAt.Year())
+
+	// 重新生成时保留发布说明与其他通道
+	m.Releases[1].Notes = "edited"
+	m.Channels["beta"] = "v1.1.0"
+	require.NoError(t, SaveManifest(filepath.Join(dir, ManifestFile), m))
+	writeTestPackage(t, filepath.Join(dir, "v1.3.0.tar.gz"), handlers.UpdatePackage{Version: "v1.3.0"}, 0)
+	m, err = GenerateManifest(dir, ManifestOptions{Channel: "beta"})
+	require.NoError(t, err)
+	assert.Equal(t, "app", m.Project)
+	assert.Equal(t, "v1.0.0", m.MinClientVersion)
+	assert.Equal(t, map[string]string{ChannelStable: "v1.2.0", "beta": "v1.3.0"}, m.Channels)
+	assert.Equal(t, "edited", m.Release("v1.1.0").Notes)
+}
+
+func TestManifestUpgradePath(t *testing.T) {
+	m := &Manifest{
+		Channels: map[string]string{ChannelStable: "v1.3.0"},
+		Releases: []Release{
+			{Version: "v1.3.0", Packages: []ReleasePackage{{URL: "v1.3.0.tar.gz", Size: 1000}, {URL: "d13.tar.gz", BaseVersion: "v1.2.0", Size: 100}}},
+			{Version: "v1.2.0", Packages: []ReleasePackage{{URL: "v1.2.0.tar.gz", Size: 900}, {URL: "d12.tar.gz", BaseVersion: "v1.1.0", Size: 100}}},
+			{Version: "v1.1.0", Packages: []ReleasePackage{{URL: "v1.1.0.tar.gz", Size: 800}}},
+		},
+	}
+
+	path, err := m.UpgradePath("v1.1.0", "v1.3.0")
+	require.NoError(t, err)
+	require.Len(t, path, 2)
+	assert.Equal(t, "d12.tar.gz", path[0].Package.URL)
+	assert.Equal(t, "d13.tar.gz", path[1].Package.URL)
+
+	// 没有适用增量包的版本直接使用完整包
+	path, err = m.UpgradePath("v1.0.0", "v1.3.0")
+	require.NoError(t, err)
+	require.Len(t, path, 1)
+	assert.Equal(t, "v1.3.0.tar.gz", path[0].Package.URL)
+
+	path, err = m.UpgradePath("", "v1.2.0")
+	require.NoError(t, err)
+	require.Len(t, path, 1)
+	assert.Equal(t, "", path[0].From)
+
+	path, err = m.UpgradePath("v1.3.0", "v1.3.0")
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	_, err = m.UpgradePath("v1.1.0", "v2.0.0")
+	assert.Error(t, err)
+
+	u, err := m.Releases[0].Packages[1].ResolveURL("https://updates.example.com/linux/go/app/manifest.json")
+	require.NoError(t, err)
+	assert.Equal(t, "https://updates.example.com/linux/go/app/d13.tar.gz", u)
+}
+
+func TestFetchManifest(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "linux", "go", "app")
+	require.NoError(t, os.MkdirAll(project, 0755))
+	srv := httptest.NewServer(NewUpdateServer(root, nil))
+	defer srv.Close()
+
+	nm := NewNetManager()
+	nm.BaseURL = srv.URL
+	_, err := nm.FetchManifest(context.Background(), "linux", "go", "app")
+	assert.ErrorIs(t, err, ErrNoManifest)
+
+	writeTestPackage(t, filepath.Join(project, "v1.0.0.tar.gz"), handlers.UpdatePackage{Version: "v1.0.0"}, 10)
+	m, err := GenerateManifest(project, ManifestOptions{Project: "app"})
+	require.NoError(t, err)
+	require.NoError(t, SaveManifest(filepath.Join(project, ManifestFile), m))
+
+	got, err := nm.FetchManifest(context.Background(), "linux", "go", "app")
+	require.NoError(t, err)
+	release, err := got.Latest("")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0", release.Version)
+	assert.Equal(t, srv.URL+"/linux/go/app/manifest.json", nm.ReqURL)
+
+	_, err = ParseManifest([]byte(`{"channels":{"stable":"v9.9.9"},"releases":[]}`))
+	assert.Error(t, err)
+}
+
+func TestSortReleases(t *testing.T) {
+	releases := []Release{{Version: "v1.0.0-rc2"}, {Version: "v1.0.0"}, {Version: "v1.0.0-rc10"}, {Version: "v0.9.0"}}
+	sortReleases(releases)
+	var versions []string
+	for _, r := range releases {
+		versions = append(versions, r.Version)
+	}
+	assert.Equal(t, []string{"v1.0.0", "v1.0.0-rc10", "v1.0.0-rc2", "v0.9.0"}, versions)
+}
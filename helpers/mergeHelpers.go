@@ -0,0 +1,584 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Re-Wi/GoKitReWi/handlers"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置文件合并策略
+const (
+	MergeThreeWay = "three-way" // 按键三方合并（基准、本地、新版本）
+
+	MergeOnConflictFail    = "fail"    // 同一键两边都修改时终止升级
+	MergeOnConflictMarkers = "markers" // 在配置文件中写入冲突标记，需手动编辑后才能使用
+)
+
+// MergeConflict 一个两边都修改过的键
+type MergeConflict struct {
+	Key      string      // 以 "." 连接的键路径
+	Base     interface{} // 基准值，不存在时为 nil
+	Local    interface{} // 本地值
+	Upstream interface{} // 新版本值
+}
+
+// MergeFormat 根据文件扩展名判断可合并的格式，不支持时返回空字符串
+func MergeFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return ""
+}
+
+// MergeConfig 对 JSON/YAML 配置做按键三方合并
+//
+// 上游未修改的键保留本地值，本地未修改的键采用新版本的值，
+// 两边修改为不同值的键记为冲突，合并结果中保留本地值。
+// 合并在本地文档上进行：保留本地的键顺序和 YAML 注释，新增的键插在新版本中前一个键之后；
+// 没有需要采用的上游修改时原样返回本地文件内容。
+func MergeConfig(format string, base, local, upstream []byte) ([]byte, []MergeConflict, error) {
+	var docs [3]*yaml.Node
+	for i, data := range [][]byte{base, local, upstream} {
+		doc, err := decodeConfig(format, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse %s: %w", [...]string{"base", "local", "upstream"}[i], err)
+		}
+		docs[i] = doc
+	}
+
+	var m configMerge
+	merged, changed := m.mergeNode("", docs[0], docs[1], docs[2])
+	if !changed {
+		return local, m.conflicts, nil
+	}
+
+	out, err := encodeConfig(format, merged, local)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, m.conflicts, nil
+}
+
+// MergeConfigWithMarkers 合并配置，冲突处以 git 风格的冲突标记同时给出本地值和新版本的值
+// 没有冲突时与 MergeConfig 相同；有冲突时输出的文件需要手动编辑后才能解析
+func MergeConfigWithMarkers(format string, base, local, upstream []byte) ([]byte, []MergeConflict, error) {
+	merged, conflicts, err := MergeConfig(format, base, local, upstream)
+	if err != nil || len(conflicts) == 0 {
+		return merged, conflicts, err
+	}
+
+	var sides [2][]byte
+	for i, preferUpstream := range []bool{false, true} {
+		var docs [3]*yaml.Node
+		for j, data := range [][]byte{base, local, upstream} {
+			if docs[j], err = decodeConfig(format, data); err != nil {
+				return nil, nil, err
+			}
+		}
+		m := configMerge{preferUpstream: preferUpstream}
+		doc, _ := m.mergeNode("", docs[0], docs[1], docs[2])
+		if sides[i], err = encodeConfig(format, doc, local); err != nil {
+			return nil, nil, err
+		}
+	}
+	return markConflicts(sides[0], sides[1]), conflicts, nil
+}
+
+// markConflicts 按行比较两边的输出，不同的行段用冲突标记包围
+func markConflicts(ours, theirs []byte) []byte {
+	a := strings.SplitAfter(string(ours), "\n")
+	b := strings.SplitAfter(string(theirs), "\n")
+
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共行数
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	var hunkA, hunkB []string
+	flush := func() {
+		if len(hunkA) == 0 && len(hunkB) == 0 {
+			return
+		}
+		buf.WriteString("<<<<<<< local\n")
+		buf.WriteString(strings.Join(hunkA, ""))
+		buf.WriteString("=======\n")
+		buf.WriteString(strings.Join(hunkB, ""))
+		buf.WriteString(">>>>>>> upstream\n")
+		hunkA, hunkB = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			buf.WriteString(a[i])
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			hunkA = append(hunkA, a[i])
+			i++
+		default:
+			hunkB = append(hunkB, b[j])
+			j++
+		}
+	}
+	flush()
+	return buf.Bytes()
+}
+
+// decodeConfig 解析为 yaml.Node，空文件视为空对象
+func decodeConfig(format string, data []byte) (*yaml.Node, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		node, err := decodeJSONNode(dec)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return nil, fmt.Errorf("unexpected data after top-level value")
+		}
+		return node, nil
+	case "yaml":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if doc.Kind == 0 {
+			return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+		}
+		return &doc, nil
+	}
+	return nil, fmt.Errorf("unsupported merge format %q", format)
+}
+
+// decodeJSONNode 按原始顺序读取一个 JSON 值
+// 数字保留原始写法，避免大整数转为 float64 丢失精度
+func decodeJSONNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if v == '{' {
+			node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		}
+		for dec.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			child, err := decodeJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(string(v), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(v)}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(v)}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+// encodeConfig 输出合并结果，沿用本地文件的缩进
+func encodeConfig(format string, doc *yaml.Node, local []byte) ([]byte, error) {
+	indent := detectIndent(local)
+	switch format {
+	case "json":
+		if indent == "" {
+			indent = "    "
+		}
+		var buf bytes.Buffer
+		if err := encodeJSONNode(&buf, doc, indent, ""); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	case "yaml":
+		spaces := len(strings.Trim(indent, "\t"))
+		if spaces < 2 || spaces > 8 {
+			spaces = 2
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(spaces)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported merge format %q", format)
+}
+
+// detectIndent 取第一处缩进作为文件的缩进单位
+func detectIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		return line[:len(line)-len(trimmed)]
+	}
+	return ""
+}
+
+func encodeJSONNode(buf *bytes.Buffer, n *yaml.Node, indent, prefix string) error {
+	n = resolveNode(n)
+	switch n.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "[", "]", 1
+		if n.Kind == yaml.MappingNode {
+			open, close, step = "{", "}", 2
+		}
+		if len(n.Content) == 0 {
+			buf.WriteString(open + close)
+			return nil
+		}
+		buf.WriteString(open + "\n")
+		for i := 0; i < len(n.Content); i += step {
+			buf.WriteString(prefix + indent)
+			if step == 2 {
+				writeJSONString(buf, n.Content[i].Value)
+				buf.WriteString(": ")
+			}
+			if err := encodeJSONNode(buf, n.Content[i+step-1], indent, prefix+indent); err != nil {
+				return err
+			}
+			if i+step < len(n.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(prefix + close)
+	case yaml.ScalarNode:
+		switch n.ShortTag() {
+		case "!!int", "!!float", "!!bool", "!!null":
+			buf.WriteString(n.Value)
+		default:
+			writeJSONString(buf, n.Value)
+		}
+	default:
+		return fmt.Errorf("unsupported JSON node kind %v", n.Kind)
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // 去掉 Encode 追加的换行
+}
+
+// resolveNode 跳过文档节点和别名，得到实际的值节点
+func resolveNode(n *yaml.Node) *yaml.Node {
+	for n != nil {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			if len(n.Content) == 0 {
+				return nil
+			}
+			n = n.Content[0]
+		case yaml.AliasNode:
+			n = n.Alias
+		default:
+			return n
+		}
+	}
+	return nil
+}
+
+// nodeEqual 比较两个值是否相同，忽略对象的键顺序、注释和书写风格
+func nodeEqual(a, b *yaml.Node) bool {
+	a, b = resolveNode(a), resolveNode(b)
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Kind != b.Kind {
+		return false
+	}
+	switch a.Kind {
+	case yaml.ScalarNode:
+		return a.ShortTag() == b.ShortTag() && a.Value == b.Value
+	case yaml.MappingNode:
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+		for i := 0; i < len(a.Content); i += 2 {
+			if !nodeEqual(a.Content[i+1], mappingValue(b, a.Content[i].Value)) {
+				return false
+			}
+		}
+		return true
+	case yaml.SequenceNode:
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+		for i := range a.Content {
+			if !nodeEqual(a.Content[i], b.Content[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// mappingValue 返回对象中键对应的值节点，不存在时返回 nil
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m = resolveNode(m); m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// configMerge 记录一次合并的冲突；preferUpstream 时冲突处取新版本的值，用于生成冲突标记
+type configMerge struct {
+	conflicts      []MergeConflict
+	preferUpstream bool
+}
+
+// mergeNode 合并一个值，nil 表示键不存在；changed 表示结果采用了上游的修改
+func (m *configMerge) mergeNode(key string, base, local, upstream *yaml.Node) (merged *yaml.Node, changed bool) {
+	switch {
+	case nodeEqual(local, upstream):
+		return local, false
+	case nodeEqual(base, local):
+		return upstream, true
+	case nodeEqual(base, upstream):
+		return local, false
+	}
+
+	// 两边都修改了同一个对象，逐键合并
+	localMap, upstreamMap := resolveNode(local), resolveNode(upstream)
+	if localMap != nil && upstreamMap != nil && localMap.Kind == yaml.MappingNode && upstreamMap.Kind == yaml.MappingNode {
+		return m.mergeMapping(key, resolveNode(base), localMap, upstreamMap, local)
+	}
+
+	if key == "" {
+		key = "(root)"
+	}
+	m.conflicts = append(m.conflicts, MergeConflict{
+		Key:      key,
+		Base:     nodeValue(base),
+		Local:    nodeValue(local),
+		Upstream: nodeValue(upstream),
+	})
+	if m.preferUpstream {
+		return upstream, true
+	}
+	return local, false
+}
+
+// mergeMapping 在本地对象的副本上逐键合并，保留本地键顺序与注释
+func (m *configMerge) mergeMapping(key string, base, local, upstream, localDoc *yaml.Node) (*yaml.Node, bool) {
+	result := *local
+	result.Content = nil
+	changed := false
+	for i := 0; i+1 < len(local.Content); i += 2 {
+		k := local.Content[i].Value
+		v, ch := m.mergeNode(joinKey(key, k), mappingValue(base, k), local.Content[i+1], mappingValue(upstream, k))
+		changed = changed || ch
+		if v != nil {
+			result.Content = append(result.Content, local.Content[i], v)
+		}
+	}
+
+	// 只在新版本中存在的键，插在新版本中前一个仍保留的键之后
+	after := ""
+	for i := 0; i+1 < len(upstream.Content); i += 2 {
+		k := upstream.Content[i].Value
+		if mappingValue(local, k) != nil {
+			after = k
+			continue
+		}
+		v, ch := m.mergeNode(joinKey(key, k), mappingValue(base, k), nil, upstream.Content[i+1])
+		if v == nil {
+			continue
+		}
+		changed = changed || ch
+		pos := 0
+		for j := 0; j+1 < len(result.Content); j += 2 {
+			if result.Content[j].Value == after {
+				pos = j + 2
+				break
+			}
+		}
+		content := append([]*yaml.Node{}, result.Content[:pos]...)
+		content = append(content, upstream.Content[i], v)
+		result.Content = append(content, result.Content[pos:]...)
+		after = k
+	}
+
+	if localDoc.Kind == yaml.DocumentNode {
+		doc := *localDoc
+		doc.Content = []*yaml.Node{&result}
+		return &doc, changed
+	}
+	return &result, changed
+}
+
+// nodeValue 将节点转换为普通值用于报告，键不存在时返回 nil
+func nodeValue(n *yaml.Node) interface{} {
+	if n = resolveNode(n); n == nil {
+		return nil
+	}
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return n.Value
+	}
+	return v
+}
+
+func joinKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// ProcessMerged 处理标记为三方合并的配置文件
+// 本地未修改时直接应用补丁；否则以升级包中的基准副本、本地文件和新版本按键合并
+func (pa *PatchApp) ProcessMerged(file handlers.FileEntry) error {
+	if file.Merge != MergeThreeWay {
+		return fmt.Errorf("unknown merge strategy %q", file.Merge)
+	}
+	format := MergeFormat(file.Path)
+	if format == "" {
+		return fmt.Errorf("three-way merge supports only JSON and YAML files")
+	}
+
+	installed := filepath.Join(pa.TargetDir, file.Path)
+	staged := filepath.Join(pa.NewTempDir, file.Path)
+
+	hash, err := localHash(installed)
+	if err != nil {
+		return err
+	}
+	if hash == file.BaseHash {
+		return pa.ProcessModified(file)
+	}
+	if file.Base == nil {
+		return fmt.Errorf("package has no base copy to merge with")
+	}
+
+	basePath := filepath.Join(pa.PatchTempDir, file.Base.Path)
+	if err := VerifyFileHash(basePath, file.Base.Hash, md5.New); err != nil {
+		return fmt.Errorf("verify base copy: %w", err)
+	}
+
+	// 由基准副本生成新版本内容
+	upstreamPath := staged + ".upstream"
+	defer os.Remove(upstreamPath)
+	if err := pa.applyPatch(file, basePath, upstreamPath); err != nil {
+		return err
+	}
+
+	// 本地已删除该文件时没有可保留的修改，直接使用新版本
+	if hash == "" {
+		return os.Rename(upstreamPath, staged)
+	}
+
+	var contents [3][]byte
+	for i, p := range []string{basePath, installed, upstreamPath} {
+		if contents[i], err = os.ReadFile(p); err != nil {
+			return err
+		}
+	}
+	merge := MergeConfig
+	if pa.MergeConflict == MergeOnConflictMarkers {
+		merge = MergeConfigWithMarkers
+	}
+	merged, conflicts, err := merge(format, contents[0], contents[1], contents[2])
+	if err != nil {
+		return err
+	}
+
+	record := Conflict{
+		Path:         file.Path,
+		Status:       file.Status,
+		Policy:       MergeThreeWay,
+		LocalHash:    hash,
+		ExpectedHash: file.BaseHash,
+		Action:       "merged local changes",
+	}
+	defer func() {
+		if pa.Conflicts != nil {
+			pa.Conflicts.record(record)
+		}
+	}()
+
+	if len(conflicts) > 0 {
+		keys := make([]string, 0, len(conflicts))
+		for _, c := range conflicts {
+			keys = append(keys, c.Key)
+		}
+		if pa.MergeConflict != MergeOnConflictMarkers {
+			record.Action = "failed: conflicting keys " + strings.Join(keys, ", ")
+			return fmt.Errorf("both local and upstream changed %s", strings.Join(keys, ", "))
+		}
+
+		record.Action = "conflict markers written for " + strings.Join(keys, ", ") + ", edit the file before use"
+		record.Unresolved = true
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(installed); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return os.WriteFile(staged, merged, mode)
+}
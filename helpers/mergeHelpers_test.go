@@ -0,0 +1,197 @@
+package helpers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMergeConfig(t *testing.T) {
+	t.Run("YAML无冲突", func(t *testing.T) {
+		base := []byte("server:\n  port: 80\n  host: localhost\nlog: info\nold: 1\n")
+		local := []byte("server:\n  port: 8080\n  host: localhost\nlog: info\nold: 1\ncustom: true\n")
+		upstream := []byte("server:\n  port: 80\n  host: 0.0.0.0\n  tls: false\nlog: info\n")
+
+		merged, conflicts, err := MergeConfig("yaml", base, local, upstream)
+		require.NoError(t, err)
+		assert.Empty(t, conflicts)
+
+		var doc map[string]interface{}
+		require.NoError(t, yaml.Unmarshal(merged, &doc))
+		server := doc["server"].(map[string]interface{})
+		assert.Equal(t, 8080, server["port"])      // 本地修改
+		assert.Equal(t, "0.0.0.0", server["host"]) // 上游修改
+		assert.Equal(t, false, server["tls"])      // 上游新增
+		assert.Equal(t, true, doc["custom"])       // 本地新增
+		assert.NotContains(t, doc, "old")          // 上游删除
+	})
+
+	t.Run("JSON冲突保留本地值", func(t *testing.T) {
+		base := []byte(`{"db": {"pool": 10}, "name": "app"}`)
+		local := []byte(`{"db": {"pool": 20}, "name": "app"}`)
+		upstream := []byte(`{"db": {"pool": 50}, "name": "app2"}`)
+
+		merged, conflicts, err := MergeConfig("json", base, local, upstream)
+		require.NoError(t, err)
+		require.Len(t, conflicts, 1)
+		assert.Equal(t, "db.pool", conflicts[0].Key)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(merged, &doc))
+		assert.Equal(t, float64(20), doc["db"].(map[string]interface{})["pool"])
+		assert.Equal(t, "app2", doc["name"])
+
+		marked, conflicts, err := MergeConfigWithMarkers("json", base, local, upstream)
+		require.NoError(t, err)
+		require.Len(t, conflicts, 1)
+		assert.Equal(t, "{\n    \"db\": {\n<<<<<<< local\n        \"pool\": 20\n=======\n        \"pool\": 50\n>>>>>>> upstream\n    },\n    \"name\": \"app2\"\n}\n", string(marked))
+	})
+
+	t.Run("JSON大整数", func(t *testing.T) {
+		base := []byte(`{"id": 12345678901234567890, "ratio": 0.1}`)
+		local := []byte(`{"id": 12345678901234567890, "ratio": 0.1, "port": 8080}`)
+		upstream := []byte(`{"id": 12345678901234567891, "ratio": 0.1}`)
+
+		merged, conflicts, err := MergeConfig("json", base, local, upstream)
+		require.NoError(t, err)
+		assert.Empty(t, conflicts)
+		assert.Contains(t, string(merged), `"id": 12345678901234567891`)
+		assert.Contains(t, string(merged), `"port": 8080`)
+	})
+
+	t.Run("YAML保留顺序和注释", func(t *testing.T) {
+		base := []byte("# 服务配置\nserver:\n  port: 80 # 端口\n  host: localhost\nlog: info\n")
+		local := []byte("# 服务配置\nserver:\n  port: 8080 # 端口\n  host: localhost\nlog: info\n")
+		upstream := []byte("log: info\nserver:\n  host: 0.0.0.0\n  port: 80\n  # 是否启用 TLS\n  tls: false\n")
+
+		merged, conflicts, err := MergeConfig("yaml", base, local, upstream)
+		require.NoError(t, err)
+		assert.Empty(t, conflicts)
+		assert.Equal(t, "# 服务配置\nserver:\n  port: 8080 # 端口\n  # 是否启用 TLS\n  tls: false\n  host: 0.0.0.0\nlog: info\n", string(merged))
+	})
+
+	t.Run("JSON保留键顺序", func(t *testing.T) {
+		base := []byte(`{"name": "app", "db": {"pool": 10}}`)
+		local := []byte("{\n\t\"name\": \"app\",\n\t\"db\": {\"pool\": 20}\n}\n")
+		upstream := []byte(`{"db": {"pool": 10, "timeout": 5}, "name": "app", "zone": "<cn>"}`)
+
+		merged, conflicts, err := MergeConfig("json", base, local, upstream)
+		require.NoError(t, err)
+		assert.Empty(t, conflicts)
+		assert.Equal(t, "{\n\t\"name\": \"app\",\n\t\"zone\": \"<cn>\",\n\t\"db\": {\n\t\t\"pool\": 20,\n\t\t\"timeout\": 5\n\t}\n}\n", string(merged))
+	})
+
+	t.Run("无上游修改时原样保留", func(t *testing.T) {
+		base := []byte("a: 1\nb: 2\n")
+		local := []byte("# 本地注释\nb:   3\na: 1\n")
+		upstream := []byte("b: 2\na: 1\n")
+
+		merged, conflicts, err := MergeConfig("yaml", base, local, upstream)
+		require.NoError(t, err)
+		assert.Empty(t, conflicts)
+		assert.Equal(t, string(local), string(merged))
+	})
+
+	t.Run("格式错误", func(t *testing.T) {
+		_, _, err := MergeConfig("json", []byte(`{}`), []byte(`{`), []byte(`{}`))
+		assert.Error(t, err)
+		_, _, err = MergeConfig("json", []byte(`{}`), []byte(`{} {}`), []byte(`{}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestProcessMerged(t *testing.T) {
+	const rel = "conf/app/settings.json"
+	base := `{"db": {"pool": 10}, "name": "app"}` + "\n"
+	upstream := `{"db": {"pool": 10}, "name": "app2"}` + "\n"
+	writeFile := func(t *testing.T, path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	// 由基准与新版本生成升级包，嵌套目录中的配置文件附带基准副本
+	baseDir, targetDir, pkgDir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(baseDir, rel), base)
+	writeFile(t, filepath.Join(targetDir, rel), upstream)
+	dg := &DiffGenerator{MergePatterns: []string{"conf/*/*.json"}}
+	require.NoError(t, dg.generateFileDiff(baseDir, targetDir, rel, pkgDir))
+	require.Len(t, dg.UpdatePackage.Files, 1)
+	entry := dg.UpdatePackage.Files[0]
+	require.NotNil(t, entry.Base)
+	assert.Equal(t, MergeThreeWay, entry.Merge)
+	assert.FileExists(t, filepath.Join(pkgDir, entry.Base.Path))
+
+	process := func(t *testing.T, local, onConflict string) (*PatchApp, error) {
+		pa := &PatchApp{
+			TargetDir:     t.TempDir(),
+			PatchTempDir:  pkgDir,
+			NewTempDir:    t.TempDir(),
+			MergeConflict: onConflict,
+			Conflicts:     &ConflictResolver{},
+		}
+		writeFile(t, filepath.Join(pa.TargetDir, rel), local)
+		writeFile(t, filepath.Join(pa.NewTempDir, rel), local)
+		return pa, pa.ProcessMerged(entry)
+	}
+	readStaged := func(t *testing.T, pa *PatchApp) map[string]interface{} {
+		data, err := os.ReadFile(filepath.Join(pa.NewTempDir, rel))
+		require.NoError(t, err)
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &doc))
+		return doc
+	}
+
+	t.Run("本地未修改", func(t *testing.T) {
+		pa, err := process(t, base, MergeOnConflictFail)
+		require.NoError(t, err)
+		data, err := os.ReadFile(filepath.Join(pa.NewTempDir, rel))
+		require.NoError(t, err)
+		assert.Equal(t, upstream, string(data))
+		assert.Empty(t, pa.Conflicts.Conflicts())
+	})
+
+	t.Run("本地修改", func(t *testing.T) {
+		pa, err := process(t, `{"db": {"pool": 20}, "name": "app"}`, MergeOnConflictFail)
+		require.NoError(t, err)
+		doc := readStaged(t, pa)
+		assert.Equal(t, float64(20), doc["db"].(map[string]interface{})["pool"])
+		assert.Equal(t, "app2", doc["name"])
+
+		conflicts := pa.Conflicts.Conflicts()
+		require.Len(t, conflicts, 1)
+		assert.Equal(t, "merged local changes", conflicts[0].Action)
+	})
+
+	t.Run("冲突标记", func(t *testing.T) {
+		pa, err := process(t, `{"db": {"pool": 10}, "name": "mine"}`, MergeOnConflictMarkers)
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(pa.NewTempDir, rel))
+		require.NoError(t, err)
+		assert.Equal(t, "{\n    \"db\": {\n        \"pool\": 10\n    },\n<<<<<<< local\n    \"name\": \"mine\"\n=======\n    \"name\": \"app2\"\n>>>>>>> upstream\n}\n", string(data))
+		assert.NoFileExists(t, filepath.Join(pa.NewTempDir, rel+".merge-conflict"))
+		conflicts := pa.Conflicts.Conflicts()
+		require.Len(t, conflicts, 1)
+		assert.True(t, conflicts[0].Unresolved)
+		assert.Equal(t, "conflict markers written for name, edit the file before use", conflicts[0].Action)
+	})
+
+	t.Run("冲突终止", func(t *testing.T) {
+		local := `{"db": {"pool": 10}, "name": "mine"}`
+		pa, err := process(t, local, MergeOnConflictFail)
+		assert.EqualError(t, err, "both local and upstream changed name")
+		assert.NoFileExists(t, filepath.Join(pa.NewTempDir, rel+".merge-conflict"))
+		data, err := os.ReadFile(filepath.Join(pa.NewTempDir, rel))
+		require.NoError(t, err)
+		assert.Equal(t, local, string(data))
+
+		conflicts := pa.Conflicts.Conflicts()
+		require.Len(t, conflicts, 1)
+		assert.Equal(t, "failed: conflicting keys name", conflicts[0].Action)
+	})
+}
@@ -0,0 +1,227 @@
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Mirror 一个更新服务器镜像及其健康状态
+type Mirror struct {
+	URL string
+
+	base     *url.URL
+	index    int           // 配置中的顺序
+	failures int           // 连续失败次数
+	until    time.Time     // 冷却结束时间
+	latency  time.Duration // 响应头延迟的滑动平均，0 表示尚未测量
+}
+
+// MirrorPool 按顺序配置的一组镜像
+//
+// 连续失败 MaxFailures 次的镜像进入冷却，冷却期间只在其他镜像都不可用时使用；
+// 健康的镜像按测得的延迟排序，未测量的镜像保持配置顺序排在最后。
+type MirrorPool struct {
+	MaxFailures int           // 进入冷却前允许的连续失败次数
+	Cooldown    time.Duration // 冷却时长
+
+	mu      sync.Mutex
+	mirrors []*Mirror
+	now     func() time.Time
+}
+
+// NewMirrorPool 创建镜像池，urls 为各镜像的基础 URL，顺序即初始优先级
+func NewMirrorPool(urls []string) (*MirrorPool, error) {
+	pool := &MirrorPool{MaxFailures: 3, Cooldown: time.Minute, now: time.Now}
+	seen := make(map[string]bool)
+	for _, raw := range urls {
+		raw = strings.TrimRight(strings.TrimSpace(raw), "/")
+		if raw == "" || seen[raw] {
+			continue
+		}
+		base, err := url.Parse(raw)
+		if err != nil || base.Scheme == "" || base.Host == "" {
+			return nil, fmt.Errorf("invalid mirror URL %q", raw)
+		}
+		seen[raw] = true
+		pool.mirrors = append(pool.mirrors, &Mirror{URL: raw, base: base, index: len(pool.mirrors)})
+	}
+	if len(pool.mirrors) == 0 {
+		return nil, fmt.Errorf("no mirrors configured")
+	}
+	return pool, nil
+}
+
+// Candidates 返回本次请求依次尝试的镜像
+func (p *MirrorPool) Candidates() []*Mirror {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var healthy, cooling []*Mirror
+	for _, m := range p.mirrors {
+		if now.Before(m.until) {
+			cooling = append(cooling, m)
+		} else {
+			healthy = append(healthy, m)
+		}
+	}
+	sort.SliceStable(healthy, func(i, j int) bool {
+		a, b := healthy[i], healthy[j]
+		if (a.latency == 0) != (b.latency == 0) {
+			return a.latency != 0
+		}
+		return a.latency < b.latency
+	})
+	// 冷却中的镜像作为最后的选择，先结束冷却的优先
+	sort.SliceStable(cooling, func(i, j int) bool {
+		return cooling[i].until.Before(cooling[j].until)
+	})
+	return append(healthy, cooling...)
+}
+
+// ReportSuccess 记录一次成功的请求，latency 为收到响应头的耗时
+func (p *MirrorPool) ReportSuccess(m *Mirror, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m.failures = 0
+	m.until = time.Time{}
+	if latency <= 0 {
+		latency = time.Nanosecond
+	}
+	if m.latency == 0 {
+		m.latency = latency
+	} else {
+		m.latency = (m.latency*7 + latency*3) / 10
+	}
+}
+
+// ReportFailure 记录一次失败的请求，返回镜像是否进入冷却
+func (p *MirrorPool) ReportFailure(m *Mirror) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m.failures++
+	if m.failures < p.MaxFailures {
+		return false
+	}
+	m.until = p.now().Add(p.Cooldown)
+	return true
+}
+
+// rewrite 把基于 base 的请求地址改写到镜像 m 上；地址不属于 base 时返回 false
+func (m *Mirror) rewrite(u, base *url.URL) (*url.URL, bool) {
+	if u.Scheme != base.Scheme || u.Host != base.Host {
+		return nil, false
+	}
+	rest := u.Path
+	if prefix := strings.TrimRight(base.Path, "/"); prefix != "" {
+		if rest != prefix && !strings.HasPrefix(rest, prefix+"/") {
+			return nil, false
+		}
+		rest = strings.TrimPrefix(rest, prefix)
+	}
+	target := *u
+	target.Scheme = m.base.Scheme
+	target.Host = m.base.Host
+	target.User = m.base.User
+	target.Path = strings.TrimRight(m.base.Path, "/") + rest
+	target.RawPath = ""
+	return &target, true
+}
+
+// mirrorTransport 把发往 BaseURL 的请求依次转发到各镜像，失败时切换到下一个
+type mirrorTransport struct {
+	pool   *MirrorPool
+	base   *url.URL
+	next   http.RoundTripper
+	logger *zap.Logger
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	candidates := t.pool.Candidates()
+	if _, ok := candidates[0].rewrite(req.URL, t.base); !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	var lastErr error
+	for i, m := range candidates {
+		last := i == len(candidates)-1
+		target, _ := m.rewrite(req.URL, t.base)
+
+		attempt := req.Clone(req.Context())
+		attempt.URL = target
+		attempt.Host = ""
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				// 请求体无法重放，只能使用第一个镜像
+				last = true
+			} else if i > 0 {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attempt.Body = body
+			}
+		}
+
+		start := time.Now()
+		resp, err := t.next.RoundTrip(attempt)
+		switch {
+		case err != nil:
+			lastErr = err
+			t.failed(m, zap.Error(err))
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+			t.failed(m, zap.Int("status", resp.StatusCode))
+			if last {
+				return resp, nil
+			}
+			resp.Body.Close()
+		case resp.StatusCode == http.StatusNotFound && !last:
+			// 镜像可能尚未同步，换下一个但不计为失败
+			t.logger.Info("Mirror missing file, trying next", zap.String("mirror", m.base.Redacted()), zap.String("url", target.Redacted()))
+			resp.Body.Close()
+		default:
+			t.pool.ReportSuccess(m, time.Since(start))
+			t.logger.Info("Served by mirror",
+				zap.String("mirror", m.base.Redacted()),
+				zap.String("url", target.Redacted()),
+				zap.Int("status", resp.StatusCode),
+			)
+			return resp, nil
+		}
+		if last {
+			break
+		}
+	}
+	return nil, fmt.Errorf("all mirrors failed: %w", lastErr)
+}
+
+func (t *mirrorTransport) failed(m *Mirror, fields ...zap.Field) {
+	fields = append([]zap.Field{zap.String("mirror", m.base.Redacted())}, fields...)
+	if t.pool.ReportFailure(m) {
+		t.logger.Warn("Mirror on cooldown", append(fields, zap.Duration("cooldown", t.pool.Cooldown))...)
+		return
+	}
+	t.logger.Warn("Mirror request failed", fields...)
+}
+
+// withMirrors 配置了 Mirrors 时在 next 外包装一层镜像切换
+func (nm *NetManager) withMirrors(next http.RoundTripper) http.RoundTripper {
+	if nm.Mirrors == nil {
+		return next
+	}
+	base, err := url.Parse(strings.TrimRight(nm.BaseURL, "/"))
+	if err != nil || base.Host == "" {
+		return next
+	}
+	return &mirrorTransport{pool: nm.Mirrors, base: base, next: next, logger: nm.Logger}
+}
@@ -0,0 +1,121 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorPool(t *testing.T) {
+	pool, err := NewMirrorPool([]string{"http://a", "http://b/", "http://c", "http://b"})
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	pool.now = func() time.Time { return now }
+
+	urls := func() []string {
+		var out []string
+		for _, m := range pool.Candidates() {
+			out = append(out, m.URL)
+		}
+		return out
+	}
+
+	t.Run("未测量时保持配置顺序", func(t *testing.T) {
+		assert.Equal(t, []string{"http://a", "http://b", "http://c"}, urls())
+	})
+
+	t.Run("按延迟排序", func(t *testing.T) {
+		m := pool.Candidates()
+		pool.ReportSuccess(m[0], 80*time.Millisecond)
+		pool.ReportSuccess(m[2], 10*time.Millisecond)
+		assert.Equal(t, []string{"http://c", "http://a", "http://b"}, urls())
+	})
+
+	t.Run("连续失败后进入冷却", func(t *testing.T) {
+		c := pool.Candidates()[0]
+		assert.False(t, pool.ReportFailure(c))
+		assert.False(t, pool.ReportFailure(c))
+		assert.True(t, pool.ReportFailure(c))
+		assert.Equal(t, []string{"http://a", "http://b", "http://c"}, urls())
+
+		now = now.Add(pool.Cooldown)
+		assert.Equal(t, "http://c", urls()[0])
+	})
+
+	t.Run("无效镜像", func(t *testing.T) {
+		_, err := NewMirrorPool([]string{"localhost:8888"})
+		assert.Error(t, err)
+		_, err = NewMirrorPool(nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestMirrorFailover(t *testing.T) {
+	content := []byte("v1.2.3")
+
+	// 主服务器已下线
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	var served int32
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&served, 1)
+		if r.URL.Path != "/cdn/p/d/j/version.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content)
+	}))
+	defer mirror.Close()
+
+	// 尚未同步的镜像
+	stale := httptest.NewServer(http.NotFoundHandler())
+	defer stale.Close()
+
+	newManager := func() *NetManager {
+		nm := NewNetManager()
+		nm.BaseURL = down.URL
+		nm.Retries = 1
+		pool, err := NewMirrorPool([]string{down.URL, stale.URL, mirror.URL + "/cdn"})
+		require.NoError(t, err)
+		nm.Mirrors = pool
+		require.NoError(t, nm.BuildReqURL("p", "d", "j", "version.txt"))
+		return nm
+	}
+
+	t.Run("获取版本", func(t *testing.T) {
+		nm := newManager()
+		version, err := nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v1.2.3", version)
+	})
+
+	t.Run("下载文件", func(t *testing.T) {
+		nm := newManager()
+		nm.FollowRedirects = true
+		dest := filepath.Join(t.TempDir(), "version.txt")
+		require.NoError(t, nm.DownloadFile(dest))
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("其他地址不经过镜像", func(t *testing.T) {
+		before := atomic.LoadInt32(&served)
+		nm := newManager()
+		nm.ReqURL = stale.URL + "/version.txt"
+		_, err := nm.GetRemoteVersion(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fmt.Sprint(http.StatusNotFound))
+		assert.Equal(t, before, atomic.LoadInt32(&served))
+	})
+}
@@ -3,14 +3,15 @@ package helpers
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,76 +33,329 @@ type NetManager struct {
 	FollowRedirects bool          // 是否跟随重定向
 	Logger          *zap.Logger   // 日志记录器
 	RespCode        int
+	RespCache       string           // GetRemoteVersion 的响应来自本地缓存时为 hit/revalidated/stale
+	RespAge         time.Duration    // 缓存响应的时长
+	Checksum        string           // 下载文件的期望摘要 algorithm:hex（md5/sha1/sha256/sha512），为空时不校验
+	ChecksumSidecar bool             // Checksum 为空时自动获取 <url>.sha256 或 <url>.md5 作为期望摘要
+	Segments        int              // 分段并发下载的段数，<=1 时单流下载
+	Mirrors         *MirrorPool      // 发往 BaseURL 的请求在这些镜像间自动切换，为 nil 时直接请求
+	KeepPartial     bool             // 下载被取消时保留 .part 文件以便下次续传，默认删除
+	Progress        ProgressFunc     // 上传与下载的进度回调，为 nil 时不报告
+	Auth            AuthProvider     // 为每个请求添加认证信息，为 nil 时不认证
+	CACertFile      string           // 额外信任的 CA 证书（PEM），替代系统证书库
+	ClientCertFile  string           // mTLS 客户端证书（PEM）
+	ClientKeyFile   string           // 客户端证书的私钥（PEM），为空时从 ClientCertFile 读取
+	MinTLSVersion   uint16           // 最低 TLS 版本（tls.VersionTLS12 等），0 使用默认值
+	ProxyURL        string           // 显式指定的代理，为空时使用 HTTP_PROXY/HTTPS_PROXY 环境变量
+	NoProxy         string           // 不经过 ProxyURL 的主机列表，为空时使用 NO_PROXY 环境变量
+	RateLimit       *RateLimiter     // 下载限速，分段下载的各段共用，为 nil 时不限速
+	Cache           *HTTPCache       // GET 响应的磁盘缓存，为 nil 时不缓存；带凭据的请求不缓存
+	ReqForm         []string         // multipart/form-data 字段，name=value 或 name=@file[;type=mime]
+	FailOnError     bool             // SendRequest 遇到 4xx/5xx 时返回 *HTTPStatusError
+	Recorder        *FixtureRecorder // 录制经过网络的请求与响应，为 nil 时不录制
 }
 
+// DownloadFile 下载 ReqURL 到 filePath，等同于使用 context.Background() 调用 DownloadFileContext
 func (nm *NetManager) DownloadFile(filePath string) error {
+	return nm.DownloadFileContext(context.Background(), filePath)
+}
+
+// DownloadFileContext 下载 ReqURL 到 filePath，支持断点续传
+//
+// 数据先写入 <filePath>.part，并在 <filePath>.part.json 中记录 ETag/Last-Modified 与完整长度；
+// 重试或再次运行时用 Range/If-Range 从已下载的位置继续。
+// 只有长度与摘要校验通过后才重命名为 filePath；摘要不一致时删除已下载的数据并重新下载。
+// ctx 取消时立即停止传输与重试等待，并删除 .part 文件（KeepPartial 时保留）。
+func (nm *NetManager) DownloadFileContext(ctx context.Context, filePath string) (err error) {
+	// 处理相对路径，转换为绝对路径
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+
+	// 创建目标目录（确保所有父目录都存在）
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	partPath := absPath + ".part"
+	defer func() {
+		if err != nil && ctx.Err() != nil && !nm.KeepPartial {
+			_ = os.Remove(partPath)
+			_ = os.Remove(partPath + ".json")
+		}
+	}()
 
 	// 准备HTTP客户端配置
-	client := nm.prepareHTTPClient()
+	client, err := nm.prepareHTTPClient()
+	if err != nil {
+		return err
+	}
+
+	sum, err := nm.resolveChecksum(ctx, client)
+	if err != nil {
+		return err
+	}
+	var digest *streamDigest
+	if sum != nil {
+		digest = &streamDigest{h: sum.newHash()}
+	}
+
+	progress := newProgressTracker(nm.Progress, nm.ReqURL, -1, false)
+	defer progress.finish()
 
 	var lastErr error
-	var resp *http.Response
 
-	// 重试逻辑
-	for attempt := 0; attempt <= nm.Retries; attempt++ {
-		// 创建新的请求（每次重试都需要新请求）
-		req, err := nm.createRequest(nm.ReqURL)
-		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
+	// 服务器支持 Range 时分段并发下载，否则自动回退为单流下载
+	if nm.Segments > 1 {
+		err := nm.downloadSegments(ctx, client, partPath, progress)
+		if err == nil {
+			err = nm.finishDownload(partPath, absPath, sum, nil)
+			if err == nil || !errors.Is(err, errChecksumMismatch) {
+				return err
+			}
+			lastErr = err
+			nm.Logger.Warn("Checksum mismatch, downloading again", zap.String("url", RedactURL(nm.ReqURL)), zap.Error(err))
+		} else if !errors.Is(err, errSegmentsUnsupported) {
+			return err
+		} else {
+			nm.Logger.Info("Falling back to a single stream", zap.String("url", RedactURL(nm.ReqURL)))
 		}
+	}
 
-		// 发送请求
-		resp, err = client.Do(req)
-		if err != nil {
-			lastErr = err
-			if nm.shoulRetry(attempt, nil, err) {
-				nm.logRetry(attempt, err)
-				continue
+	// 重试逻辑
+	for attempt := 0; attempt <= nm.Retries; attempt++ {
+		retry, err := nm.downloadPart(ctx, client, partPath, digest, progress)
+		if err == nil {
+			err = nm.finishDownload(partPath, absPath, sum, digest)
+			if err == nil {
+				return nil
 			}
+			// 摘要不一致时数据已被删除，重新下载
+			retry = errors.Is(err, errChecksumMismatch)
+		}
+		lastErr = err
+		if !retry || attempt >= nm.Retries {
 			break
 		}
+		if err := nm.waitRetry(ctx, attempt, err); err != nil {
+			return fmt.Errorf("download cancelled: %w", err)
+		}
+	}
 
-		// 处理响应
-		nm.RespCode = resp.StatusCode
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			_ = resp.Body.Close()
-			lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-			if nm.shoulRetry(attempt, resp, nil) {
-				nm.logRetry(attempt, lastErr)
-				continue
-			}
-			break
+	if ctx.Err() != nil {
+		return fmt.Errorf("download cancelled: %w", lastErr)
+	}
+	return fmt.Errorf("request failed after %d attempts: %w", nm.Retries+1, lastErr)
+}
+
+// downloadMeta .part 文件的附带信息，用于判断能否续传
+type downloadMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Length       int64  `json:"length"` // 完整文件长度，未知时为 -1
+
+	Segments []downloadSegment `json:"segments,omitempty"` // 分段下载的进度
+}
+
+func loadDownloadMeta(path string) *downloadMeta {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var meta downloadMeta
+	if json.Unmarshal(data, &meta) != nil {
+		return nil
+	}
+	return &meta
+}
+
+func saveDownloadMeta(path string, meta *downloadMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// downloadPart 发起一次请求，把数据追加到 .part 文件
+// 返回的 retry 表示失败后是否值得重试（已写入的数据会保留，下次从断点继续）
+// digest 不为 nil 时边写入边计算摘要，progress 不为 nil 时报告写入进度
+func (nm *NetManager) downloadPart(ctx context.Context, client *http.Client, partPath string, digest *streamDigest, progress *progressTracker) (retry bool, err error) {
+	metaPath := partPath + ".json"
+	meta := loadDownloadMeta(metaPath)
+
+	// 只有同一 URL、且有校验标识时才能续传，否则从头下载；分段下载的文件中间可能有空洞，不能按长度续传
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil && meta != nil && meta.URL == nm.ReqURL && len(meta.Segments) == 0 && (meta.ETag != "" || meta.LastModified != "") {
+		offset = info.Size()
+		if meta.Length >= 0 && offset == meta.Length {
+			return false, nil
 		}
+		if meta.Length >= 0 && offset > meta.Length {
+			offset = 0
+		}
+	}
 
-		// 成功响应，处理文件下载
-		if err := nm.saveResponseToFile(resp, filePath); err != nil {
-			_ = resp.Body.Close()
-			return fmt.Errorf("failed to save file: %w", err)
+	// 创建新的请求（每次重试都需要新请求）
+	req, err := nm.createRequest(ctx, nm.ReqURL)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 {
+		validator := meta.ETag
+		if validator == "" {
+			validator = meta.LastModified
 		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
 
-		_ = resp.Body.Close()
-		return nil
+	// 发送请求，连接失败与可重试的状态码已由 retryTransport 重试过
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	// 处理响应
+	nm.RespCode = resp.StatusCode
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			// 无法确认续传位置，丢弃已下载的数据
+			_ = os.Remove(partPath)
+			return true, fmt.Errorf("unexpected Content-Range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+		if meta.Length < 0 {
+			meta.Length = total
+		}
+		nm.Logger.Info("Resuming download", zap.String("url", RedactURL(nm.ReqURL)), zap.Int64("offset", offset))
+
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// 远端文件可能已经变化，从头开始
+		_ = os.Remove(partPath)
+		_ = os.Remove(metaPath)
+		return true, fmt.Errorf("range not satisfiable at offset %d, restarting", offset)
+
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		// 完整响应（首次下载，或 If-Range 校验失败说明远端文件已变化）
+		offset = 0
+		meta = &downloadMeta{
+			URL:          nm.ReqURL,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Length:       resp.ContentLength,
+		}
+		if err := saveDownloadMeta(metaPath, meta); err != nil {
+			return false, fmt.Errorf("failed to save download state: %w", err)
+		}
+
+	default:
+		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	// 续传时已有的数据也要计入摘要
+	if digest != nil {
+		if err := digest.syncTo(partPath, offset); err != nil {
+			return false, fmt.Errorf("hash partial file: %w", err)
+		}
+	}
+
+	// 成功响应，处理文件下载
+	progress.reset(offset, meta.Length)
+	written, err := nm.saveResponseToFile(resp, partPath, offset, digest, progress)
+	if err != nil {
+		// 已写入的部分保留在 .part 中，重试时续传；取消时不再重试
+		return !errors.Is(err, errBodyTooLarge) && ctx.Err() == nil, fmt.Errorf("failed to save file: %w", err)
+	}
+	if meta.Length >= 0 && offset+written < meta.Length {
+		return true, fmt.Errorf("incomplete body: got %d of %d bytes", offset+written, meta.Length)
+	}
+	return false, nil
+}
+
+// parseContentRange 解析 "bytes start-end/total"，total 未知（*）时返回 -1
+func parseContentRange(value string) (start, total int64, ok bool) {
+	var end int64
+	if n, _ := fmt.Sscanf(value, "bytes %d-%d/%d", &start, &end, &total); n == 3 {
+		return start, total, true
+	}
+	if n, _ := fmt.Sscanf(value, "bytes %d-%d/*", &start, &end); n == 2 {
+		return start, -1, true
+	}
+	return 0, 0, false
+}
+
+// finishDownload 校验 .part 文件的长度与摘要，通过后重命名为最终文件
+func (nm *NetManager) finishDownload(partPath, filePath string, sum *checksum, digest *streamDigest) error {
+	metaPath := partPath + ".json"
+	discard := func() {
+		_ = os.Remove(partPath)
+		_ = os.Remove(metaPath)
 	}
 
-	if lastErr != nil {
-		return fmt.Errorf("request failed after %d attempts: %w", nm.Retries+1, lastErr)
+	info, err := os.Stat(partPath)
+	if err != nil {
+		return err
+	}
+	if meta := loadDownloadMeta(metaPath); meta != nil && meta.Length >= 0 && info.Size() != meta.Length {
+		discard()
+		return fmt.Errorf("downloaded size mismatch: expected %d, got %d", meta.Length, info.Size())
+	}
+
+	if sum != nil {
+		if err := sum.verify(partPath, info.Size(), digest); err != nil {
+			discard()
+			if digest != nil {
+				digest.h.Reset()
+				digest.n = 0
+			}
+			return fmt.Errorf("verify download: %w", err)
+		}
 	}
-	return fmt.Errorf("unexpected error occurred")
+
+	if err := os.Rename(partPath, filePath); err != nil {
+		return err
+	}
+	_ = os.Remove(metaPath)
+	return nil
 }
 
-func (nm *NetManager) prepareHTTPClient() *http.Client {
+// prepareHTTPClient 按 NetManager 的配置组装客户端，所有请求共用同一条 RoundTripper 链：
+// 缓存 -> 重试（退避、Retry-After、单次超时、日志） -> 镜像切换 -> 认证 -> 证书错误说明 -> 配置了 TLS 与代理的基础 Transport
+func (nm *NetManager) prepareHTTPClient() (*http.Client, error) {
 	// 复制基础客户端配置
-	client := *nm.HTTPClient
+	var client http.Client
+	if nm.HTTPClient != nil {
+		client = *nm.HTTPClient
+	}
+	if nm.Logger == nil {
+		nm.Logger = zap.NewNop()
+	}
 
-	// 配置TLS
-	if transport, ok := client.Transport.(*http.Transport); ok {
+	// 配置TLS与代理
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok && client.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport), true
+	}
+	if ok {
 		transport = transport.Clone()
 		if transport.TLSClientConfig == nil {
 			transport.TLSClientConfig = &tls.Config{}
 		}
-		transport.TLSClientConfig.InsecureSkipVerify = nm.AllowInsecure
+		if err := nm.configureTLS(transport.TLSClientConfig); err != nil {
+			return nil, err
+		}
+		proxy, err := nm.proxyFunc()
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = proxy
 		client.Transport = transport
 	}
+	client.Transport = nm.withRecorder(client.Transport)
 
 	// 配置重定向
 	if !nm.FollowRedirects {
@@ -110,85 +364,86 @@ func (nm *NetManager) prepareHTTPClient() *http.Client {
 		}
 	}
 
-	return &client
+	// 超时按每次尝试计算，整体超时会把重试也算在内
+	timeout := nm.Timeout
+	if timeout <= 0 {
+		timeout = client.Timeout
+	}
+	client.Timeout = 0
+	client.Transport = nm.withCache(&retryTransport{
+		next:    nm.withMirrors(nm.withAuth(&certErrorTransport{nm: nm, next: client.Transport})),
+		retries: nm.Retries,
+		timeout: timeout,
+		logger:  nm.Logger,
+	})
+	return &client, nil
 }
 
-func (nm *NetManager) createRequest(fullURL string) (*http.Request, error) {
+func (nm *NetManager) createRequest(ctx context.Context, fullURL string) (*http.Request, error) {
 	var body io.Reader
 	if nm.ReqBody != "" {
 		body = strings.NewReader(nm.ReqBody)
 	}
 
-	req, err := http.NewRequest(nm.ReqMethod, fullURL, body)
+	req, err := http.NewRequestWithContext(ctx, nm.ReqMethod, fullURL, body)
 	if err != nil {
 		return nil, err
 	}
 
 	// 设置请求头
+	if err := nm.addHeaders(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// addHeaders 添加 ReqHeaders 中的请求头
+func (nm *NetManager) addHeaders(req *http.Request) error {
 	for _, h := range nm.ReqHeaders {
 		parts := strings.SplitN(h, ":", 2)
 		if len(parts) != 2 {
-			nm.Logger.Warn("Invalid header format", zap.String("header", h))
-			continue
+			return fmt.Errorf("invalid header %q, expected key:value", h)
 		}
 		key := strings.TrimSpace(parts[0])
 		value := strings.TrimSpace(parts[1])
 		req.Header.Add(key, value)
 	}
-
-	return req, nil
-}
-
-func (nm *NetManager) shoulRetry(attempt int, resp *http.Response, err error) bool {
-	if attempt >= nm.Retries {
-		return false
-	}
-
-	// 网络错误自动重试
-	if err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			return true
-		}
-		return true
-	}
-
-	// 5xx状态码重试
-	if resp != nil && resp.StatusCode >= 500 {
-		return true
-	}
-
-	return false
+	return nil
 }
 
-func (nm *NetManager) logRetry(attempt int, err error) {
-	nm.Logger.Info("Retrying request",
+// waitRetry 记录下载中途失败（连接中断、长度或摘要不符）后的重试，并按统一的退避策略等待
+// ctx 在等待期间取消时返回 ctx.Err()
+func (nm *NetManager) waitRetry(ctx context.Context, attempt int, err error) error {
+	delay := backoffDelay(attempt)
+	nm.Logger.Info("Retrying download",
 		zap.Int("attempt", attempt+1),
 		zap.Int("max_retries", nm.Retries),
+		zap.Duration("delay", delay),
 		zap.Error(err),
 	)
-	time.Sleep(nm.calculateBackoff(attempt))
-}
-
-func (nm *NetManager) calculateBackoff(attempt int) time.Duration {
-	return time.Duration(math.Pow(2, float64(attempt))) * time.Second
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (nm *NetManager) saveResponseToFile(resp *http.Response, filePath string) error {
-	// 处理相对路径，转换为绝对路径
-	absPath, err := filepath.Abs(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to resolve absolute path: %w", err)
-	}
+// errBodyTooLarge 响应体超出 MaxBodySize，重试也无法成功
+var errBodyTooLarge = errors.New("response body exceeds maximum allowed size")
 
-	// 创建目标目录（确保所有父目录都存在）
-	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
-		return fmt.Errorf("failed to create directories: %w", err)
+// saveResponseToFile 将响应体写入文件，offset > 0 时追加到已有数据之后
+// digest 不为 nil 时同时计算写入数据的摘要，progress 不为 nil 时统计写入的字节数
+func (nm *NetManager) saveResponseToFile(resp *http.Response, filePath string, offset int64, digest *streamDigest, progress *progressTracker) (int64, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
 	}
-
-	// 创建目标文件（使用绝对路径）
-	file, err := os.Create(absPath)
+	file, err := os.OpenFile(filePath, flags, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return 0, fmt.Errorf("failed to create file: %w", err)
 	}
 	defer func() {
 		if closeErr := file.Close(); closeErr != nil {
@@ -198,29 +453,37 @@ func (nm *NetManager) saveResponseToFile(resp *http.Response, filePath string) e
 
 	// 限制读取大小
 	limitedReader := &io.LimitedReader{
-		R: resp.Body,
-		N: nm.MaxBodySize,
+		R: nm.throttle(resp),
+		N: nm.MaxBodySize - offset + 1,
 	}
 
-	// 复制数据（使用缓冲写入提高性能）
-	if _, err := io.CopyBuffer(file, limitedReader, make([]byte, 32*1024)); err != nil {
-		// 删除可能已写入的部分文件
-		_ = os.Remove(absPath)
-		return fmt.Errorf("failed to write file: %w", err)
+	writers := []io.Writer{file}
+	if digest != nil {
+		writers = append(writers, digest)
 	}
-
-	// 检查是否超出最大限制
-	if limitedReader.N <= 0 {
-		_ = os.Remove(absPath)
-		return fmt.Errorf("response body exceeds maximum allowed size of %d bytes", nm.MaxBodySize)
+	if progress != nil {
+		writers = append(writers, progress)
 	}
+	dst := io.MultiWriter(writers...)
 
-	// 确保数据写入磁盘
+	// 复制数据（使用缓冲写入提高性能）
+	written, copyErr := io.CopyBuffer(dst, limitedReader, make([]byte, 32*1024))
+
+	// 确保数据写入磁盘，中断时已写入的部分也用于续传
 	if err := file.Sync(); err != nil {
 		nm.Logger.Warn("Failed to sync file to disk", zap.Error(err))
 	}
 
-	return nil
+	// 检查是否超出最大限制
+	if limitedReader.N <= 0 {
+		_ = os.Remove(filePath)
+		_ = os.Remove(filePath + ".json")
+		return written, fmt.Errorf("%w of %d bytes", errBodyTooLarge, nm.MaxBodySize)
+	}
+	if copyErr != nil {
+		return written, fmt.Errorf("failed to write file: %w", copyErr)
+	}
+	return written, nil
 }
 
 func NewNetManager() *NetManager {
@@ -253,130 +516,142 @@ func (netM *NetManager) BuildReqURL(platform, dependency, project string, filePa
 		filePath)
 
 	netM.ReqURL = parsedURL.String()
-	fmt.Printf("ReqURL: %v \n", netM.ReqURL)
+	fmt.Printf("ReqURL: %v \n", parsedURL.Redacted())
 	return nil
 }
 
 // 获取远程版本信息
 func (netM *NetManager) GetRemoteVersion(ctx context.Context) (string, error) {
-	var (
-		lastError error
-	)
-	for i := 0; i < netM.Retries; i++ {
-		req, _ := http.NewRequestWithContext(ctx, "GET", netM.ReqURL, nil)
-		for _, header := range netM.ReqHeaders {
-			parts := strings.SplitN(header, ":", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				req.Header.Add(key, value)
-			}
-		}
-		// start := time.Now()
-
-		resp, err := netM.HTTPClient.Do(req)
-		if err != nil {
-			lastError = fmt.Errorf("network error: %w", err)
-			netM.Logger.Warn("Request failed",
-				zap.Error(err),
-				zap.Int("attempt", i+1))
-			continue
-		}
-
-		netM.RespCode = resp.StatusCode
-		defer resp.Body.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, netM.ReqURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	if err := netM.addHeaders(req); err != nil {
+		return "", err
+	}
 
-		if resp.StatusCode == http.StatusOK {
-			content, err := io.ReadAll(io.LimitReader(resp.Body, netM.MaxBodySize))
-			if err != nil {
-				return "", fmt.Errorf("read body: %w", err)
-			}
-			return strings.TrimSpace(string(content)), nil
-		}
-		// fmt.Printf("resp: %v, err: %v \n", resp, err)
+	client, err := netM.prepareHTTPClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("after %d attempts, network error: %w", netM.Retries+1, err)
+	}
+	defer resp.Body.Close()
 
+	netM.RespCode = resp.StatusCode
+	netM.RespCache = resp.Header.Get(CacheStatusHeader)
+	netM.RespAge = 0
+	if seconds, err := strconv.Atoi(resp.Header.Get("Age")); err == nil && netM.RespCache != "" {
+		netM.RespAge = time.Duration(seconds) * time.Second
+	}
+	if resp.StatusCode != http.StatusOK {
 		// 记录服务端错误
 		if resp.StatusCode >= 500 {
 			netM.Logger.Error("Server error",
 				zap.Int("status", resp.StatusCode),
-				zap.String("path", netM.ReqURL))
-		}
-
-		// 非重试场景直接返回
-		if !netM.shouldRetry(resp) {
-			break
-		}
-
-		// 指数退避
-		backoff := time.Duration(math.Pow(2, float64(i))) * 100 * time.Millisecond
-		select {
-		case <-time.After(backoff):
-		case <-ctx.Done():
-			return "", ctx.Err()
+				zap.String("path", RedactURL(netM.ReqURL)))
 		}
+		return "", fmt.Errorf("after %d attempts, last status: %d, error: unexpected status code: %d",
+			netM.Retries+1, resp.StatusCode, resp.StatusCode)
 	}
-	return "", fmt.Errorf("after %d attempts, last status: %d, error: %w",
-		netM.Retries, netM.RespCode, lastError)
-}
 
-func (netM *NetManager) shouldRetry(resp *http.Response) bool {
-	if resp == nil {
-		return true // 网络错误重试
+	content, err := io.ReadAll(io.LimitReader(resp.Body, netM.MaxBodySize))
+	if err != nil {
+		return "", fmt.Errorf("read body: %w", err)
 	}
-	// 5xx 状态码重试（除 501）
-	return (resp.StatusCode >= 500 && resp.StatusCode != 501) ||
-		resp.StatusCode == 429 || resp.StatusCode == 408
+	return strings.TrimSpace(string(content)), nil
 }
 
+// SendRequest 作为 cobra 命令的 RunE，使用命令的 context 发送请求，按默认方式输出到 os.Stdout
 func (netM *NetManager) SendRequest(cmd *cobra.Command, args []string) error {
-	// 创建请求体
-	var reqBodyReader io.Reader
-	if netM.ReqBody != "" {
-		reqBodyReader = strings.NewReader(netM.ReqBody)
-	}
+	return netM.SendRequestContext(cmd.Context(), RequestOutput{})
+}
 
+// SendRequestContext 发送 ReqURL 请求，并按 output 输出状态码、响应头与响应体
+func (netM *NetManager) SendRequestContext(ctx context.Context, output RequestOutput) error {
 	// 创建请求对象
-	req, err := http.NewRequest(
-		strings.ToUpper(netM.ReqMethod),
-		netM.ReqURL,
-		reqBodyReader,
-	)
+	req, err := netM.NewRequest(ctx)
 	if err != nil {
-		return fmt.Errorf("创建请求失败: %w", err)
+		return err
+	}
+	if output.PrettyJSON {
+		setJSONHeaders(req)
 	}
 
-	// 添加请求头
-	for _, h := range netM.ReqHeaders {
-		parts := strings.SplitN(h, ":", 2)
-		if len(parts) != 2 {
-			return fmt.Errorf("无效的请求头格式: %q，应使用 key:value 格式", h)
+	// 上传进度，重试时从头计算
+	upload := newProgressTracker(netM.Progress, netM.ReqURL, req.ContentLength, true)
+	if upload != nil && req.Body != nil {
+		req.Body = &progressReader{ReadCloser: req.Body, tracker: upload}
+		if getBody := req.GetBody; getBody != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				upload.reset(0, req.ContentLength)
+				return &progressReader{ReadCloser: body, tracker: upload}, nil
+			}
 		}
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		req.Header.Add(key, value)
 	}
 
-	// 发送请求
-	client := &http.Client{}
+	// 发送请求，与下载使用相同的重试、超时与 TLS 配置
+	client, err := netM.prepareHTTPClient()
+	if err != nil {
+		return err
+	}
 	resp, err := client.Do(req)
+	if upload != nil && req.Body != nil {
+		upload.finish()
+	}
 	if err != nil {
 		return fmt.Errorf("请求失败: %w", err)
 	}
 	defer resp.Body.Close()
+	netM.RespCode = resp.StatusCode
+	if netM.FailOnError && resp.StatusCode >= 400 {
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status, URL: RedactURL(netM.ReqURL)}
+	}
 
-	// 读取响应体
-	respBody, err := io.ReadAll(resp.Body)
+	// 读取响应体，指定了 OutputFile 时直接写入文件
+	var body io.Reader = resp.Body
+	download := newProgressTracker(netM.Progress, netM.ReqURL, resp.ContentLength, false)
+	if download != nil {
+		body = &progressReader{ReadCloser: resp.Body, tracker: download}
+	}
+	var respBody []byte
+	if output.OutputFile != "" {
+		err = writeFileFrom(output.OutputFile, body)
+	} else {
+		respBody, err = io.ReadAll(body)
+	}
+	download.finish()
 	if err != nil {
 		return fmt.Errorf("读取响应失败: %w", err)
 	}
 
 	// 输出结果
-	fmt.Printf("状态码: %d %s\n", resp.StatusCode, resp.Status)
-	fmt.Println("\n响应头:")
-	for k, v := range resp.Header {
-		fmt.Printf("  %s: %s\n", k, strings.Join(v, ", "))
+	out := output.Out
+	if out == nil {
+		out = os.Stdout
 	}
-	fmt.Println("\n响应体:")
-	fmt.Println(string(respBody))
+	output.writeResponse(out, resp, respBody)
 	return nil
 }
+
+// writeFileFrom 将 r 写入 path，失败时删除不完整的文件
+func writeFileFrom(path string, r io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
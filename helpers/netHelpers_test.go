@@ -0,0 +1,189 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer 第一次请求只发送一半数据就断开连接，之后正常支持 Range
+func flakyServer(t *testing.T, content []byte) (*httptest.Server, func() []string) {
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		first := len(ranges) == 0
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"v1"`)
+		if first {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "pkg.tar.gz", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ranges...)
+	}
+}
+
+func newTestNetManager(url string) *NetManager {
+	nm := NewNetManager()
+	nm.ReqURL = url
+	nm.ReqMethod = "GET"
+	nm.Retries = 2
+	return nm
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	sum := fmt.Sprintf("%x", md5.Sum(content))
+
+	t.Run("重试时从断点继续", func(t *testing.T) {
+		srv, requests := flakyServer(t, content)
+		nm := newTestNetManager(srv.URL)
+		nm.Checksum = "md5:" + sum
+		nm.Retries = 1
+
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.NoError(t, nm.DownloadFile(dest))
+
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.NoFileExists(t, dest+".part")
+		assert.NoFileExists(t, dest+".part.json")
+
+		got := requests()
+		require.Len(t, got, 2)
+		assert.Empty(t, got[0])
+		assert.Equal(t, fmt.Sprintf("bytes=%d-", len(content)/2), got[1])
+	})
+
+	t.Run("再次运行时续传", func(t *testing.T) {
+		srv, requests := flakyServer(t, content)
+		nm := newTestNetManager(srv.URL)
+		nm.Retries = 0
+
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.Error(t, nm.DownloadFile(dest))
+		info, err := os.Stat(dest + ".part")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)/2), info.Size())
+		assert.FileExists(t, dest+".part.json")
+
+		require.NoError(t, nm.DownloadFile(dest))
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Len(t, requests(), 2)
+	})
+
+	t.Run("远端文件变化时重新下载", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v2"`)
+			http.ServeContent(w, r, "pkg.tar.gz", time.Time{}, bytes.NewReader(content))
+		}))
+		defer srv.Close()
+
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.NoError(t, os.WriteFile(dest+".part", []byte("stale data"), 0644))
+		require.NoError(t, saveDownloadMeta(dest+".part.json", &downloadMeta{URL: srv.URL, ETag: `"v1"`, Length: int64(len(content))}))
+
+		nm := newTestNetManager(srv.URL)
+		require.NoError(t, nm.DownloadFile(dest))
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("哈希不匹配时丢弃", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(content)
+		}))
+		defer srv.Close()
+
+		nm := newTestNetManager(srv.URL)
+		nm.Checksum = "md5:" + strings.Repeat("0", 32)
+		nm.Retries = 0
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.Error(t, nm.DownloadFile(dest))
+		assert.NoFileExists(t, dest)
+		assert.NoFileExists(t, dest+".part")
+	})
+}
+
+func TestDownloadFileCancel(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	// stallServer 发送一半数据后等待客户端断开
+	stallServer := func(t *testing.T) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("传输中取消 KeepPartial=%v", keep), func(t *testing.T) {
+			nm := newTestNetManager(stallServer(t).URL)
+			nm.KeepPartial = keep
+			dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := nm.DownloadFileContext(ctx, dest)
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.NoFileExists(t, dest)
+			if keep {
+				assert.FileExists(t, dest+".part")
+				assert.FileExists(t, dest+".part.json")
+			} else {
+				assert.NoFileExists(t, dest+".part")
+				assert.NoFileExists(t, dest+".part.json")
+			}
+		})
+	}
+
+	t.Run("退避等待时取消", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		nm := newTestNetManager(srv.URL)
+		nm.Retries = 5
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		start := time.Now()
+		err := nm.DownloadFileContext(ctx, filepath.Join(t.TempDir(), "pkg.tar.gz"))
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+}
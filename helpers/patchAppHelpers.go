@@ -1,20 +1,29 @@
 package helpers
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/Re-Wi/GoKitReWi/handlers"
 	"github.com/icedream/go-bsdiff"
 )
 
 type PatchApp struct {
-	TargetDir    string
-	PatchTempDir string
-	NewTempDir   string
+	TargetDir     string
+	PatchTempDir  string
+	NewTempDir    string
+	Conflicts     *ConflictResolver      // 本地修改冲突处理，为 nil 时不检测
+	PristineDir   func() (string, error) // 返回未经本地修改的已安装版本目录，用于冲突时重建新文件
+	MergeConflict string                 // 三方合并时两边修改同一键的处理方式：fail（默认）或 markers
+
+	pending map[string]*Conflict // 应用前扫描出的冲突，应用期间只读
 }
 
 func (pa *PatchApp) ParsePackageJSON(tempDir string) (*handlers.UpdatePackage, error) {
@@ -33,15 +42,32 @@ func (pa *PatchApp) ParsePackageJSON(tempDir string) (*handlers.UpdatePackage, e
 }
 
 func (pa *PatchApp) ProcessAdded(file handlers.FileEntry) error {
-	src := filepath.Join(pa.PatchTempDir, file.Path)
 	dest := filepath.Join(pa.NewTempDir, file.Path)
 
 	_, fileExists, _, _ := PathInfo(dest)
 
 	if fileExists {
+		// 已经是新版本内容（例如重复执行升级）
+		if VerifyFileHash(dest, file.Hash, md5.New) == nil {
+			return nil
+		}
 		return fmt.Errorf("file %s already exists", dest)
 	}
 
+	return pa.copyAdded(file, dest)
+}
+
+// copyAdded 将升级包中的新增文件复制到 dest 并校验
+func (pa *PatchApp) copyAdded(file handlers.FileEntry, dest string) error {
+	// 新增文件保存在升级包的 Patch.Path 中，旧格式的升级包直接按原路径存放
+	src := filepath.Join(pa.PatchTempDir, file.Path)
+	if file.Patch != nil && file.Patch.Path != "" {
+		src = filepath.Join(pa.PatchTempDir, file.Patch.Path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
 	if err := CopyFile(src, dest); err != nil {
 		return err
 	}
@@ -59,8 +85,16 @@ func (pa *PatchApp) ProcessAdded(file handlers.FileEntry) error {
 
 func (pa *PatchApp) ProcessModified(file handlers.FileEntry) error {
 	oldPath := filepath.Join(pa.TargetDir, file.Path)
-	patchPath := filepath.Join(pa.PatchTempDir, file.Patch.Path)
 	newFilePath := filepath.Join(pa.NewTempDir, file.Path)
+	return pa.applyPatch(file, oldPath, newFilePath)
+}
+
+// applyPatch 以 oldPath 为基准应用补丁，生成 newFilePath 并校验
+func (pa *PatchApp) applyPatch(file handlers.FileEntry, oldPath, newFilePath string) error {
+	if file.Patch == nil {
+		return fmt.Errorf("no patch for %s", file.Path)
+	}
+	patchPath := filepath.Join(pa.PatchTempDir, file.Patch.Path)
 
 	_, fileExists, _, _ := PathInfo(oldPath)
 
@@ -85,29 +119,41 @@ func (pa *PatchApp) ProcessModified(file handlers.FileEntry) error {
 	if err != nil {
 		return err
 	}
+	defer oldData.Close()
 
 	patchData, err := os.Open(patchPath)
 	if err != nil {
 		return err
 	}
+	defer patchData.Close()
 
+	if err := os.MkdirAll(filepath.Dir(newFilePath), 0755); err != nil {
+		return err
+	}
 	newFile, err := os.Create(newFilePath)
-	defer newFile.Close()
 	if err != nil {
 		return err
 	}
 	err = bsdiff.Patch(oldData, newFile, patchData)
+	if closeErr := newFile.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		return fmt.Errorf("apply patch: %w", err)
 	}
 
-	_, fileExists, _, _ = PathInfo(newFilePath)
+	return verifyNewFile(file, newFilePath)
+}
+
+// verifyNewFile 校验生成的新文件大小与哈希
+func verifyNewFile(file handlers.FileEntry, newFilePath string) error {
+	_, fileExists, _, _ := PathInfo(newFilePath)
 
 	if !fileExists {
 		return fmt.Errorf("file %s does not exist", newFilePath)
 	}
 
-	sizeValue, err = EnsureFileSize(newFilePath, "byte")
+	sizeValue, err := EnsureFileSize(newFilePath, "byte")
 	if err != nil {
 		return fmt.Errorf("ensure file size: %w", err)
 	}
@@ -124,5 +170,157 @@ func (pa *PatchApp) ProcessModified(file handlers.FileEntry) error {
 }
 
 func (pa *PatchApp) ProcessDeleted(file handlers.FileEntry) error {
+	// 新版本目录由目标目录复制而来，删除其中对应的文件即可
+	path := filepath.Join(pa.NewTempDir, file.Path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
 	return nil
 }
+
+// ProcessFile 根据文件状态分发处理
+func (pa *PatchApp) ProcessFile(file handlers.FileEntry) error {
+	if file.Status == "modified" && file.Merge != "" {
+		if err := pa.ProcessMerged(file); err != nil {
+			return fmt.Errorf("merge %s: %w", file.Path, err)
+		}
+		return nil
+	}
+
+	if pa.Conflicts != nil {
+		conflict, err := pa.conflictFor(file)
+		if err != nil {
+			return fmt.Errorf("check %s: %w", file.Path, err)
+		}
+		if conflict != nil {
+			err := pa.resolveConflict(file, conflict)
+			if err != nil && conflict.Action == "" {
+				conflict.Action = "failed: " + err.Error()
+			}
+			pa.Conflicts.record(*conflict)
+			return err
+		}
+	}
+
+	switch file.Status {
+	case "added":
+		if err := pa.ProcessAdded(file); err != nil {
+			return fmt.Errorf("process added %s: %w", file.Path, err)
+		}
+	case "modified":
+		if err := pa.ProcessModified(file); err != nil {
+			return fmt.Errorf("process modified %s: %w", file.Path, err)
+		}
+	case "deleted":
+		if err := pa.ProcessDeleted(file); err != nil {
+			return fmt.Errorf("process deleted %s: %w", file.Path, err)
+		}
+	default:
+		return fmt.Errorf("unknown status %q for %s", file.Status, file.Path)
+	}
+	return nil
+}
+
+// ApplyFiles 按确定的顺序应用升级包中的所有文件
+//
+// 删除操作之间、以及删除与同路径（或父路径）的新增之间存在依赖，
+// 因此先按路径深度从深到浅串行执行删除，再由 workers 个协程并行处理新增和修改。
+// 任一条目失败后立即取消尚未开始的条目，返回按清单顺序排列的错误。
+func (pa *PatchApp) ApplyFiles(ctx context.Context, files []handlers.FileEntry, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	deletes, updates, err := splitEntries(files)
+	if err != nil {
+		return err
+	}
+
+	if pa.Conflicts != nil {
+		if err := pa.scanConflicts(files); err != nil {
+			return err
+		}
+		defer func() { pa.pending = nil }()
+	}
+
+	for _, i := range deletes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := pa.ProcessFile(files[i]); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for _, i := range updates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			// 获取信号量期间可能已被取消
+			if ctx.Err() != nil {
+				return
+			}
+			if err := pa.ProcessFile(files[i]); err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d file(s) failed:\n%s", len(failed), strings.Join(failed, "\n"))
+	}
+	// 外部取消时没有条目报错，但仍需返回取消原因
+	return ctx.Err()
+}
+
+// splitEntries 将清单拆分为删除条目和新增/修改条目（返回下标）
+// 删除条目按路径深度从深到浅排列，同深度按路径排序，保证每次执行顺序一致
+func splitEntries(files []handlers.FileEntry) (deletes, updates []int, err error) {
+	seen := make(map[string]int, len(files))
+	for i, file := range files {
+		key := filepath.Clean(file.Path)
+		if j, ok := seen[key]; ok && files[j].Status != "deleted" && file.Status != "deleted" {
+			return nil, nil, fmt.Errorf("duplicate entry for %s", file.Path)
+		}
+		seen[key] = i
+
+		if file.Status == "deleted" {
+			deletes = append(deletes, i)
+		} else {
+			updates = append(updates, i)
+		}
+	}
+
+	sort.SliceStable(deletes, func(a, b int) bool {
+		x, y := filepath.Clean(files[deletes[a]].Path), filepath.Clean(files[deletes[b]].Path)
+		dx, dy := strings.Count(x, string(os.PathSeparator)), strings.Count(y, string(os.PathSeparator))
+		if dx != dy {
+			return dx > dy
+		}
+		return x < y
+	})
+	return deletes, updates, nil
+}
@@ -0,0 +1,99 @@
+package helpers
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Re-Wi/GoKitReWi/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 在补丁目录中准备一个新增文件，返回对应的清单条目
+func addedEntry(t *testing.T, patchDir, rel, content string) handlers.FileEntry {
+	path := filepath.Join(patchDir, rel)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	hash, err := CalculateFileHash(path, md5.New)
+	require.NoError(t, err)
+	return handlers.FileEntry{Path: rel, Status: "added", Size: len(content), Hash: hash}
+}
+
+func TestApplyFiles(t *testing.T) {
+	newPatchApp := func(t *testing.T) *PatchApp {
+		pa := &PatchApp{
+			TargetDir:    t.TempDir(),
+			PatchTempDir: t.TempDir(),
+			NewTempDir:   t.TempDir(),
+		}
+		// 模拟已复制到新版本目录的旧文件
+		createFiles(t, pa.NewTempDir, []string{"old/a.txt", "old/sub/b.txt", "keep.txt"})
+		return pa
+	}
+
+	t.Run("删除后并行新增", func(t *testing.T) {
+		pa := newPatchApp(t)
+		files := []handlers.FileEntry{
+			{Path: "old/a.txt", Status: "deleted"},
+			{Path: "old/sub/b.txt", Status: "deleted"},
+		}
+		for i := 0; i < 20; i++ {
+			files = append(files, addedEntry(t, pa.PatchTempDir, fmt.Sprintf("new/%02d.txt", i), fmt.Sprintf("file %d", i)))
+		}
+		// 同路径先删除再新增
+		files = append(files, addedEntry(t, pa.PatchTempDir, "old/a.txt", "recreated"))
+
+		require.NoError(t, pa.ApplyFiles(context.Background(), files, 4))
+
+		data, err := os.ReadFile(filepath.Join(pa.NewTempDir, "old", "a.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "recreated", string(data))
+		assert.NoFileExists(t, filepath.Join(pa.NewTempDir, "old", "sub", "b.txt"))
+		assert.FileExists(t, filepath.Join(pa.NewTempDir, "keep.txt"))
+		assert.FileExists(t, filepath.Join(pa.NewTempDir, "new", "19.txt"))
+	})
+
+	t.Run("新增文件位于 Patch.Path", func(t *testing.T) {
+		pa := newPatchApp(t)
+		// 生成的升级包把新增文件存放在 files/ 下，清单中的 Path 为安装路径
+		entry := addedEntry(t, pa.PatchTempDir, "files/conf/new.conf", "shipped")
+		entry.Patch = &handlers.FilePatch{Path: entry.Path, Size: entry.Size, Hash: entry.Hash}
+		entry.Path = "conf/new.conf"
+
+		require.NoError(t, pa.ApplyFiles(context.Background(), []handlers.FileEntry{entry}, 1))
+		data, err := os.ReadFile(filepath.Join(pa.NewTempDir, "conf", "new.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, "shipped", string(data))
+	})
+
+	t.Run("失败后停止", func(t *testing.T) {
+		pa := newPatchApp(t)
+		bad := addedEntry(t, pa.PatchTempDir, "bad.txt", "content")
+		bad.Hash = "0000"
+		files := []handlers.FileEntry{bad}
+		for i := 0; i < 20; i++ {
+			files = append(files, addedEntry(t, pa.PatchTempDir, fmt.Sprintf("new/%02d.txt", i), "x"))
+		}
+
+		err := pa.ApplyFiles(context.Background(), files, 1)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "bad.txt")
+	})
+
+	t.Run("重复条目", func(t *testing.T) {
+		pa := newPatchApp(t)
+		entry := addedEntry(t, pa.PatchTempDir, "dup.txt", "x")
+		err := pa.ApplyFiles(context.Background(), []handlers.FileEntry{entry, entry}, 2)
+		assert.Error(t, err)
+	})
+
+	t.Run("未知状态", func(t *testing.T) {
+		pa := newPatchApp(t)
+		err := pa.ApplyFiles(context.Background(), []handlers.FileEntry{{Path: "x", Status: "renamed"}}, 2)
+		assert.Error(t, err)
+	})
+}
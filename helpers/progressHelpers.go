@@ -0,0 +1,138 @@
+package helpers
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressInterval 两次进度回调之间的最短间隔
+var progressInterval = 200 * time.Millisecond
+
+// Progress 一次传输的进度
+type Progress struct {
+	Name   string        // 传输的 URL 或文件名
+	Done   int64         // 已传输的字节数，续传时包含已有的部分
+	Total  int64         // 总字节数，未知时为 -1
+	Rate   float64       // 本次传输的平均速率（字节/秒）
+	ETA    time.Duration // 预计剩余时间，总长度或速率未知时为 -1
+	Upload bool          // 上传请求体的进度，否则为下载
+	Final  bool          // 传输结束（成功或失败）时的最后一次回调
+}
+
+// Percent 已完成的百分比，总长度未知时返回 -1
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.Done) * 100 / float64(p.Total)
+}
+
+// ProgressFunc 接收传输进度，回调最多每 progressInterval 调用一次，传输结束时再调用一次；
+// 同一次传输的回调不会并发调用，多次传输共用的回调需要自行加锁
+type ProgressFunc func(p Progress)
+
+// progressTracker 统计一次传输的进度，可被多个分段并发更新
+type progressTracker struct {
+	fn     ProgressFunc
+	name   string
+	upload bool
+
+	mu       sync.Mutex
+	done     int64
+	total    int64
+	base     int64 // 本次传输开始前已有的字节数，不计入速率
+	start    time.Time
+	reported time.Time
+}
+
+// newProgressTracker fn 为 nil 时返回 nil，nil tracker 的方法都是空操作
+func newProgressTracker(fn ProgressFunc, name string, total int64, upload bool) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+	return &progressTracker{fn: fn, name: name, upload: upload, total: total, start: time.Now()}
+}
+
+// reset 设置总长度与已有的字节数，用于续传或重新开始
+func (t *progressTracker) reset(done, total int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.done, t.base, t.total = done, done, total
+	t.start = time.Now()
+	t.mu.Unlock()
+}
+
+// add 记录新传输的 n 个字节，距上次回调超过 progressInterval 时报告进度
+func (t *progressTracker) add(n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.done += n
+	now := time.Now()
+	if now.Sub(t.reported) < progressInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.reported = now
+	// 在锁内回调，分段并发下载时回调按顺序执行
+	t.fn(t.snapshot(now, false))
+	t.mu.Unlock()
+}
+
+// finish 报告最后一次进度
+func (t *progressTracker) finish() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.fn(t.snapshot(time.Now(), true))
+	t.mu.Unlock()
+}
+
+func (t *progressTracker) snapshot(now time.Time, final bool) Progress {
+	p := Progress{Name: t.name, Done: t.done, Total: t.total, ETA: -1, Upload: t.upload, Final: final}
+	if elapsed := now.Sub(t.start).Seconds(); elapsed > 0 {
+		p.Rate = float64(t.done-t.base) / elapsed
+	}
+	if p.Rate > 0 && t.total >= 0 && t.done <= t.total {
+		p.ETA = time.Duration(float64(t.total-t.done) / p.Rate * float64(time.Second))
+	}
+	return p
+}
+
+// Write 实现 io.Writer，与 io.MultiWriter 配合统计写入的字节数
+func (t *progressTracker) Write(p []byte) (int, error) {
+	t.add(int64(len(p)))
+	return len(p), nil
+}
+
+// progressReader 读取时统计字节数，用于上传的请求体与读取的响应体
+type progressReader struct {
+	io.ReadCloser
+	tracker *progressTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.tracker.add(int64(n))
+	return n, err
+}
+
+// FormatBytes 以 B/KB/MB/GB/TB 显示字节数（1024 进制）
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
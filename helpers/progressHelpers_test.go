@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", FormatBytes(512))
+	assert.Equal(t, "1.5 KB", FormatBytes(1536))
+	assert.Equal(t, "10.0 MB", FormatBytes(10<<20))
+	assert.Equal(t, "2.0 TB", FormatBytes(2<<40))
+}
+
+func TestDownloadProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 200000)
+
+	collect := func() (ProgressFunc, func() []Progress) {
+		var (
+			mu      sync.Mutex
+			reports []Progress
+		)
+		return func(p Progress) {
+				mu.Lock()
+				reports = append(reports, p)
+				mu.Unlock()
+			}, func() []Progress {
+				mu.Lock()
+				defer mu.Unlock()
+				return append([]Progress(nil), reports...)
+			}
+	}
+
+	for _, segments := range []int{1, 4} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(w, r, "pkg.tar.gz", time.Time{}, bytes.NewReader(content))
+		}))
+		defer srv.Close()
+
+		fn, reports := collect()
+		nm := newTestNetManager(srv.URL)
+		nm.Segments = segments
+		nm.Progress = fn
+		require.NoError(t, nm.DownloadFile(filepath.Join(t.TempDir(), "pkg.tar.gz")))
+
+		got := reports()
+		require.NotEmpty(t, got, segments)
+		last := got[len(got)-1]
+		assert.True(t, last.Final, segments)
+		assert.Equal(t, int64(len(content)), last.Done, segments)
+		assert.Equal(t, int64(len(content)), last.Total, segments)
+		assert.Equal(t, float64(100), last.Percent(), segments)
+		for _, p := range got[:len(got)-1] {
+			assert.False(t, p.Final, segments)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateUnits --limit-rate 支持的单位（1024 进制，与 curl 一致）
+var rateUnits = map[string]int64{
+	"":   1,
+	"b":  1,
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+}
+
+// ParseRate 解析 500KB/s、1.5M、800k 等速率，返回字节/秒；0 或 unlimited 表示不限速
+func ParseRate(value string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	s = strings.TrimSuffix(s, "/s")
+	if s == "" || s == "0" || s == "unlimited" {
+		return 0, nil
+	}
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	number, unit := s, ""
+	if i >= 0 {
+		number, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+	multiplier, ok := rateUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid rate %q, expected e.g. 500KB/s", value)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q, expected e.g. 500KB/s", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// RateWindow 每天的一个时间段及其速率，End 不大于 Start 时跨越午夜
+type RateWindow struct {
+	Start time.Duration // 距当天 0 点的时间
+	End   time.Duration
+	Rate  int64 // 字节/秒，0 表示不限速
+}
+
+func (w RateWindow) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// ParseRateSchedule 解析 "22:00-06:00=0,12:00-13:00=2MB/s"，时间为本地时间
+func ParseRateSchedule(value string) ([]RateWindow, error) {
+	var windows []RateWindow
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		span, rate, ok := strings.Cut(item, "=")
+		from, to, ok2 := strings.Cut(span, "-")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid schedule %q, expected HH:MM-HH:MM=RATE", item)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		bytesPerSec, err := ParseRate(rate)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, RateWindow{Start: start, End: end, Rate: bytesPerSec})
+	}
+	return windows, nil
+}
+
+// parseClock 解析 HH:MM
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// RateLimiter 令牌桶限速，同一 NetManager 的所有下载（包括并发的分段）共用一个桶
+type RateLimiter struct {
+	Rate     int64        // 字节/秒，0 表示不限速
+	Schedule []RateWindow // 当前时间落在某个时间段内时使用该时间段的速率
+
+	mu     sync.Mutex
+	tokens float64 // 可以为负，表示需要等待偿还的字节数
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewRateLimiter 创建限速器，rate 与所有时间段都不限速时返回 nil
+func NewRateLimiter(rate int64, schedule []RateWindow) *RateLimiter {
+	limited := rate > 0
+	for _, w := range schedule {
+		limited = limited || w.Rate > 0
+	}
+	if !limited {
+		return nil
+	}
+	return &RateLimiter{Rate: rate, Schedule: schedule, now: time.Now}
+}
+
+// currentRate 当前生效的速率
+func (l *RateLimiter) currentRate(t time.Time) int64 {
+	for _, w := range l.Schedule {
+		if w.contains(t) {
+			return w.Rate
+		}
+	}
+	return l.Rate
+}
+
+// reserve 扣除 n 个令牌，返回需要等待的时间
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate := l.currentRate(now)
+	if rate <= 0 {
+		l.tokens = 0
+		l.last = now
+		return 0
+	}
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+	}
+	// 桶容量为一秒的流量，空闲后不会突发超过一秒的数据
+	if burst := float64(rate); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+}
+
+// WaitN 消耗 n 个字节的额度，额度不足时等待，ctx 取消时返回 ctx.Err()
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitChunk 限速时单次读取的上限，避免低速率下一次读取需要等待过久
+const rateLimitChunk = 16 << 10
+
+// rateLimitedReader 按限速器的额度读取
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateLimitChunk {
+		p = p[:rateLimitChunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// throttle 配置了 RateLimit 时按限速读取下载的响应体
+func (nm *NetManager) throttle(resp *http.Response) io.Reader {
+	if nm.RateLimit == nil {
+		return resp.Body
+	}
+	ctx := context.Background()
+	if resp.Request != nil {
+		ctx = resp.Request.Context()
+	}
+	return &rateLimitedReader{ctx: ctx, r: resp.Body, limiter: nm.RateLimit}
+}
@@ -0,0 +1,91 @@
+package helpers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]int64{
+		"":          0,
+		"0":         0,
+		"unlimited": 0,
+		"500KB/s":   500 << 10,
+		"800k":      800 << 10,
+		"1.5M":      3 << 19,
+		"2MB/s":     2 << 20,
+		"1024":      1024,
+	}
+	for in, want := range cases {
+		got, err := ParseRate(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"fast", "10XB/s", "-1k"} {
+		_, err := ParseRate(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestRateSchedule(t *testing.T) {
+	windows, err := ParseRateSchedule("22:00-06:00=0, 12:00-13:00=2MB/s")
+	require.NoError(t, err)
+	require.Len(t, windows, 2)
+
+	limiter := NewRateLimiter(500<<10, windows)
+	require.NotNil(t, limiter)
+	at := func(clock string) time.Time {
+		tm, err := time.ParseInLocation("15:04", clock, time.Local)
+		require.NoError(t, err)
+		return tm
+	}
+	assert.Equal(t, int64(0), limiter.currentRate(at("23:30")))
+	assert.Equal(t, int64(0), limiter.currentRate(at("05:59")))
+	assert.Equal(t, int64(2<<20), limiter.currentRate(at("12:30")))
+	assert.Equal(t, int64(500<<10), limiter.currentRate(at("09:00")))
+
+	assert.Nil(t, NewRateLimiter(0, []RateWindow{{Start: 0, End: time.Hour}}))
+
+	_, err = ParseRateSchedule("22:00=0")
+	assert.Error(t, err)
+	_, err = ParseRateSchedule("25:00-06:00=0")
+	assert.Error(t, err)
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(1000, nil)
+	limiter.now = func() time.Time { return now }
+
+	assert.Equal(t, time.Second, limiter.reserve(1000))
+	assert.Equal(t, 2*time.Second, limiter.reserve(1000))
+
+	// 额度按时间补充，空闲后最多积累一秒的流量
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, time.Duration(0), limiter.reserve(1000))
+	assert.Equal(t, 500*time.Millisecond, limiter.reserve(500))
+}
+
+func TestDownloadRateLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1<<15) // 512KB
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "pkg.tar.gz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	// 两个分段共用 1MB/s 的额度，512KB 至少需要约 0.5 秒
+	nm := newTestNetManager(srv.URL)
+	nm.Segments = 2
+	nm.RateLimit = NewRateLimiter(1<<20, nil)
+	start := time.Now()
+	require.NoError(t, nm.DownloadFile(filepath.Join(t.TempDir(), "pkg.tar.gz")))
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
@@ -0,0 +1,378 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// HTTPStatusError FailOnError 时 4xx/5xx 响应返回的错误
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	URL        string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("the requested URL %s returned error: %s", e.URL, e.Status)
+}
+
+// ExitCode 与 curl --fail 一致的退出码
+func (e *HTTPStatusError) ExitCode() int {
+	return 22
+}
+
+// RequestOutput SendRequestContext 输出响应的方式
+type RequestOutput struct {
+	OutputFile string    // 将响应体写入该文件
+	PrettyJSON bool      // 发送 Accept: application/json，并格式化输出 JSON 响应体
+	Include    bool      // 以 HTTP 报文格式输出状态行与响应头
+	Silent     bool      // 只输出响应体
+	Out        io.Writer // 输出目标，为 nil 时为 os.Stdout
+}
+
+// NewRequest 按 ReqMethod、ReqURL、ReqBody/ReqForm 与 ReqHeaders 构造请求
+//
+// ReqBody 以 @ 开头时从文件读取（@- 为标准输入）；ReqForm 的每一项为 name=value 或
+// name=@file[;type=mime]，以 multipart/form-data 发送。请求体可以重新读取，重试时会重新发送。
+func (nm *NetManager) NewRequest(ctx context.Context) (*http.Request, error) {
+	method := strings.ToUpper(nm.ReqMethod)
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, nm.ReqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	switch {
+	case len(nm.ReqForm) > 0 && nm.ReqBody != "":
+		return nil, fmt.Errorf("request body and form fields cannot be combined")
+	case len(nm.ReqForm) > 0:
+		body, contentType, err := buildMultipart(nm.ReqForm)
+		if err != nil {
+			return nil, err
+		}
+		setBody(req, body)
+		req.Header.Set("Content-Type", contentType)
+	case strings.HasPrefix(nm.ReqBody, "@"):
+		if err := setFileBody(req, nm.ReqBody[1:]); err != nil {
+			return nil, err
+		}
+	case nm.ReqBody != "":
+		setBody(req, []byte(nm.ReqBody))
+	}
+
+	if err := nm.addHeaders(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// setJSONHeaders 没有指定时请求 JSON 响应，并把请求体标记为 JSON
+func setJSONHeaders(req *http.Request) {
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	if req.ContentLength != 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+}
+
+// setBody 设置可重复读取的内存请求体
+func setBody(req *http.Request, data []byte) {
+	req.ContentLength = int64(len(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.Body, _ = req.GetBody()
+}
+
+// setFileBody 以文件内容作为请求体，重试时重新打开文件；标准输入只能读取一次，先读入内存
+func setFileBody(req *http.Request, path string) error {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("read body from stdin: %w", err)
+		}
+		setBody(req, data)
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("read body file: %w", err)
+	}
+	req.ContentLength = info.Size()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+	if req.Body, err = req.GetBody(); err != nil {
+		return fmt.Errorf("read body file: %w", err)
+	}
+	return nil
+}
+
+// buildMultipart 编码 multipart/form-data 请求体
+func buildMultipart(fields []string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return nil, "", fmt.Errorf("invalid form field %q, expected name=value or name=@file", field)
+		}
+		if !strings.HasPrefix(value, "@") {
+			if err := w.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+
+		path, contentType := value[1:], "application/octet-stream"
+		if p, params, ok := strings.Cut(path, ";"); ok {
+			path = p
+			if params = strings.TrimSpace(params); strings.HasPrefix(params, "type=") {
+				contentType = strings.TrimPrefix(params, "type=")
+			}
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("form field %s: %w", name, err)
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(name), escapeQuotes(filepath.Base(path))))
+		header.Set("Content-Type", contentType)
+		part, err := w.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		file.Close()
+		if err != nil {
+			return nil, "", fmt.Errorf("form field %s: %w", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+func escapeQuotes(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// writeResponse 按 Include/Silent/PrettyJSON 输出响应
+func (o RequestOutput) writeResponse(out io.Writer, resp *http.Response, body []byte) {
+	if o.PrettyJSON {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, bytes.TrimSpace(body), "", "  ") == nil {
+			body = pretty.Bytes()
+		}
+	}
+
+	keys := make([]string, 0, len(resp.Header))
+	for k := range resp.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	switch {
+	case o.Include:
+		// 与 curl -i 一致：状态行、响应头、空行、响应体
+		fmt.Fprintf(out, "%s %s\n", resp.Proto, resp.Status)
+		for _, k := range keys {
+			for _, v := range resp.Header[k] {
+				fmt.Fprintf(out, "%s: %s\n", k, v)
+			}
+		}
+		fmt.Fprintln(out)
+	case !o.Silent:
+		fmt.Fprintf(out, "状态码: %d %s\n", resp.StatusCode, resp.Status)
+		fmt.Fprintln(out, "\n响应头:")
+		for _, k := range keys {
+			fmt.Fprintf(out, "  %s: %s\n", k, strings.Join(resp.Header[k], ", "))
+		}
+		if o.OutputFile == "" {
+			fmt.Fprintln(out, "\n响应体:")
+		}
+	}
+
+	if o.OutputFile != "" {
+		if !o.Silent {
+			fmt.Fprintf(out, "\n响应体已保存到: %s\n", o.OutputFile)
+		}
+		return
+	}
+	out.Write(body)
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		fmt.Fprintln(out)
+	}
+}
+
+// sensitiveName 请求头或查询参数名是否可能包含凭据
+func sensitiveName(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie":
+		return true
+	}
+	for _, word := range []string{"token", "secret", "password", "passwd", "api-key", "apikey", "api_key", "signature"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeader 隐藏凭据，Authorization 保留认证方式便于对方替换
+func redactHeader(name, value string) string {
+	if !sensitiveName(name) {
+		return value
+	}
+	if scheme, _, ok := strings.Cut(value, " "); ok && strings.Contains(strings.ToLower(name), "authorization") {
+		return scheme + " <redacted>"
+	}
+	return "<redacted>"
+}
+
+// redactQuery 隐藏 URL 中的密码与敏感查询参数
+func redactQuery(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	query := u.Query()
+	changed := false
+	for name := range query {
+		if sensitiveName(name) {
+			query.Set(name, "REDACTED")
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// shellQuote 以单引号转义，结果可以直接粘贴到 sh/bash
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:@=,+%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// CurlCommand 返回与按 output 发送当前请求等价的 curl 命令，凭据（认证头、Cookie、URL 密码与敏感查询参数）被隐藏
+func (nm *NetManager) CurlCommand(output RequestOutput) (string, error) {
+	req, err := nm.NewRequest(context.Background())
+	if err != nil {
+		return "", err
+	}
+	if output.PrettyJSON {
+		setJSONHeaders(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	// 认证方式添加的请求头同样输出（已隐藏），对方知道需要补充哪些凭据
+	if nm.Auth != nil {
+		if req.GetBody != nil {
+			req.Body, _ = req.GetBody()
+		}
+		if err := nm.Auth.Authenticate(req); err != nil {
+			return "", err
+		}
+		if req.Body != nil {
+			req.Body.Close()
+		}
+	}
+
+	args := []string{"curl"}
+	if req.Method != http.MethodGet || len(nm.ReqForm) > 0 || nm.ReqBody != "" {
+		args = append(args, "-X", req.Method)
+	}
+	args = append(args, shellQuote(redactQuery(req.URL.String())))
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		// multipart 的 Content-Type 带有随机分隔符，由 curl -F 自动生成
+		if k == "Content-Type" && len(nm.ReqForm) > 0 {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			args = append(args, "-H", shellQuote(k+": "+redactHeader(k, v)))
+		}
+	}
+
+	switch {
+	case len(nm.ReqForm) > 0:
+		for _, field := range nm.ReqForm {
+			args = append(args, "-F", shellQuote(field))
+		}
+	case strings.HasPrefix(nm.ReqBody, "@"):
+		args = append(args, "--data-binary", shellQuote(nm.ReqBody))
+	case nm.ReqBody != "":
+		args = append(args, "--data-raw", shellQuote(nm.ReqBody))
+	}
+
+	if nm.FollowRedirects {
+		args = append(args, "-L")
+	}
+	if nm.AllowInsecure {
+		args = append(args, "-k")
+	}
+	for _, flag := range [...]struct{ name, value string }{
+		{"--cacert", nm.CACertFile},
+		{"--cert", nm.ClientCertFile},
+		{"--key", nm.ClientKeyFile},
+		{"--noproxy", nm.NoProxy},
+	} {
+		if flag.value != "" {
+			args = append(args, flag.name, shellQuote(flag.value))
+		}
+	}
+	if nm.ProxyURL != "" {
+		args = append(args, "--proxy", shellQuote(RedactURL(nm.ProxyURL)))
+	}
+	for name, version := range tlsVersions {
+		if nm.MinTLSVersion == version {
+			args = append(args, "--tlsv"+name)
+		}
+	}
+	if nm.Timeout > 0 {
+		args = append(args, "--max-time", fmt.Sprint(nm.Timeout.Seconds()))
+	}
+	if nm.Retries > 0 {
+		args = append(args, "--retry", fmt.Sprint(nm.Retries))
+	}
+	if nm.FailOnError {
+		args = append(args, "--fail")
+	}
+	if output.Include {
+		args = append(args, "-i")
+	}
+	if output.Silent {
+		args = append(args, "-s")
+	}
+	if output.OutputFile != "" {
+		args = append(args, "-o", shellQuote(output.OutputFile))
+	}
+	return strings.Join(args, " "), nil
+}
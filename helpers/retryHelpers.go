@@ -0,0 +1,225 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// retryBaseDelay 第一次重试前的等待时间，之后每次翻倍
+	retryBaseDelay = 500 * time.Millisecond
+	// maxRetryDelay 单次等待的上限，同样限制服务器 Retry-After 的取值
+	maxRetryDelay = time.Minute
+)
+
+// retryableStatus 值得重试的状态码：5xx（除 501）、429、408
+func retryableStatus(code int) bool {
+	return (code >= 500 && code != http.StatusNotImplemented) ||
+		code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+}
+
+// backoffDelay 第 attempt 次重试前的等待时间：指数退避并加入随机抖动，避免多个客户端同时重试
+func backoffDelay(attempt int) time.Duration {
+	delay := maxRetryDelay
+	if attempt < 16 {
+		if d := retryBaseDelay << uint(attempt); d < maxRetryDelay {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryAfter 解析 Retry-After（秒数或 HTTP 日期），没有或无法解析时返回 false
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = time.Until(at)
+	} else {
+		return 0, false
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay, true
+}
+
+// idempotentMethods 网络错误后可以安全重发的请求方法
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// retryTransport 为每个请求统一处理重试、退避、Retry-After、单次超时与日志
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int           // 最大重试次数
+	timeout time.Duration // 每次尝试等待响应头、以及读取响应体时两次收到数据之间的超时；0 表示不限制
+	logger  *zap.Logger
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		try, deadline, err := t.attempt(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.next.RoundTrip(try)
+		err = deadline.wrap(err)
+		// 证书校验失败与缺少录制的响应重试也不会成功
+		var certErr *CertificateError
+		var missErr *FixtureMissError
+		if (err == nil && !retryableStatus(resp.StatusCode)) || attempt >= t.retries || !t.canRetry(req, resp) || errors.As(err, &certErr) || errors.As(err, &missErr) {
+			if err != nil {
+				deadline.stop()
+				return nil, err
+			}
+			resp.Body = &timedBody{ReadCloser: resp.Body, timer: deadline}
+			return resp, nil
+		}
+
+		delay, ok := retryAfter(resp)
+		if !ok {
+			delay = backoffDelay(attempt)
+		}
+		fields := []zap.Field{
+			zap.String("method", req.Method),
+			zap.String("url", req.URL.Redacted()),
+			zap.Int("attempt", attempt+1),
+			zap.Int("max_retries", t.retries),
+			zap.Duration("delay", delay),
+		}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		} else {
+			fields = append(fields, zap.Int("status", resp.StatusCode))
+			// 读完响应体以便复用连接
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		deadline.stop()
+		t.logger.Info("Retrying request", fields...)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// attempt 为第 attempt 次尝试准备请求：重放请求体并设置单次超时
+func (t *retryTransport) attempt(req *http.Request, attempt int) (*http.Request, *attemptTimer, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := &attemptTimer{timeout: t.timeout, cancel: cancel}
+	if t.timeout > 0 {
+		timer.timer = time.AfterFunc(t.timeout, func() {
+			atomic.StoreInt32(&timer.expired, 1)
+			cancel()
+		})
+	}
+	try := req.WithContext(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			timer.stop()
+			return nil, nil, err
+		}
+		try.Body = body
+	}
+	return try, timer, nil
+}
+
+// canRetry 请求体可以重放时才重试；网络错误只对幂等请求重试，429/503 说明服务器没有处理请求
+func (t *retryTransport) canRetry(req *http.Request, resp *http.Response) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		return true
+	}
+	return idempotentMethods[req.Method] || req.Header.Get("Idempotency-Key") != ""
+}
+
+// attemptTimer 单次尝试的超时：等待响应头最多 timeout；收到响应头后每读到数据重新计时，
+// 只有连续 timeout 没有数据时才中断，慢速但仍在传输的下载不会被截断
+type attemptTimer struct {
+	timeout time.Duration
+	timer   *time.Timer // timeout 为 0 时为 nil
+	cancel  context.CancelFunc
+	expired int32
+}
+
+func (a *attemptTimer) touch() {
+	if a.timer != nil {
+		a.timer.Reset(a.timeout)
+	}
+}
+
+func (a *attemptTimer) stop() {
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.cancel()
+}
+
+// wrap 超时导致的错误改为带 context.DeadlineExceeded 的超时错误
+func (a *attemptTimer) wrap(err error) error {
+	if err != nil && atomic.LoadInt32(&a.expired) == 1 {
+		return fmt.Errorf("no data received for %s: %w", a.timeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// timedBody 读到数据时重新计时，关闭响应体时释放单次尝试的超时
+type timedBody struct {
+	io.ReadCloser
+	timer *attemptTimer
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.touch()
+	}
+	if err != nil && err != io.EOF {
+		err = b.timer.wrap(err)
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.timer.stop()
+	return err
+}
@@ -0,0 +1,229 @@
+package helpers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 0; attempt < 20; attempt++ {
+		delay := backoffDelay(attempt)
+		limit := maxRetryDelay
+		if attempt < 7 {
+			limit = retryBaseDelay << uint(attempt)
+		}
+		assert.GreaterOrEqual(t, delay, limit/2, attempt)
+		assert.LessOrEqual(t, delay, limit, attempt)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	_, ok := retryAfter(resp)
+	assert.False(t, ok)
+
+	resp.Header.Set("Retry-After", "2")
+	delay, ok := retryAfter(resp)
+	require.True(t, ok)
+	assert.Equal(t, 2*time.Second, delay)
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	delay, ok = retryAfter(resp)
+	require.True(t, ok)
+	assert.Equal(t, maxRetryDelay, delay)
+}
+
+func TestRetryTransport(t *testing.T) {
+	old := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = old }()
+
+	newManager := func(url string, retries int) *NetManager {
+		nm := NewNetManager()
+		nm.ReqURL = url
+		nm.Retries = retries
+		return nm
+	}
+
+	t.Run("服务器错误后重试成功", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			io.WriteString(w, "v1.0.0\n")
+		}))
+		defer srv.Close()
+
+		version, err := newManager(srv.URL, 2).GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v1.0.0", version)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("遵守 Retry-After", func(t *testing.T) {
+		var requests int32
+		var first time.Time
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				first = time.Now()
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			assert.GreaterOrEqual(t, time.Since(first), time.Second)
+			io.WriteString(w, "ok")
+		}))
+		defer srv.Close()
+
+		_, err := newManager(srv.URL, 1).GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+	})
+
+	t.Run("重试次数用尽后返回最后的响应", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		nm := newManager(srv.URL, 2)
+		_, err := nm.GetRemoteVersion(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, nm.RespCode)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("不可重试的状态码", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusNotImplemented)
+		}))
+		defer srv.Close()
+
+		_, err := newManager(srv.URL, 3).GetRemoteVersion(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("单次超时后重试", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(2 * time.Second):
+				}
+				return
+			}
+			io.WriteString(w, "ok")
+		}))
+		defer srv.Close()
+
+		nm := newManager(srv.URL, 1)
+		nm.Timeout = 100 * time.Millisecond
+		version, err := nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "ok", version)
+	})
+
+	t.Run("超时不截断持续传输的响应体", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 6; i++ {
+				io.WriteString(w, "x")
+				w.(http.Flusher).Flush()
+				time.Sleep(50 * time.Millisecond)
+			}
+		}))
+		defer srv.Close()
+
+		nm := newManager(srv.URL, 0)
+		nm.Timeout = 150 * time.Millisecond
+		client, err := nm.prepareHTTPClient()
+		require.NoError(t, err)
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "xxxxxx", string(body))
+	})
+
+	t.Run("响应体停止传输时超时", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "x")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		}))
+		defer srv.Close()
+
+		nm := newManager(srv.URL, 0)
+		nm.Timeout = 100 * time.Millisecond
+		client, err := nm.prepareHTTPClient()
+		require.NoError(t, err)
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("POST 请求重放请求体", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "payload", string(body))
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer srv.Close()
+
+		nm := newManager(srv.URL, 1)
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("payload"))
+		require.NoError(t, err)
+		client, err := nm.prepareHTTPClient()
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("POST 请求不因服务器错误重试", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		nm := newManager(srv.URL, 2)
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("payload"))
+		require.NoError(t, err)
+		client, err := nm.prepareHTTPClient()
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+}
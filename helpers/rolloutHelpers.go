@@ -0,0 +1,142 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 发布通道，从稳定到不稳定
+const (
+	ChannelStable  = "stable"
+	ChannelBeta    = "beta"
+	ChannelNightly = "nightly"
+)
+
+// DeviceIDEnv 覆盖设备标识的环境变量，用于容器等没有持久化配置目录的环境
+const DeviceIDEnv = "REWI_DEVICE_ID"
+
+// DeviceID 返回本机稳定的设备标识：优先使用 $REWI_DEVICE_ID，
+// 否则读取用户配置目录下的 upgradeReWi/device-id，不存在时随机生成并保存
+func DeviceID() (string, error) {
+	if id := strings.TrimSpace(os.Getenv(DeviceIDEnv)); id != "" {
+		return id, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locate config dir: %w", err)
+	}
+	return loadDeviceID(filepath.Join(dir, "upgradeReWi", "device-id"))
+}
+
+// loadDeviceID 读取或生成 path 中的设备标识
+func loadDeviceID(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("save device id: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("save device id: %w", err)
+	}
+	return id, nil
+}
+
+// RolloutBucket 设备在某个项目版本上的分桶（0-99）
+//
+// 分桶由设备标识、项目与版本的哈希决定：同一设备对同一版本的结果总是相同，
+// 提高百分比时已经升级的设备仍然在范围内；不同版本分桶不同，不会总是同一批设备先升级。
+func RolloutBucket(deviceID, project, version string) int {
+	sum := sha256.Sum256([]byte(project + "/" + version + "/" + deviceID))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+// RolloutPercent 版本在通道上的灰度百分比，未设置时为 100
+func (r *Release) RolloutPercent(channel string) int {
+	if percent, ok := r.Rollout[channel]; ok {
+		return percent
+	}
+	return 100
+}
+
+// Eligible 设备是否在版本的灰度范围内；deviceID 为空时只有完全发布的版本可用
+func (m *Manifest) Eligible(r *Release, channel, deviceID string) bool {
+	percent := r.RolloutPercent(channel)
+	switch {
+	case percent >= 100:
+		return true
+	case percent <= 0 || deviceID == "":
+		return false
+	}
+	return RolloutBucket(deviceID, m.Project, r.Version) < percent
+}
+
+// Resolve 返回设备在通道上应安装的版本：从通道指向的版本开始，按版本从新到旧取第一个灰度范围包含该设备的版本
+func (m *Manifest) Resolve(channel, deviceID string) (*Release, error) {
+	head, err := m.Latest(channel)
+	if err != nil {
+		return nil, err
+	}
+	if channel == "" {
+		channel = ChannelStable
+	}
+	started := false
+	for i := range m.Releases {
+		r := &m.Releases[i]
+		if r.Version == head.Version {
+			started = true
+		}
+		if started && m.Eligible(r, channel, deviceID) {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("no release on channel %s is rolled out to this device", channel)
+}
+
+// Promote 将通道指向 version，percent 为该版本在通道上的灰度百分比
+func (m *Manifest) Promote(channel, version string, percent int) error {
+	if m.Release(version) == nil {
+		return fmt.Errorf("version %s not found in manifest", version)
+	}
+	if m.Channels == nil {
+		m.Channels = make(map[string]string)
+	}
+	m.Channels[channel] = version
+	return m.SetRollout(channel, version, percent)
+}
+
+// SetRollout 设置版本在通道上的灰度百分比，100 表示完全发布
+func (m *Manifest) SetRollout(channel, version string, percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("rollout percentage %d out of range 0-100", percent)
+	}
+	r := m.Release(version)
+	if r == nil {
+		return fmt.Errorf("version %s not found in manifest", version)
+	}
+	if percent == 100 {
+		delete(r.Rollout, channel)
+		if len(r.Rollout) == 0 {
+			r.Rollout = nil
+		}
+		return nil
+	}
+	if r.Rollout == nil {
+		r.Rollout = make(map[string]int)
+	}
+	r.Rollout[channel] = percent
+	return nil
+}
@@ -0,0 +1,136 @@
+package helpers
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rolloutManifest() *Manifest {
+	return &Manifest{
+		Project:  "app",
+		Channels: map[string]string{ChannelStable: "v1.2.0", ChannelBeta: "v1.3.0"},
+		Releases: []Release{
+			{Version: "v1.3.0", Packages: []ReleasePackage{{URL: "v1.3.0.tar.gz"}}},
+			{Version: "v1.2.0", Packages: []ReleasePackage{{URL: "v1.2.0.tar.gz"}, {URL: "d12.tar.gz", BaseVersion: "v1.1.0"}}},
+			{Version: "v1.1.0", Packages: []ReleasePackage{{URL: "v1.1.0.tar.gz"}}},
+		},
+	}
+}
+
+func TestRolloutBucket(t *testing.T) {
+	assert.Equal(t, RolloutBucket("device", "app", "v1.2.0"), RolloutBucket("device", "app", "v1.2.0"))
+
+	// 分桶应大致均匀
+	inRange := 0
+	for i := 0; i < 10000; i++ {
+		if RolloutBucket(fmt.Sprintf("device-%d", i), "app", "v1.2.0") < 5 {
+			inRange++
+		}
+	}
+	assert.InDelta(t, 500, inRange, 150)
+}
+
+func TestManifestResolve(t *testing.T) {
+	m := rolloutManifest()
+
+	release, err := m.Resolve(ChannelStable, "device")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", release.Version)
+	release, err = m.Resolve(ChannelBeta, "device")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.3.0", release.Version)
+	_, err = m.Resolve(ChannelNightly, "device")
+	assert.Error(t, err)
+
+	// 灰度中的版本只给分桶在范围内的设备
+	require.NoError(t, m.Promote(ChannelStable, "v1.3.0", 30))
+	var included, excluded string
+	for i := 0; included == "" || excluded == ""; i++ {
+		id := fmt.Sprintf("device-%d", i)
+		if RolloutBucket(id, "app", "v1.3.0") < 30 {
+			included = id
+		} else {
+			excluded = id
+		}
+	}
+	release, err = m.Resolve(ChannelStable, included)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.3.0", release.Version)
+	release, err = m.Resolve(ChannelStable, excluded)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", release.Version)
+	release, err = m.Resolve(ChannelStable, "")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", release.Version, "without a device id only fully rolled out releases")
+	release, err = m.Resolve(ChannelBeta, excluded)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.3.0", release.Version, "rollout is per channel")
+
+	// 提高百分比后已包含的设备仍然包含，100% 时删除灰度记录
+	require.NoError(t, m.SetRollout(ChannelStable, "v1.3.0", 60))
+	release, err = m.Resolve(ChannelStable, included)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.3.0", release.Version)
+	require.NoError(t, m.SetRollout(ChannelStable, "v1.3.0", 100))
+	assert.Nil(t, m.Release("v1.3.0").Rollout)
+
+	assert.Error(t, m.SetRollout(ChannelStable, "v1.3.0", 101))
+	assert.Error(t, m.Promote(ChannelStable, "v9.9.9", 100))
+}
+
+func TestResolveManifestPackage(t *testing.T) {
+	m := rolloutManifest()
+	const manifestURL = "https://updates.example.com/linux/go/app/manifest.json"
+
+	pkg, err := resolveManifestPackage(m, manifestURL, &RepoRef{Installed: "v1.1.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://updates.example.com/linux/go/app/d12.tar.gz", pkg.URL)
+
+	pkg, err = resolveManifestPackage(m, manifestURL, &RepoRef{Installed: "v1.0.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://updates.example.com/linux/go/app/v1.2.0.tar.gz", pkg.URL)
+
+	pkg, err = resolveManifestPackage(m, manifestURL, &RepoRef{Channel: ChannelBeta, Installed: "v1.2.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://updates.example.com/linux/go/app/v1.3.0.tar.gz", pkg.URL)
+
+	_, err = resolveManifestPackage(m, manifestURL, &RepoRef{Installed: "v1.2.0"})
+	assert.Error(t, err, "already installed")
+
+	// 已安装的版本高于通道版本时不降级，除非显式指定版本
+	_, err = resolveManifestPackage(m, manifestURL, &RepoRef{Installed: "v1.3.0"})
+	assert.ErrorContains(t, err, "newer than v1.2.0")
+	pkg, err = resolveManifestPackage(m, manifestURL, &RepoRef{Version: "v1.2.0", Installed: "v1.3.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://updates.example.com/linux/go/app/v1.2.0.tar.gz", pkg.URL)
+	_, err = resolveManifestPackage(m, manifestURL, &RepoRef{Version: "v2.0.0"})
+	assert.Error(t, err)
+
+	// 客户端版本低于清单要求时提示先自更新
+	m.MinClientVersion = "v1.5.0"
+	_, err = resolveManifestPackage(m, manifestURL, &RepoRef{Installed: "v1.1.0", ClientVersion: "v1.4.9"})
+	assert.EqualError(t, err, "manifest requires upgradeReWi v1.5.0 or newer (running v1.4.9), run self-update first")
+	_, err = resolveManifestPackage(m, manifestURL, &RepoRef{Installed: "v1.1.0", ClientVersion: "v1.5.0"})
+	assert.NoError(t, err)
+	_, err = resolveManifestPackage(m, manifestURL, &RepoRef{Installed: "v1.1.0"})
+	assert.NoError(t, err)
+}
+
+func TestLoadDeviceID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upgradeReWi", "device-id")
+	id, err := loadDeviceID(path)
+	require.NoError(t, err)
+	assert.Len(t, id, 32)
+	again, err := loadDeviceID(path)
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	t.Setenv(DeviceIDEnv, "fixed")
+	id, err = DeviceID()
+	require.NoError(t, err)
+	assert.Equal(t, "fixed", id)
+}
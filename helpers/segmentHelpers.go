@@ -0,0 +1,250 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// minSegmentSize 每个分段的最小长度，文件太小时分段下载没有收益
+const minSegmentSize = 256 << 10
+
+// errSegmentsUnsupported 服务器不支持分段下载，应回退为单流下载
+var errSegmentsUnsupported = errors.New("server does not support segmented downloads")
+
+// downloadSegment 分段下载的一个字节区间
+type downloadSegment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`  // 包含
+	Done  int64 `json:"done"` // 已写入的字节数
+}
+
+func (seg *downloadSegment) size() int64 {
+	return seg.End - seg.Start + 1
+}
+
+// splitSegments 将 length 字节平均分为 n 段
+func splitSegments(length int64, n int) []downloadSegment {
+	if max := int(length / minSegmentSize); n > max {
+		n = max
+	}
+	if n < 1 {
+		n = 1
+	}
+	segments := make([]downloadSegment, 0, n)
+	step := length / int64(n)
+	for i := 0; i < n; i++ {
+		seg := downloadSegment{Start: int64(i) * step, End: int64(i+1)*step - 1}
+		if i == n-1 {
+			seg.End = length - 1
+		}
+		segments = append(segments, seg)
+	}
+	return segments
+}
+
+// probeRanges 用 HEAD 请求确认服务器是否支持 Range，并获取完整长度与校验标识
+func (nm *NetManager) probeRanges(ctx context.Context, client *http.Client) (*downloadMeta, error) {
+	req, err := nm.createRequest(ctx, nm.ReqURL)
+	if err != nil {
+		return nil, err
+	}
+	req.Method = http.MethodHead
+	req.Body = nil
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength < 2*minSegmentSize {
+		return nil, errSegmentsUnsupported
+	}
+	if resp.ContentLength > nm.MaxBodySize {
+		return nil, fmt.Errorf("%w of %d bytes", errBodyTooLarge, nm.MaxBodySize)
+	}
+	return &downloadMeta{
+		URL:          nm.ReqURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Length:       resp.ContentLength,
+	}, nil
+}
+
+// downloadSegments 将 ReqURL 分为 Segments 段并发下载到 .part 文件
+//
+// 各段进度记录在 .part.json 中，单段失败时只重试该段，再次运行时继续未完成的段。
+// 返回 errSegmentsUnsupported 时调用方应回退为单流下载。
+func (nm *NetManager) downloadSegments(ctx context.Context, client *http.Client, partPath string, progress *progressTracker) error {
+	metaPath := partPath + ".json"
+	meta := loadDownloadMeta(metaPath)
+
+	_, statErr := os.Stat(partPath)
+	resumable := statErr == nil && meta != nil && meta.URL == nm.ReqURL &&
+		len(meta.Segments) > 0 && (meta.ETag != "" || meta.LastModified != "")
+	if !resumable {
+		probe, err := nm.probeRanges(ctx, client)
+		if err != nil {
+			return err
+		}
+		meta = probe
+		meta.Segments = splitSegments(meta.Length, nm.Segments)
+
+		// 预先分配完整长度，各段直接写入各自的位置
+		file, err := os.Create(partPath)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		err = file.Truncate(meta.Length)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to allocate file: %w", err)
+		}
+		if err := saveDownloadMeta(metaPath, meta); err != nil {
+			return fmt.Errorf("failed to save download state: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(partPath, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	var done int64
+	for _, seg := range meta.Segments {
+		done += seg.Done
+	}
+	progress.reset(done, meta.Length)
+
+	var (
+		mu   sync.Mutex // 保护各段进度及 .part.json
+		wg   sync.WaitGroup
+		errs = make([]error, len(meta.Segments))
+	)
+	for i := range meta.Segments {
+		seg := &meta.Segments[i]
+		if seg.Done >= seg.size() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, seg *downloadSegment) {
+			defer wg.Done()
+			for attempt := 0; ; attempt++ {
+				retry, err := nm.fetchSegment(ctx, client, file, meta, seg, &mu, progress)
+
+				mu.Lock()
+				if saveErr := saveDownloadMeta(metaPath, meta); saveErr != nil && err == nil {
+					err = saveErr
+				}
+				mu.Unlock()
+
+				if err == nil || !retry || attempt >= nm.Retries || ctx.Err() != nil {
+					errs[i] = err
+					return
+				}
+				nm.Logger.Info("Retrying segment",
+					zap.Int64("start", seg.Start),
+					zap.Int64("end", seg.End),
+				)
+				if waitErr := nm.waitRetry(ctx, attempt, err); waitErr != nil {
+					errs[i] = waitErr
+					return
+				}
+			}
+		}(i, seg)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("download cancelled: %w", err)
+	}
+	for i, err := range errs {
+		if errors.Is(err, errSegmentsUnsupported) {
+			// 已下载的分段无法用于单流续传
+			_ = os.Remove(partPath)
+			_ = os.Remove(metaPath)
+			return err
+		}
+		if err != nil {
+			seg := meta.Segments[i]
+			return fmt.Errorf("segment %d-%d failed: %w", seg.Start, seg.End, err)
+		}
+	}
+	return file.Sync()
+}
+
+// fetchSegment 下载一个分段的剩余部分，写入文件中对应的位置
+// 返回的 retry 表示中途失败后是否值得从已写入的位置重试
+func (nm *NetManager) fetchSegment(ctx context.Context, client *http.Client, file *os.File, meta *downloadMeta, seg *downloadSegment, mu *sync.Mutex, progress *progressTracker) (retry bool, err error) {
+	mu.Lock()
+	offset := seg.Start + seg.Done
+	mu.Unlock()
+
+	req, err := nm.createRequest(ctx, nm.ReqURL)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, seg.End))
+	if validator := meta.ETag; validator != "" {
+		req.Header.Set("If-Range", validator)
+	} else if meta.LastModified != "" {
+		req.Header.Set("If-Range", meta.LastModified)
+	}
+
+	// 连接失败与可重试的状态码已由 retryTransport 重试过
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		start, _, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return false, fmt.Errorf("unexpected Content-Range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		// 服务器忽略了 Range，或 If-Range 校验失败（远端文件已变化）
+		return false, errSegmentsUnsupported
+	default:
+		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	remaining := seg.End - offset + 1
+	body := io.LimitReader(nm.throttle(resp), remaining)
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if _, err := file.WriteAt(buf[:n], offset); err != nil {
+				return false, fmt.Errorf("failed to write file: %w", err)
+			}
+			offset += int64(n)
+			mu.Lock()
+			seg.Done += int64(n)
+			mu.Unlock()
+			progress.add(int64(n))
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return true, readErr
+		}
+	}
+	if offset <= seg.End {
+		return true, fmt.Errorf("incomplete segment: got %d of %d bytes", offset-seg.Start, seg.size())
+	}
+	return false, nil
+}
@@ -0,0 +1,134 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSegments(t *testing.T) {
+	segments := splitSegments(10*minSegmentSize+3, 4)
+	require.Len(t, segments, 4)
+	assert.Equal(t, int64(0), segments[0].Start)
+	assert.Equal(t, int64(10*minSegmentSize+2), segments[3].End)
+	for i := 1; i < len(segments); i++ {
+		assert.Equal(t, segments[i-1].End+1, segments[i].Start)
+	}
+
+	// 文件较小时减少段数
+	assert.Len(t, splitSegments(3*minSegmentSize, 8), 3)
+}
+
+func TestDownloadSegments(t *testing.T) {
+	content := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	sum := fmt.Sprintf("%x", md5.Sum(content))
+
+	// rangeServer 记录收到的 Range 请求，failFirst 为 true 时每个分段的第一次请求中途断开
+	rangeServer := func(t *testing.T, failFirst bool) (*httptest.Server, func() []string) {
+		var (
+			mu     sync.Mutex
+			ranges []string
+			failed = map[int]bool{}
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rng := r.Header.Get("Range")
+			mu.Lock()
+			if r.Method == http.MethodGet {
+				ranges = append(ranges, rng)
+			}
+			// 以分段结束位置区分分段，重试时起始位置会变化
+			var start, end int
+			fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			fail := failFirst && rng != "" && !failed[end]
+			if fail {
+				failed[end] = true
+			}
+			mu.Unlock()
+
+			w.Header().Set("ETag", `"v1"`)
+			if fail {
+				// 只发送 10 字节就断开
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+				w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[start : start+10])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			http.ServeContent(w, r, "pkg.tar.gz", time.Time{}, bytes.NewReader(content))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), ranges...)
+		}
+	}
+
+	t.Run("并发下载并校验", func(t *testing.T) {
+		srv, requests := rangeServer(t, false)
+		nm := newTestNetManager(srv.URL)
+		nm.Segments = 4
+		nm.Checksum = "md5:" + sum
+
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.NoError(t, nm.DownloadFile(dest))
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.NoFileExists(t, dest+".part.json")
+
+		got := requests()
+		assert.Len(t, got, 4)
+		for _, rng := range got {
+			assert.NotEmpty(t, rng)
+		}
+	})
+
+	t.Run("单段失败只重试该段", func(t *testing.T) {
+		srv, requests := rangeServer(t, true)
+		nm := newTestNetManager(srv.URL)
+		nm.Segments = 2
+		nm.Retries = 1
+		nm.Checksum = "md5:" + sum
+
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.NoError(t, nm.DownloadFile(dest))
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+		// 每段各失败一次，重试时从已写入的位置继续
+		got := requests()
+		require.Len(t, got, 4)
+		assert.Contains(t, got, fmt.Sprintf("bytes=10-%d", len(content)/2-1))
+	})
+
+	t.Run("不支持 Range 时回退为单流", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content)
+		}))
+		defer srv.Close()
+
+		nm := newTestNetManager(srv.URL)
+		nm.Segments = 4
+		nm.Checksum = "md5:" + sum
+		dest := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.NoError(t, nm.DownloadFile(dest))
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+	})
+}
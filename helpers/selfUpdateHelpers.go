@@ -0,0 +1,142 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ExecutableAssetName 返回当前平台的可执行文件发布名，如 upgradeReWi-linux-amd64(.exe)
+func ExecutableAssetName(name string) string {
+	asset := fmt.Sprintf("%s-%s-%s", name, runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		asset += ".exe"
+	}
+	return asset
+}
+
+// CurrentExecutable 返回当前进程可执行文件的真实路径（解析符号链接）
+func CurrentExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// InstallExecutable 用 newPath 替换 exePath，旧文件保留为 <exePath>.old 以便回滚
+// newPath 应与 exePath 位于同一目录，保证重命名是原子的
+//
+// 非 Windows 平台先把当前版本硬链接（跨文件系统等不支持时复制）为 .old，再把新文件重命名覆盖 exePath，
+// 任何时刻 exePath 都存在，替换中途被终止也不会丢失可执行文件。
+func InstallExecutable(newPath, exePath string) error {
+	info, err := os.Stat(exePath)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(newPath, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("chmod new executable: %w", err)
+	}
+	if err := syncFile(newPath); err != nil {
+		return fmt.Errorf("sync new executable: %w", err)
+	}
+
+	oldPath := exePath + ".old"
+	if runtime.GOOS == "windows" {
+		return swapAside(newPath, exePath, oldPath)
+	}
+	if err := linkOrCopy(exePath, oldPath); err != nil {
+		return fmt.Errorf("keep current executable: %w", err)
+	}
+	if err := os.Rename(newPath, exePath); err != nil {
+		return fmt.Errorf("move new executable into place: %w", err)
+	}
+	syncDir(filepath.Dir(exePath))
+	return nil
+}
+
+// RollbackExecutable 与 <exePath>.old 互换，恢复上一个版本（再次执行可撤销回滚）
+func RollbackExecutable(exePath string) error {
+	oldPath := exePath + ".old"
+	if _, err := os.Stat(oldPath); err != nil {
+		return fmt.Errorf("no previous executable: %w", err)
+	}
+
+	swapPath := exePath + ".swap"
+	if runtime.GOOS == "windows" {
+		if err := swapAside(oldPath, exePath, swapPath); err != nil {
+			return err
+		}
+	} else {
+		if err := linkOrCopy(exePath, swapPath); err != nil {
+			return fmt.Errorf("keep current executable: %w", err)
+		}
+		if err := os.Rename(oldPath, exePath); err != nil {
+			os.Remove(swapPath)
+			return fmt.Errorf("restore previous executable: %w", err)
+		}
+	}
+	if err := os.Rename(swapPath, oldPath); err != nil {
+		return fmt.Errorf("keep replaced executable: %w", err)
+	}
+	syncDir(filepath.Dir(exePath))
+	return nil
+}
+
+// swapAside 先把 exePath 重命名为 asidePath，再把 newPath 重命名为 exePath
+// 运行中的可执行文件在 Windows 上不能被覆盖，但可以被重命名；两次重命名之间 exePath 短暂不存在
+func swapAside(newPath, exePath, asidePath string) error {
+	if err := os.Remove(asidePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove previous backup: %w", err)
+	}
+	if err := os.Rename(exePath, asidePath); err != nil {
+		return fmt.Errorf("move current executable aside: %w", err)
+	}
+	if err := os.Rename(newPath, exePath); err != nil {
+		_ = os.Rename(asidePath, exePath)
+		return fmt.Errorf("move new executable into place: %w", err)
+	}
+	syncDir(filepath.Dir(exePath))
+	return nil
+}
+
+// linkOrCopy 将 src 硬链接或复制为 dst，dst 已存在时原子地替换
+func linkOrCopy(src, dst string) error {
+	tmp := dst + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(src, tmp); err != nil {
+		if err := CopyFile(src, tmp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := syncFile(tmp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// syncDir 刷新目录项，使重命名在断电后仍然有效（部分平台不支持，忽略错误）
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
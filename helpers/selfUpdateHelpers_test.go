@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallExecutable(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "upgradeReWi")
+	require.NoError(t, os.WriteFile(exe, []byte("v1"), 0755))
+	require.NoError(t, os.WriteFile(exe+".new", []byte("v2"), 0600))
+
+	t.Run("替换并保留旧版本", func(t *testing.T) {
+		require.NoError(t, InstallExecutable(exe+".new", exe))
+
+		data, err := os.ReadFile(exe)
+		require.NoError(t, err)
+		assert.Equal(t, "v2", string(data))
+		info, err := os.Stat(exe)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+		old, err := os.ReadFile(exe + ".old")
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(old))
+		assert.NoFileExists(t, exe+".new")
+	})
+
+	t.Run("旧版本以链接或副本保留", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(exe+".new", []byte("v3"), 0600))
+		before, err := os.Stat(exe)
+		require.NoError(t, err)
+		require.NoError(t, InstallExecutable(exe+".new", exe))
+		after, err := os.Stat(exe + ".old")
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(before, after))
+		assert.NoFileExists(t, exe+".old.tmp")
+		data, _ := os.ReadFile(exe)
+		assert.Equal(t, "v3", string(data))
+
+		// 回到 v2/v1 之前的状态，供后续子测试使用
+		require.NoError(t, os.WriteFile(exe+".old", []byte("v1"), 0755))
+		require.NoError(t, os.WriteFile(exe, []byte("v2"), 0755))
+	})
+
+	t.Run("回滚与撤销回滚", func(t *testing.T) {
+		require.NoError(t, RollbackExecutable(exe))
+		data, _ := os.ReadFile(exe)
+		assert.Equal(t, "v1", string(data))
+
+		require.NoError(t, RollbackExecutable(exe))
+		data, _ = os.ReadFile(exe)
+		assert.Equal(t, "v2", string(data))
+		assert.NoFileExists(t, exe+".swap")
+	})
+
+	t.Run("没有旧版本", func(t *testing.T) {
+		require.NoError(t, os.Remove(exe+".old"))
+		assert.Error(t, RollbackExecutable(exe))
+	})
+}
@@ -0,0 +1,214 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// UpdateServer 以 sniffer 客户端约定的目录结构提供更新文件：
+//
+//	<root>/<platform>/<dependency>/<project>/version.txt
+//	<root>/<platform>/<dependency>/<project>/<version>.tar.gz
+//
+// 文件支持 Range/If-Range 与 ETag；磁盘上没有 <file>.md5、.sha1、.sha256、.sha512 时按需计算；
+// 目录返回 JSON 格式的文件列表。
+type UpdateServer struct {
+	Root   string
+	Logger *zap.Logger
+
+	mu      sync.Mutex
+	digests map[string]string // path|size|mtime|algorithm -> hex
+}
+
+// NewUpdateServer 创建以 root 为根目录的更新服务器
+func NewUpdateServer(root string, logger *zap.Logger) *UpdateServer {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &UpdateServer{Root: root, Logger: logger, digests: make(map[string]string)}
+}
+
+// DirEntry 目录列表中的一项
+type DirEntry struct {
+	Name    string    `json:"name"`
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time"`
+	URL     string    `json:"url"`
+}
+
+// DirListing 目录列表
+type DirListing struct {
+	Path    string     `json:"path"`
+	Entries []DirEntry `json:"entries"`
+}
+
+func (s *UpdateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.serve(rec, r)
+	s.Logger.Info("Request",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("range", r.Header.Get("Range")),
+		zap.Int("status", rec.status),
+		zap.Duration("duration", time.Since(start)),
+	)
+}
+
+func (s *UpdateServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// path.Clean 以 / 开头，不会越过根目录；隐藏文件（如 .part、状态目录）不对外提供
+	urlPath := path.Clean("/" + r.URL.Path)
+	if strings.Contains(urlPath, "/.") {
+		http.NotFound(w, r)
+		return
+	}
+	name := filepath.Join(s.Root, filepath.FromSlash(urlPath))
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		if algorithm, ok := s.checksumRequest(name); ok {
+			s.serveChecksum(w, r, strings.TrimSuffix(name, "."+algorithm), algorithm)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		s.serveDir(w, r, name, urlPath)
+		return
+	}
+	s.serveFile(w, r, name, info)
+}
+
+// serveFile 发送文件，http.ServeContent 处理 Range、If-Range、If-None-Match 与 If-Modified-Since
+func (s *UpdateServer) serveFile(w http.ResponseWriter, r *http.Request, name string, info os.FileInfo) {
+	file, err := os.Open(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("ETag", fileETag(info))
+	if strings.HasSuffix(name, ".json") {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// fileETag 由文件长度与修改时间生成的强校验标识，可用于 If-Range
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+// checksumRequest 判断不存在的 name 是否为某个已有文件的摘要文件
+func (s *UpdateServer) checksumRequest(name string) (string, bool) {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	if _, ok := hashAlgorithms[ext]; !ok {
+		return "", false
+	}
+	info, err := os.Stat(strings.TrimSuffix(name, "."+ext))
+	return ext, err == nil && !info.IsDir()
+}
+
+// serveChecksum 按需计算摘要，返回 "<hex>  <filename>"，结果按文件长度与修改时间缓存
+func (s *UpdateServer) serveChecksum(w http.ResponseWriter, r *http.Request, name, algorithm string) {
+	info, err := os.Stat(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	key := fmt.Sprintf("%s|%d|%d|%s", name, info.Size(), info.ModTime().UnixNano(), algorithm)
+	s.mu.Lock()
+	digest, ok := s.digests[key]
+	s.mu.Unlock()
+	if !ok {
+		if digest, err = CalculateFileHash(name, hashAlgorithms[algorithm]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.mu.Lock()
+		s.digests[key] = digest
+		s.mu.Unlock()
+	}
+
+	content := digest + "  " + info.Name() + "\n"
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%s"`, algorithm, digest[:16]))
+	http.ServeContent(w, r, info.Name()+"."+algorithm, info.ModTime(), strings.NewReader(content))
+}
+
+// serveDir 以 JSON 返回目录列表，隐藏以 . 开头的文件与未完成的 .part 文件
+func (s *UpdateServer) serveDir(w http.ResponseWriter, r *http.Request, name, urlPath string) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	listing := DirListing{Path: urlPath, Entries: []DirEntry{}}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || strings.HasSuffix(entry.Name(), ".part") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		item := DirEntry{
+			Name:    entry.Name(),
+			Dir:     entry.IsDir(),
+			ModTime: info.ModTime().UTC(),
+			URL:     path.Join(urlPath, entry.Name()),
+		}
+		if !entry.IsDir() {
+			item.Size = info.Size()
+		}
+		listing.Entries = append(listing.Entries, item)
+	}
+	sort.Slice(listing.Entries, func(i, j int) bool {
+		return listing.Entries[i].Name < listing.Entries[j].Name
+	})
+
+	data, err := json.MarshalIndent(listing, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(append(data, '\n'))
+}
+
+// statusRecorder 记录响应状态码用于访问日志
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,120 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateServer(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "linux", "go", "app")
+	require.NoError(t, os.MkdirAll(project, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(project, "version.txt"), []byte("1.2.0\n"), 0644))
+	pkg := make([]byte, 3*minSegmentSize+123)
+	_, err := rand.Read(pkg)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(project, "1.2.0.tar.gz"), pkg, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(project, "1.3.0.tar.gz.part"), []byte("partial"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".secret"), []byte("secret"), 0644))
+
+	srv := httptest.NewServer(NewUpdateServer(root, nil))
+	defer srv.Close()
+
+	get := func(t *testing.T, path string, header http.Header) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, body
+	}
+
+	t.Run("version", func(t *testing.T) {
+		nm := NewNetManager()
+		nm.BaseURL = srv.URL
+		require.NoError(t, nm.BuildReqURL("linux", "go", "app", "version.txt"))
+		version, err := nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.0", version)
+	})
+
+	t.Run("segmented download with checksum sidecar", func(t *testing.T) {
+		nm := NewNetManager()
+		nm.BaseURL = srv.URL
+		nm.Segments = 3
+		nm.ChecksumSidecar = true
+		require.NoError(t, nm.BuildReqURL("linux", "go", "app", "1.2.0.tar.gz"))
+		dest := filepath.Join(t.TempDir(), "app.tar.gz")
+		require.NoError(t, nm.DownloadFile(dest))
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, pkg, data)
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		sum := sha256.Sum256(pkg)
+		resp, body := get(t, "/linux/go/app/1.2.0.tar.gz.sha256", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, hex.EncodeToString(sum[:])+"  1.2.0.tar.gz\n", string(body))
+
+		resp, _ = get(t, "/linux/go/app/missing.tar.gz.md5", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("range and etag", func(t *testing.T) {
+		resp, _ := get(t, "/linux/go/app/1.2.0.tar.gz", nil)
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+		assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+
+		resp, body := get(t, "/linux/go/app/1.2.0.tar.gz", http.Header{"Range": {"bytes=10-19"}, "If-Range": {etag}})
+		assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		assert.Equal(t, pkg[10:20], body)
+
+		resp, _ = get(t, "/linux/go/app/1.2.0.tar.gz", http.Header{"If-None-Match": {etag}})
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	})
+
+	t.Run("listing", func(t *testing.T) {
+		resp, body := get(t, "/linux/go/app/", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		var listing DirListing
+		require.NoError(t, json.Unmarshal(body, &listing))
+		assert.Equal(t, "/linux/go/app", listing.Path)
+		require.Len(t, listing.Entries, 2)
+		assert.Equal(t, "1.2.0.tar.gz", listing.Entries[0].Name)
+		assert.Equal(t, int64(len(pkg)), listing.Entries[0].Size)
+		assert.Equal(t, "/linux/go/app/1.2.0.tar.gz", listing.Entries[0].URL)
+		assert.Equal(t, "version.txt", listing.Entries[1].Name)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		resp, _ := get(t, "/../../etc/passwd", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp, _ = get(t, "/.secret", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, err := http.Post(srv.URL+"/linux/go/app/version.txt", "text/plain", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
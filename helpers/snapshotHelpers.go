@@ -0,0 +1,326 @@
+package helpers
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照保存方式
+const (
+	SnapshotTarGz    = "tar.gz"   // 压缩包快照，占用空间小
+	SnapshotHardlink = "hardlink" // 硬链接目录树，创建快、恢复快（需与目标目录同一文件系统）
+)
+
+const snapshotIndexFile = "snapshots.json"
+
+// SnapshotEntry 一个已安装版本的快照记录
+type SnapshotEntry struct {
+	ID        string `json:"id"`             // 快照唯一标识（同时也是快照文件/目录名）
+	Version   string `json:"version"`        // 快照对应的版本号
+	Timestamp string `json:"timestamp"`      // 快照创建时间
+	Mode      string `json:"mode"`           // 保存方式：tar.gz / hardlink
+	Path      string `json:"path"`           // 相对于 StateDir 的快照路径
+	Hash      string `json:"hash,omitempty"` // 压缩包快照的 MD5
+}
+
+// SnapshotIndex 快照索引，按创建时间从旧到新排列
+type SnapshotIndex struct {
+	Current   string          `json:"current"` // 当前安装版本对应的快照 ID
+	Snapshots []SnapshotEntry `json:"snapshots"`
+}
+
+// SnapshotManager 管理目标目录的历史版本快照
+type SnapshotManager struct {
+	StateDir string // 状态目录，存放快照及索引（不能位于目标目录内）
+	Keep     int    // 保留的快照数量，<=0 表示不限制
+	Mode     string // 快照保存方式，默认 tar.gz
+}
+
+// DefaultStateDir 返回目标目录默认的状态目录（与目标目录同级）
+func DefaultStateDir(targetDir string) string {
+	return filepath.Clean(targetDir) + ".rewi-state"
+}
+
+func (index *SnapshotIndex) has(id string) bool {
+	for _, s := range index.Snapshots {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (sm *SnapshotManager) indexPath() string {
+	return filepath.Join(sm.StateDir, snapshotIndexFile)
+}
+
+// LoadIndex 读取快照索引，索引不存在时返回空索引
+func (sm *SnapshotManager) LoadIndex() (*SnapshotIndex, error) {
+	index := &SnapshotIndex{}
+	data, err := os.ReadFile(sm.indexPath())
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot index: %w", err)
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("parse snapshot index: %w", err)
+	}
+	return index, nil
+}
+
+func (sm *SnapshotManager) saveIndex(index *SnapshotIndex) error {
+	data, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmpPath := sm.indexPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("write snapshot index: %w", err)
+	}
+	return os.Rename(tmpPath, sm.indexPath())
+}
+
+// Save 为目标目录创建一个版本快照，并按 Keep 清理旧快照
+func (sm *SnapshotManager) Save(targetDir, version string) (*SnapshotEntry, error) {
+	mode := sm.Mode
+	if mode == "" {
+		mode = SnapshotTarGz
+	}
+
+	snapshotDir := filepath.Join(sm.StateDir, "snapshots")
+	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+		return nil, fmt.Errorf("create snapshot dir: %w", err)
+	}
+
+	now := time.Now()
+	entry := SnapshotEntry{
+		ID:        fmt.Sprintf("%s-%s", filepath.Base(filepath.Clean(version)), now.Format("20060102150405")),
+		Version:   version,
+		Timestamp: now.Format("2006-01-02 15:04:05"),
+		Mode:      mode,
+	}
+
+	index, err := sm.LoadIndex()
+	if err != nil {
+		return nil, err
+	}
+	// 同一秒内重复保存同一版本时追加序号，避免覆盖已有快照
+	for n, base := 1, entry.ID; index.has(entry.ID); n++ {
+		entry.ID = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	switch mode {
+	case SnapshotTarGz:
+		entry.Path = filepath.Join("snapshots", entry.ID+".tar.gz")
+		archive := filepath.Join(sm.StateDir, entry.Path)
+
+		// 以目标目录的直属子项为打包源，使压缩包内路径相对于目标目录
+		entries, err := os.ReadDir(targetDir)
+		if err != nil {
+			return nil, fmt.Errorf("read target dir: %w", err)
+		}
+		sources := make([]string, 0, len(entries))
+		for _, e := range entries {
+			sources = append(sources, filepath.Join(targetDir, e.Name()))
+		}
+		if err := CreateTarGz(sources, archive); err != nil {
+			_ = os.Remove(archive)
+			return nil, fmt.Errorf("create snapshot archive: %w", err)
+		}
+		if entry.Hash, err = CalculateFileHash(archive, md5.New); err != nil {
+			return nil, fmt.Errorf("hash snapshot archive: %w", err)
+		}
+	case SnapshotHardlink:
+		entry.Path = filepath.Join("snapshots", entry.ID)
+		if err := LinkDir(targetDir, filepath.Join(sm.StateDir, entry.Path)); err != nil {
+			_ = os.RemoveAll(filepath.Join(sm.StateDir, entry.Path))
+			return nil, fmt.Errorf("create hardlink snapshot: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown snapshot mode: %s", mode)
+	}
+
+	index.Snapshots = append(index.Snapshots, entry)
+	index.Current = entry.ID
+	sm.prune(index)
+
+	if err := sm.saveIndex(index); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// prune 删除超出保留数量的旧快照（当前版本的快照始终保留）
+func (sm *SnapshotManager) prune(index *SnapshotIndex) {
+	if sm.Keep <= 0 {
+		return
+	}
+	for len(index.Snapshots) > sm.Keep {
+		victim := 0
+		if index.Snapshots[0].ID == index.Current {
+			victim = 1
+		}
+		entry := index.Snapshots[victim]
+		if err := os.RemoveAll(filepath.Join(sm.StateDir, entry.Path)); err != nil {
+			fmt.Printf("Warning: failed to remove snapshot %s: %v\n", entry.ID, err)
+		}
+		index.Snapshots = append(index.Snapshots[:victim], index.Snapshots[victim+1:]...)
+	}
+}
+
+// Find 查找回滚目标快照
+// version 为空时返回当前版本之前的最近一个快照，否则返回该版本最新的快照
+func (sm *SnapshotManager) Find(index *SnapshotIndex, version string) (*SnapshotEntry, error) {
+	if version != "" {
+		for i := len(index.Snapshots) - 1; i >= 0; i-- {
+			if index.Snapshots[i].Version == version {
+				return &index.Snapshots[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no snapshot for version %s", version)
+	}
+
+	current := len(index.Snapshots)
+	for i, s := range index.Snapshots {
+		if s.ID == index.Current {
+			current = i
+		}
+	}
+	if current == 0 || len(index.Snapshots) == 0 {
+		return nil, fmt.Errorf("no snapshot older than the current version")
+	}
+	return &index.Snapshots[current-1], nil
+}
+
+// Restore 将目标目录恢复为指定版本的快照（version 为空时恢复上一个版本）
+func (sm *SnapshotManager) Restore(targetDir, version string) (*SnapshotEntry, error) {
+	index, err := sm.LoadIndex()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := sm.Find(index, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先在目标目录旁准备完整的恢复内容，再整体替换，避免恢复一半的状态
+	targetDir = filepath.Clean(targetDir)
+	restoreDir := targetDir + ".rollback"
+	if err := os.RemoveAll(restoreDir); err != nil {
+		return nil, fmt.Errorf("clean restore dir: %w", err)
+	}
+	defer os.RemoveAll(restoreDir)
+
+	if err := sm.Materialize(entry, restoreDir); err != nil {
+		return nil, err
+	}
+
+	if err := ReplaceDir(restoreDir, targetDir); err != nil {
+		return nil, err
+	}
+
+	index.Current = entry.ID
+	if err := sm.saveIndex(index); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Current 返回当前安装版本的快照，没有快照时返回 nil
+func (sm *SnapshotManager) Current() (*SnapshotEntry, error) {
+	index, err := sm.LoadIndex()
+	if err != nil {
+		return nil, err
+	}
+	for i := range index.Snapshots {
+		if index.Snapshots[i].ID == index.Current {
+			return &index.Snapshots[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Materialize 将快照内容还原到 dir 目录
+func (sm *SnapshotManager) Materialize(entry *SnapshotEntry, dir string) error {
+	source := filepath.Join(sm.StateDir, entry.Path)
+	switch entry.Mode {
+	case SnapshotTarGz:
+		if entry.Hash != "" {
+			if err := VerifyFileHash(source, entry.Hash, md5.New); err != nil {
+				return fmt.Errorf("verify snapshot %s: %w", entry.ID, err)
+			}
+		}
+		if err := ExtractTarGz(source, dir); err != nil {
+			return fmt.Errorf("extract snapshot %s: %w", entry.ID, err)
+		}
+	case SnapshotHardlink:
+		// 复制而不是再次硬链接，防止恢复后的文件被原地修改时污染快照
+		if err := CopyDir(source, dir); err != nil {
+			return fmt.Errorf("copy snapshot %s: %w", entry.ID, err)
+		}
+	default:
+		return fmt.Errorf("unknown snapshot mode: %s", entry.Mode)
+	}
+	return nil
+}
+
+// ReplaceDir 用 src 目录整体替换 dst 目录，替换失败时尽量还原 dst
+func ReplaceDir(src, dst string) error {
+	backup := dst + ".old"
+	if err := os.RemoveAll(backup); err != nil {
+		return fmt.Errorf("clean backup dir: %w", err)
+	}
+
+	exists, isFile, _, err := PathInfo(dst)
+	if err != nil {
+		return err
+	}
+	if exists && isFile {
+		return fmt.Errorf("%s is not a directory", dst)
+	}
+	if exists {
+		if err := os.Rename(dst, backup); err != nil {
+			return fmt.Errorf("move %s aside: %w", dst, err)
+		}
+	}
+	if err := os.Rename(src, dst); err != nil {
+		if exists {
+			_ = os.Rename(backup, dst)
+		}
+		return fmt.Errorf("move %s into place: %w", src, err)
+	}
+	return os.RemoveAll(backup)
+}
+
+// LinkDir 以硬链接方式递归复制目录树
+func LinkDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return os.Link(path, target)
+		}
+	})
+}
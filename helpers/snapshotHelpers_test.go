@@ -0,0 +1,70 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeVersionTree(t *testing.T, dir, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "conf"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.bin"), []byte(content), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conf", "app.yaml"), []byte("version: "+content), 0644))
+}
+
+func TestSnapshotManager(t *testing.T) {
+	for _, mode := range []string{SnapshotTarGz, SnapshotHardlink} {
+		t.Run(mode, func(t *testing.T) {
+			base := t.TempDir()
+			target := filepath.Join(base, "app")
+			sm := &SnapshotManager{StateDir: DefaultStateDir(target), Keep: 2, Mode: mode}
+
+			// 依次安装三个版本，只保留最近两个
+			for _, v := range []string{"v1", "v2", "v3"} {
+				require.NoError(t, os.RemoveAll(target))
+				writeVersionTree(t, target, v)
+				_, err := sm.Save(target, v)
+				require.NoError(t, err)
+			}
+
+			index, err := sm.LoadIndex()
+			require.NoError(t, err)
+			require.Len(t, index.Snapshots, 2)
+			assert.Equal(t, "v2", index.Snapshots[0].Version)
+			assert.Equal(t, "v3", index.Snapshots[1].Version)
+
+			t.Run("回滚到上一版本", func(t *testing.T) {
+				entry, err := sm.Restore(target, "")
+				require.NoError(t, err)
+				assert.Equal(t, "v2", entry.Version)
+
+				data, err := os.ReadFile(filepath.Join(target, "conf", "app.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, "version: v2", string(data))
+			})
+
+			t.Run("没有更早的版本", func(t *testing.T) {
+				_, err := sm.Restore(target, "")
+				assert.Error(t, err)
+			})
+
+			t.Run("回滚到指定版本", func(t *testing.T) {
+				entry, err := sm.Restore(target, "v3")
+				require.NoError(t, err)
+				assert.Equal(t, "v3", entry.Version)
+
+				data, err := os.ReadFile(filepath.Join(target, "app.bin"))
+				require.NoError(t, err)
+				assert.Equal(t, "v3", string(data))
+			})
+
+			t.Run("已清理的版本", func(t *testing.T) {
+				_, err := sm.Restore(target, "v1")
+				assert.Error(t, err)
+			})
+		})
+	}
+}
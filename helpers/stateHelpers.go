@@ -0,0 +1,158 @@
+package helpers
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const installStateFile = "state.json"
+
+// InstallState 目标目录的安装状态，升级成功后写入状态目录
+type InstallState struct {
+	Version        string            `json:"version"`         // 已安装版本
+	PackageHash    string            `json:"package_hash"`    // 安装所用升级包的 MD5
+	InstalledAt    string            `json:"installed_at"`    // 安装时间
+	ManifestDigest string            `json:"manifest_digest"` // 文件清单摘要（sha256）
+	Files          map[string]string `json:"files"`           // 相对路径 -> MD5
+}
+
+// IntegrityReport 已安装文件与安装状态的比对结果
+type IntegrityReport struct {
+	Modified []string `json:"modified"`
+	Missing  []string `json:"missing"`
+	Extra    []string `json:"extra"`
+}
+
+// Intact 是否与安装时完全一致
+func (r *IntegrityReport) Intact() bool {
+	return len(r.Modified) == 0 && len(r.Missing) == 0 && len(r.Extra) == 0
+}
+
+// InstallStatePath 返回状态目录中的安装状态文件路径
+func InstallStatePath(stateDir string) string {
+	return filepath.Join(stateDir, installStateFile)
+}
+
+// LoadInstallState 读取安装状态，从未安装过时返回 nil
+func LoadInstallState(stateDir string) (*InstallState, error) {
+	data, err := os.ReadFile(InstallStatePath(stateDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read install state: %w", err)
+	}
+
+	var state InstallState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse install state: %w", err)
+	}
+	return &state, nil
+}
+
+// SaveInstallState 写入安装状态（先写临时文件再重命名）
+func SaveInstallState(stateDir string, state *InstallState) error {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	data, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return err
+	}
+	path := InstallStatePath(stateDir)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("write install state: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// NewInstallState 记录目标目录当前内容作为新的安装状态
+func NewInstallState(targetDir, version, packageHash string) (*InstallState, error) {
+	files, err := BuildFilesManifest(targetDir)
+	if err != nil {
+		return nil, err
+	}
+	return &InstallState{
+		Version:        version,
+		PackageHash:    packageHash,
+		InstalledAt:    time.Now().Format("2006-01-02 15:04:05"),
+		ManifestDigest: ManifestDigest(files),
+		Files:          files,
+	}, nil
+}
+
+// BuildFilesManifest 计算目录下所有普通文件的 MD5（路径使用 / 分隔）
+func BuildFilesManifest(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hash, err := CalculateFileHash(path, md5.New)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build files manifest: %w", err)
+	}
+	return files, nil
+}
+
+// ManifestDigest 计算文件清单的摘要，与遍历顺序无关
+func ManifestDigest(files map[string]string) string {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	hasher := sha256.New()
+	for _, p := range paths {
+		fmt.Fprintf(hasher, "%s  %s\n", files[p], p)
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil))
+}
+
+// Verify 将目标目录当前内容与安装状态比对
+func (s *InstallState) Verify(targetDir string) (*IntegrityReport, error) {
+	current, err := BuildFilesManifest(targetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{}
+	for p, hash := range s.Files {
+		got, ok := current[p]
+		switch {
+		case !ok:
+			report.Missing = append(report.Missing, p)
+		case got != hash:
+			report.Modified = append(report.Modified, p)
+		}
+	}
+	for p := range current {
+		if _, ok := s.Files[p]; !ok {
+			report.Extra = append(report.Extra, p)
+		}
+	}
+	sort.Strings(report.Modified)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	return report, nil
+}
@@ -0,0 +1,76 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallState(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "conf", "sub"), 0755))
+	for rel, content := range map[string]string{
+		"app":                 "binary",
+		"conf/app.yaml":       "port: 80\n",
+		"conf/sub/extra.conf": "",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, rel), []byte(content), 0644))
+	}
+
+	files, err := BuildFilesManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"app":                 "9d7183f16acce70658f686ae7f1a4d20",
+		"conf/app.yaml":       "93027a6c8ef590bdd8a70beb4a44df9c",
+		"conf/sub/extra.conf": "d41d8cd98f00b204e9800998ecf8427e",
+	}, files)
+
+	// 摘要只取决于内容，与 map 的遍历顺序无关
+	digest := ManifestDigest(files)
+	assert.Len(t, digest, 64)
+	assert.Equal(t, digest, ManifestDigest(map[string]string{
+		"conf/sub/extra.conf": files["conf/sub/extra.conf"],
+		"conf/app.yaml":       files["conf/app.yaml"],
+		"app":                 files["app"],
+	}))
+	assert.NotEqual(t, digest, ManifestDigest(map[string]string{"app": files["app"]}))
+
+	state, err := NewInstallState(dir, "v1.2.0", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", state.Version)
+	assert.Equal(t, "abc", state.PackageHash)
+	assert.Equal(t, files, state.Files)
+	assert.Equal(t, digest, state.ManifestDigest)
+
+	stateDir := filepath.Join(t.TempDir(), "state")
+	require.NoError(t, SaveInstallState(stateDir, state))
+	loaded, err := LoadInstallState(stateDir)
+	require.NoError(t, err)
+	assert.Equal(t, state, loaded)
+
+	missing, err := LoadInstallState(t.TempDir())
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	t.Run("未修改", func(t *testing.T) {
+		report, err := state.Verify(dir)
+		require.NoError(t, err)
+		assert.True(t, report.Intact())
+	})
+
+	t.Run("修改、缺失与多余的文件", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "conf", "app.yaml"), []byte("port: 8080\n"), 0644))
+		require.NoError(t, os.Remove(filepath.Join(dir, "conf", "sub", "extra.conf")))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "app.log"), []byte("log"), 0644))
+
+		report, err := state.Verify(dir)
+		require.NoError(t, err)
+		assert.False(t, report.Intact())
+		assert.Equal(t, []string{"conf/app.yaml"}, report.Modified)
+		assert.Equal(t, []string{"conf/sub/extra.conf"}, report.Missing)
+		assert.Equal(t, []string{"app.log"}, report.Extra)
+	})
+}
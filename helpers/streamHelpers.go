@@ -0,0 +1,491 @@
+package helpers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Re-Wi/GoKitReWi/handlers"
+	"github.com/icedream/go-bsdiff"
+)
+
+// PackageStream 顺序读取 tar.gz 升级包，package.json 必须是包内第一个文件
+type PackageStream struct {
+	Package *handlers.UpdatePackage
+
+	file *os.File
+	gz   *gzip.Reader
+	tr   *tar.Reader
+}
+
+// OpenPackageStream 打开升级包并读取其中的 package.json，其余条目留给 ApplyStream 逐个消费
+func OpenPackageStream(tarPath string) (*PackageStream, error) {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	ps := &PackageStream{file: file, gz: gz, tr: tar.NewReader(gz)}
+
+	for {
+		header, err := ps.tr.Next()
+		if err == io.EOF {
+			ps.Close()
+			return nil, fmt.Errorf("package.json not found in %s", tarPath)
+		}
+		if err != nil {
+			ps.Close()
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if payloadKey(header.Name) != "package.json" {
+			ps.Close()
+			return nil, fmt.Errorf("package.json must be the first file in the archive to stream it, found %s (repack with package.json first)", header.Name)
+		}
+
+		var pkg handlers.UpdatePackage
+		if err := json.NewDecoder(ps.tr).Decode(&pkg); err != nil {
+			ps.Close()
+			return nil, fmt.Errorf("parse package.json: %w", err)
+		}
+		ps.Package = &pkg
+		return ps, nil
+	}
+}
+
+// Close 关闭升级包
+func (ps *PackageStream) Close() error {
+	ps.gz.Close()
+	return ps.file.Close()
+}
+
+// CreatePackageArchive 将升级包目录打包为 tar.gz，package.json 作为第一个条目，便于流式应用
+func CreatePackageArchive(packageDir, target string) error {
+	manifest := filepath.Join(packageDir, "package.json")
+	if _, err := os.Stat(manifest); err != nil {
+		return fmt.Errorf("package.json: %w", err)
+	}
+
+	entries, err := os.ReadDir(packageDir)
+	if err != nil {
+		return err
+	}
+	sources := []string{manifest}
+	for _, e := range entries {
+		if e.Name() != "package.json" {
+			sources = append(sources, filepath.Join(packageDir, e.Name()))
+		}
+	}
+	return CreateTarGz(sources, target)
+}
+
+// payloadKey 统一包内路径的写法，用于匹配清单中的 Patch.Path
+func payloadKey(name string) string {
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "./")
+}
+
+// payloadNames 返回条目需要的包内数据文件
+func payloadNames(file handlers.FileEntry) []string {
+	var names []string
+	switch {
+	case file.Patch != nil && file.Patch.Path != "":
+		names = append(names, payloadKey(file.Patch.Path))
+	case file.Status == "added":
+		names = append(names, payloadKey(file.Path))
+	}
+	if file.Merge != "" && file.Base != nil {
+		names = append(names, payloadKey(file.Base.Path))
+	}
+	return names
+}
+
+// streamItem 等待数据文件的条目
+type streamItem struct {
+	file  handlers.FileEntry
+	names []string        // 需要的数据文件
+	need  map[string]bool // 尚未读到的数据文件
+	spool bool            // 需要先暂存数据文件，再按常规流程处理
+	done  bool
+}
+
+// ApplyStream 边解压边应用升级包，直接原地更新 TargetDir
+//
+// 删除条目最先执行；新增和修改条目在各自的数据流出时写入 <path>.rewi-tmp，
+// 校验通过后重命名覆盖原文件，补丁数据直接送入 bsdiff，不落盘。
+// 三方合并或存在冲突的条目需要多个输入，先把数据文件暂存到 NewTempDir，再按常规流程处理。
+// NewTempDir 应与 TargetDir 位于同一文件系统，额外占用的磁盘空间约为一个文件。
+//
+// 每个文件被替换或删除前，先以硬链接（跨文件系统时复制）备份到 NewTempDir/journal，
+// 中途失败或被取消时按记录恢复目标目录，包括升级开始后的本地修改。
+func (pa *PatchApp) ApplyStream(ctx context.Context, ps *PackageStream) (err error) {
+	journal := &streamJournal{target: filepath.Clean(pa.TargetDir), dir: filepath.Join(pa.NewTempDir, "journal"), saved: make(map[string]bool)}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if rollbackErr := journal.rollback(); rollbackErr != nil {
+			err = fmt.Errorf("%w (restore %s failed, it may be partially upgraded: %v)", err, pa.TargetDir, rollbackErr)
+		} else {
+			err = fmt.Errorf("%w (%s restored to its state before the upgrade)", err, pa.TargetDir)
+		}
+	}()
+	return pa.applyStream(ctx, ps, journal)
+}
+
+func (pa *PatchApp) applyStream(ctx context.Context, ps *PackageStream, journal *streamJournal) error {
+	files := ps.Package.Files
+	deletes, updates, err := splitEntries(files)
+	if err != nil {
+		return err
+	}
+
+	if pa.Conflicts != nil {
+		if err := pa.scanConflicts(files); err != nil {
+			return err
+		}
+		defer func() { pa.pending = nil }()
+	}
+
+	// 删除直接作用于目标目录
+	inPlace := *pa
+	inPlace.NewTempDir = pa.TargetDir
+	for _, i := range deletes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := journal.record(files[i].Path); err != nil {
+			return err
+		}
+		if err := inPlace.ProcessFile(files[i]); err != nil {
+			return err
+		}
+	}
+
+	items := make([]*streamItem, 0, len(updates))
+	waiting := make(map[string][]*streamItem)
+	refs := make(map[string]int) // 暂存的数据文件还被多少个未完成的条目使用
+	for _, i := range updates {
+		file := files[i]
+		names := payloadNames(file)
+		if len(names) == 0 {
+			return fmt.Errorf("no patch for %s", file.Path)
+		}
+
+		item := &streamItem{file: file, names: names, need: make(map[string]bool), spool: len(names) > 1 || file.Merge != ""}
+		if pa.Conflicts != nil && !item.spool {
+			conflict, err := pa.conflictFor(file)
+			if err != nil {
+				return fmt.Errorf("check %s: %w", file.Path, err)
+			}
+			item.spool = conflict != nil
+		}
+		for _, name := range names {
+			item.need[name] = true
+			waiting[name] = append(waiting[name], item)
+			refs[name]++
+		}
+		items = append(items, item)
+	}
+
+	spoolDir := filepath.Join(pa.NewTempDir, "payload")
+	defer os.RemoveAll(spoolDir)
+
+	for len(waiting) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := ps.tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		key := payloadKey(header.Name)
+		consumers := waiting[key]
+		if len(consumers) == 0 {
+			continue
+		}
+		delete(waiting, key)
+
+		if len(consumers) == 1 && !consumers[0].spool {
+			item := consumers[0]
+			if err := pa.streamEntry(item.file, ps.tr, header.FileInfo().Mode().Perm(), journal); err != nil {
+				return fmt.Errorf("process %s %s: %w", item.file.Status, item.file.Path, err)
+			}
+			item.done = true
+			continue
+		}
+
+		spooled := filepath.Join(spoolDir, filepath.FromSlash(key))
+		if err := writeFromReader(ps.tr, spooled, header.FileInfo().Mode().Perm()); err != nil {
+			return fmt.Errorf("spool %s: %w", key, err)
+		}
+		for _, item := range consumers {
+			delete(item.need, key)
+			if len(item.need) > 0 {
+				continue
+			}
+			if err := pa.processSpooled(item.file, spoolDir, journal); err != nil {
+				return err
+			}
+			item.done = true
+
+			// 暂存的数据文件不再被使用时立即删除，控制磁盘占用
+			for _, name := range item.names {
+				if refs[name]--; refs[name] == 0 {
+					os.Remove(filepath.Join(spoolDir, filepath.FromSlash(name)))
+				}
+			}
+		}
+	}
+
+	var missing []string
+	for _, item := range items {
+		if !item.done {
+			missing = append(missing, item.file.Path)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%d file(s) have no data in the package: %s", len(missing), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// streamEntry 直接由包内数据流生成新文件并原子替换
+func (pa *PatchApp) streamEntry(file handlers.FileEntry, r io.Reader, mode os.FileMode, journal *streamJournal) error {
+	dest := filepath.Join(pa.TargetDir, file.Path)
+	tmp := dest + ".rewi-tmp"
+	// 在创建临时文件与目录之前记录，恢复时才能删除新建的目录
+	if err := journal.record(file.Path); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	switch file.Status {
+	case "added":
+		if exists, _, _, _ := PathInfo(dest); exists {
+			// 已经是新版本内容（例如重复执行升级）
+			if VerifyFileHash(dest, file.Hash, md5.New) == nil {
+				return nil
+			}
+			return fmt.Errorf("file %s already exists", dest)
+		}
+		if err := writeFromReader(r, tmp, mode); err != nil {
+			return err
+		}
+
+	case "modified":
+		info, err := os.Stat(dest)
+		if err != nil {
+			return fmt.Errorf("file %s does not exist", dest)
+		}
+		oldData, err := os.Open(dest)
+		if err != nil {
+			return err
+		}
+		defer oldData.Close()
+
+		newFile, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		patchData := &hashingReader{r: r, h: md5.New()}
+		err = bsdiff.Patch(oldData, newFile, patchData)
+		if closeErr := newFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("apply patch: %w", err)
+		}
+		// 补丁读取完毕后才能确定其大小与哈希
+		if _, err := io.Copy(io.Discard, patchData); err != nil {
+			return err
+		}
+		if patchData.n != int64(file.Patch.Size) {
+			return fmt.Errorf("patch file size mismatch: expected %d, got %d", file.Patch.Size, patchData.n)
+		}
+		if sum := fmt.Sprintf("%x", patchData.h.Sum(nil)); sum != file.Patch.Hash {
+			return fmt.Errorf("verify patch file hash: hash mismatch (expected %s, got %s)", file.Patch.Hash, sum)
+		}
+
+	default:
+		return fmt.Errorf("unknown status %q for %s", file.Status, file.Path)
+	}
+
+	if err := verifyNewFile(file, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// processSpooled 数据文件已暂存，在单独的暂存目录中按常规流程处理条目，再将结果移入目标目录
+func (pa *PatchApp) processSpooled(file handlers.FileEntry, spoolDir string, journal *streamJournal) error {
+	stageDir := filepath.Join(pa.NewTempDir, "stage")
+	if err := os.RemoveAll(stageDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(stageDir)
+
+	// 以已安装文件为起点，保持与整目录暂存时相同的处理语义
+	installed := filepath.Join(pa.TargetDir, file.Path)
+	staged := filepath.Join(stageDir, file.Path)
+	if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+		return err
+	}
+	if _, isFile, _, _ := PathInfo(installed); isFile {
+		if err := CopyFile(installed, staged); err != nil {
+			return err
+		}
+	}
+
+	spooled := *pa
+	spooled.PatchTempDir = spoolDir
+	spooled.NewTempDir = stageDir
+	if err := spooled.ProcessFile(file); err != nil {
+		return err
+	}
+
+	// 结果可能包含 <path>.new 等附带文件
+	return filepath.Walk(stageDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(stageDir, p)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(pa.TargetDir, rel)
+		if err := journal.record(rel); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		return os.Rename(p, dest)
+	})
+}
+
+// streamJournal 记录流式升级替换或删除的文件，用于失败时恢复目标目录
+type streamJournal struct {
+	target  string
+	dir     string          // 被替换文件的备份目录
+	saved   map[string]bool // 已记录的相对路径
+	backups []string        // 已备份的原有文件
+	created []string        // 升级前不存在的文件与目录
+}
+
+// record 在 rel 被替换或删除前备份原文件；同一路径只记录第一次，保留升级前的内容
+func (j *streamJournal) record(rel string) error {
+	rel = filepath.Clean(rel)
+	if j.saved[rel] {
+		return nil
+	}
+	src := filepath.Join(j.target, rel)
+	info, err := os.Lstat(src)
+	switch {
+	case os.IsNotExist(err):
+		// 同时记录升级前不存在的最上层目录，恢复时一并删除
+		top := ""
+		for dir := filepath.Dir(rel); dir != "." && !j.saved[dir]; dir = filepath.Dir(dir) {
+			if _, err := os.Lstat(filepath.Join(j.target, dir)); !os.IsNotExist(err) {
+				break
+			}
+			top = dir
+		}
+		if top != "" {
+			j.created = append(j.created, top)
+			j.saved[top] = true
+		}
+		j.created = append(j.created, rel)
+	case err != nil:
+		return err
+	case info.Mode().IsRegular():
+		backup := filepath.Join(j.dir, rel)
+		if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+			return err
+		}
+		// 目标文件只会被重命名覆盖或删除，不会原地修改，硬链接即可保留原内容
+		if err := linkOrCopy(src, backup); err != nil {
+			return fmt.Errorf("back up %s: %w", rel, err)
+		}
+		j.backups = append(j.backups, rel)
+	default:
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+	j.saved[rel] = true
+	return nil
+}
+
+// rollback 删除升级中新建的文件与目录，并放回备份的原文件
+func (j *streamJournal) rollback() error {
+	var errs []string
+	for i := len(j.created) - 1; i >= 0; i-- {
+		if err := os.RemoveAll(filepath.Join(j.target, j.created[i])); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, rel := range j.backups {
+		dest := filepath.Join(j.target, rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err := os.Rename(filepath.Join(j.dir, rel), dest); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// writeFromReader 将数据写入文件并刷新到磁盘
+func writeFromReader(r io.Reader, dest string, mode os.FileMode) (err error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer SafeClose(f, &err)
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// hashingReader 统计读取的字节数并计算哈希
+type hashingReader struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	hr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,161 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Re-Wi/GoKitReWi/handlers"
+	"github.com/icedream/go-bsdiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 在升级包目录中生成修改文件的补丁，返回对应的清单条目
+func modifiedEntry(t *testing.T, packageDir, rel, oldContent, newContent string) handlers.FileEntry {
+	var patch bytes.Buffer
+	require.NoError(t, bsdiff.Diff(bytes.NewReader([]byte(oldContent)), bytes.NewReader([]byte(newContent)), &patch))
+
+	patchRel := filepath.Join("files", rel+".patch")
+	path := filepath.Join(packageDir, patchRel)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, patch.Bytes(), 0644))
+
+	return handlers.FileEntry{
+		Path:     rel,
+		Status:   "modified",
+		Size:     len(newContent),
+		Hash:     fmt.Sprintf("%x", md5.Sum([]byte(newContent))),
+		BaseHash: fmt.Sprintf("%x", md5.Sum([]byte(oldContent))),
+		Patch: &handlers.FilePatch{
+			Path: patchRel,
+			Size: patch.Len(),
+			Hash: fmt.Sprintf("%x", md5.Sum(patch.Bytes())),
+		},
+	}
+}
+
+// 打包升级包并以流式方式应用到 targetDir
+func applyStream(t *testing.T, targetDir, packageDir string, files []handlers.FileEntry) error {
+	data, err := json.Marshal(handlers.UpdatePackage{Version: "v2", Files: files})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(packageDir, "package.json"), data, 0644))
+
+	archive := filepath.Join(t.TempDir(), "pkg.tar.gz")
+	require.NoError(t, CreatePackageArchive(packageDir, archive))
+
+	ps, err := OpenPackageStream(archive)
+	require.NoError(t, err)
+	defer ps.Close()
+
+	pa := &PatchApp{TargetDir: targetDir, NewTempDir: t.TempDir()}
+	return pa.ApplyStream(context.Background(), ps)
+}
+
+func TestApplyStream(t *testing.T) {
+	t.Run("原地应用新增、修改、删除", func(t *testing.T) {
+		target, packageDir := t.TempDir(), t.TempDir()
+		createFiles(t, target, []string{"old/a.txt", "conf/"})
+		require.NoError(t, os.WriteFile(filepath.Join(target, "conf", "app.ini"), []byte("port=80\n"), 0600))
+
+		added := addedEntry(t, packageDir, "files/lib/x.txt", "new file")
+		added.Patch = &handlers.FilePatch{Path: added.Path, Size: added.Size, Hash: added.Hash}
+		added.Path = "lib/x.txt"
+		// 同名文件位于不同目录
+		other := addedEntry(t, packageDir, "files/bin/x.txt", "other file")
+		other.Patch = &handlers.FilePatch{Path: other.Path, Size: other.Size, Hash: other.Hash}
+		other.Path = "bin/x.txt"
+
+		files := []handlers.FileEntry{
+			added,
+			other,
+			modifiedEntry(t, packageDir, "conf/app.ini", "port=80\n", "port=8080\nhost=0.0.0.0\n"),
+			{Path: "old/a.txt", Status: "deleted"},
+		}
+		require.NoError(t, applyStream(t, target, packageDir, files))
+
+		data, err := os.ReadFile(filepath.Join(target, "conf", "app.ini"))
+		require.NoError(t, err)
+		assert.Equal(t, "port=8080\nhost=0.0.0.0\n", string(data))
+		info, err := os.Stat(filepath.Join(target, "conf", "app.ini"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		data, err = os.ReadFile(filepath.Join(target, "bin", "x.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "other file", string(data))
+		assert.FileExists(t, filepath.Join(target, "lib", "x.txt"))
+		assert.NoFileExists(t, filepath.Join(target, "old", "a.txt"))
+		assert.NoFileExists(t, filepath.Join(target, "conf", "app.ini.rewi-tmp"))
+	})
+
+	t.Run("补丁损坏时不覆盖原文件", func(t *testing.T) {
+		target, packageDir := t.TempDir(), t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(target, "a.txt"), []byte("v1"), 0644))
+
+		entry := modifiedEntry(t, packageDir, "a.txt", "v1", "v2")
+		entry.Patch.Hash = "0000"
+		err := applyStream(t, target, packageDir, []handlers.FileEntry{entry})
+		require.Error(t, err)
+
+		data, _ := os.ReadFile(filepath.Join(target, "a.txt"))
+		assert.Equal(t, "v1", string(data))
+		assert.NoFileExists(t, filepath.Join(target, "a.txt.rewi-tmp"))
+	})
+
+	t.Run("失败时恢复已替换的文件", func(t *testing.T) {
+		target, packageDir := t.TempDir(), t.TempDir()
+		createFiles(t, target, []string{"old.txt"})
+		require.NoError(t, os.WriteFile(filepath.Join(target, "a.txt"), []byte("v1"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(target, "z.txt"), []byte("v1"), 0644))
+
+		added := addedEntry(t, packageDir, "files/new/dir/x.txt", "new file")
+		added.Patch = &handlers.FilePatch{Path: added.Path, Size: added.Size, Hash: added.Hash}
+		added.Path = "new/dir/x.txt"
+		// z.txt 的补丁最后读到，此时其他文件已经原地替换
+		bad := modifiedEntry(t, packageDir, "z.txt", "v1", "v2")
+		bad.Patch.Hash = "0000"
+		files := []handlers.FileEntry{
+			modifiedEntry(t, packageDir, "a.txt", "v1", "v2"),
+			added,
+			bad,
+			{Path: "old.txt", Status: "deleted"},
+		}
+		err := applyStream(t, target, packageDir, files)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "restored to its state before the upgrade")
+
+		data, err := os.ReadFile(filepath.Join(target, "a.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(data))
+		assert.FileExists(t, filepath.Join(target, "old.txt"))
+		assert.NoDirExists(t, filepath.Join(target, "new"))
+		manifest, err := BuildFilesManifest(target)
+		require.NoError(t, err)
+		assert.Len(t, manifest, 3)
+	})
+
+	t.Run("缺少数据文件", func(t *testing.T) {
+		target, packageDir := t.TempDir(), t.TempDir()
+		entry := handlers.FileEntry{Path: "missing.txt", Status: "added", Patch: &handlers.FilePatch{Path: "files/missing.txt"}}
+		err := applyStream(t, target, packageDir, []handlers.FileEntry{entry})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing.txt")
+	})
+
+	t.Run("package.json 不在首位", func(t *testing.T) {
+		dir := t.TempDir()
+		createFiles(t, dir, []string{"a.txt"})
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte("{}"), 0644))
+		archive := filepath.Join(t.TempDir(), "pkg.tar.gz")
+		require.NoError(t, CreateTarGz([]string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "package.json")}, archive))
+
+		_, err := OpenPackageStream(archive)
+		assert.Error(t, err)
+	})
+}
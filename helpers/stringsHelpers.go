@@ -1,8 +1,10 @@
 package helpers
 
 import (
+	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -78,3 +80,82 @@ func UniqueStringArry(slice []string) []string {
 func ValidateVersion(version string) bool {
 	return regexp.MustCompile(`^v\d+\.\d+\.\d+(-[a-zA-Z0-9]+)?$`).MatchString(version)
 }
+
+// CompareVersions 比较两个 vX.Y.Z[-suffix] 格式的版本号
+// a < b 返回 -1，相等返回 0，a > b 返回 1；带后缀的预发布版本低于同号正式版本
+func CompareVersions(a, b string) (int, error) {
+	if !ValidateVersion(a) {
+		return 0, fmt.Errorf("invalid version %q", a)
+	}
+	if !ValidateVersion(b) {
+		return 0, fmt.Errorf("invalid version %q", b)
+	}
+
+	split := func(v string) ([3]int, string) {
+		var nums [3]int
+		core, suffix, _ := strings.Cut(strings.TrimPrefix(v, "v"), "-")
+		for i, part := range strings.SplitN(core, ".", 3) {
+			nums[i], _ = strconv.Atoi(part)
+		}
+		return nums, suffix
+	}
+	na, sa := split(a)
+	nb, sb := split(b)
+	for i := range na {
+		if na[i] != nb[i] {
+			if na[i] < nb[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	switch {
+	case sa == sb:
+		return 0, nil
+	case sa == "":
+		return 1, nil
+	case sb == "":
+		return -1, nil
+	}
+	return comparePrerelease(sa, sb), nil
+}
+
+// prereleasePart 匹配后缀中连续的数字或非数字
+var prereleasePart = regexp.MustCompile(`\d+|\D+`)
+
+// comparePrerelease 逐段比较预发布后缀，数字段按数值比较（rc2 < rc10），其余按字符串比较
+func comparePrerelease(a, b string) int {
+	pa := prereleasePart.FindAllString(a, -1)
+	pb := prereleasePart.FindAllString(b, -1)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] == pb[i] {
+			continue
+		}
+		na, errA := strconv.ParseUint(pa[i], 10, 64)
+		nb, errB := strconv.ParseUint(pb[i], 10, 64)
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case errA == nil && errB != nil:
+			// 与 semver 一致，数字段低于非数字段
+			return -1
+		case errA != nil && errB == nil:
+			return 1
+		case pa[i] < pb[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return 1
+	}
+	// 数值相同但写法不同（rc01 与 rc1）
+	return strings.Compare(a, b)
+}
@@ -116,3 +116,38 @@ func TestGetLarkbitableFromURL(t *testing.T) {
 	data1, data2, data3 := GetLarkbitableFromURL(Url)
 	fmt.Println(data1, data2, data3) // LoSQboIh7aX3tFsiylicFaijnVh tblmECWPat8rjazL vew2SODkez
 }
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "v1.2.4", -1},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v2.0.0", "v10.0.0", -1},
+		{"v1.0.0-rc1", "v1.0.0", -1},
+		{"v1.0.0", "v1.0.0-rc1", 1},
+		{"v1.0.0-rc1", "v1.0.0-rc2", -1},
+		{"v1.0.0-rc2", "v1.0.0-rc10", -1},
+		{"v1.0.0-rc10", "v1.0.0-rc2", 1},
+		{"v1.0.0-beta10", "v1.0.0-rc1", -1},
+		{"v1.0.0-alpha", "v1.0.0-alpha1", -1},
+		{"v1.0.0-1", "v1.0.0-rc", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			got, err := CompareVersions(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("CompareVersions() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CompareVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := CompareVersions("1.2", "v1.2.3"); err == nil {
+		t.Errorf("CompareVersions() expected error for invalid version")
+	}
+}
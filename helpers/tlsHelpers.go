@@ -0,0 +1,200 @@
+package helpers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// tlsVersions --tls-min 可选的版本
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion 解析 1.0/1.1/1.2/1.3，空字符串返回 0（使用 Go 的默认值）
+func ParseTLSVersion(value string) (uint16, error) {
+	if value == "" {
+		return 0, nil
+	}
+	version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(value), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q (1.0, 1.1, 1.2, 1.3)", value)
+	}
+	return version, nil
+}
+
+// configureTLS 按 CACertFile、ClientCertFile/ClientKeyFile、MinTLSVersion 与 AllowInsecure 设置 TLS
+func (nm *NetManager) configureTLS(config *tls.Config) error {
+	config.InsecureSkipVerify = nm.AllowInsecure
+	if nm.MinTLSVersion != 0 {
+		config.MinVersion = nm.MinTLSVersion
+	}
+
+	if nm.CACertFile != "" {
+		data, err := os.ReadFile(nm.CACertFile)
+		if err != nil {
+			return fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no PEM certificates found in CA bundle %s", nm.CACertFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if nm.ClientCertFile != "" || nm.ClientKeyFile != "" {
+		keyFile := nm.ClientKeyFile
+		if keyFile == "" {
+			// 证书与私钥可以放在同一个 PEM 文件中
+			keyFile = nm.ClientCertFile
+		}
+		cert, err := tls.LoadX509KeyPair(nm.ClientCertFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("load client certificate %s: %w", nm.ClientCertFile, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return nil
+}
+
+// proxyFunc ProxyURL 为空时使用环境变量 HTTP_PROXY/HTTPS_PROXY/NO_PROXY，
+// 否则所有请求都经过 ProxyURL，NoProxy（为空时取 NO_PROXY 环境变量）中的主机除外
+func (nm *NetManager) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if nm.ProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxy, err := url.Parse(nm.ProxyURL)
+	if err != nil || proxy.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", RedactURL(nm.ProxyURL))
+	}
+	noProxy := nm.NoProxy
+	if noProxy == "" {
+		noProxy = os.Getenv("NO_PROXY")
+	}
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(noProxy, req.URL) {
+			return nil, nil
+		}
+		return proxy, nil
+	}, nil
+}
+
+// bypassProxy 判断 u 是否匹配 NO_PROXY 列表
+//
+// 列表以逗号分隔：* 表示所有主机；example.com 与 .example.com 匹配该域名及其子域名；
+// 带端口的条目只匹配该端口；IP 与 CIDR 匹配对应的地址。
+func bypassProxy(noProxy string, u *url.URL) bool {
+	host, port := u.Hostname(), u.Port()
+	ip := net.ParseIP(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, ".")
+		host := strings.ToLower(host)
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// CertificateError 证书校验失败，指明是哪一张证书
+type CertificateError struct {
+	Subject string // 出错证书的主题
+	Issuer  string // 出错证书的签发者
+	Host    string // 请求的主机
+	Client  bool   // 服务器拒绝了客户端证书
+	Err     error
+}
+
+func (e *CertificateError) Error() string {
+	if e.Client {
+		return fmt.Sprintf("server %s rejected client certificate %q: %v", e.Host, e.Subject, e.Err)
+	}
+	return fmt.Sprintf("certificate %q (issuer %q) presented by %s failed verification: %v", e.Subject, e.Issuer, e.Host, e.Err)
+}
+
+func (e *CertificateError) Unwrap() error {
+	return e.Err
+}
+
+// describeCertError 把 x509 校验错误与服务器的证书告警转换为 CertificateError，其他错误原样返回
+func (nm *NetManager) describeCertError(host string, err error) error {
+	var (
+		unknown  x509.UnknownAuthorityError
+		invalid  x509.CertificateInvalidError
+		hostname x509.HostnameError
+		cert     *x509.Certificate
+	)
+	switch {
+	case errors.As(err, &unknown):
+		cert = unknown.Cert
+	case errors.As(err, &invalid):
+		cert = invalid.Cert
+	case errors.As(err, &hostname):
+		cert = hostname.Certificate
+	}
+	if cert != nil {
+		return &CertificateError{
+			Subject: cert.Subject.String(),
+			Issuer:  cert.Issuer.String(),
+			Host:    host,
+			Err:     err,
+		}
+	}
+
+	// 服务器以 TLS 告警拒绝握手时，多半是客户端证书不被信任
+	if nm.ClientCertFile != "" && strings.Contains(err.Error(), "remote error: tls:") {
+		return &CertificateError{Subject: nm.ClientCertFile, Host: host, Client: true, Err: err}
+	}
+	return err
+}
+
+// certErrorTransport 为证书校验错误补充出错证书的信息
+type certErrorTransport struct {
+	nm   *NetManager
+	next http.RoundTripper
+}
+
+func (t *certErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, t.nm.describeCertError(req.URL.Host, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,180 @@
+package helpers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBypassProxy(t *testing.T) {
+	cases := []struct {
+		noProxy string
+		url     string
+		bypass  bool
+	}{
+		{"", "http://updates.example.com/", false},
+		{"*", "http://updates.example.com/", true},
+		{"example.com", "http://updates.example.com/", true},
+		{".example.com", "http://example.com/", true},
+		{"example.com", "http://badexample.com/", false},
+		{"example.com:8443", "https://updates.example.com:8443/", true},
+		{"example.com:8443", "https://updates.example.com/", false},
+		{"10.0.0.0/8", "http://10.1.2.3:8888/", true},
+		{"10.0.0.0/8", "http://192.168.1.1/", false},
+		{"localhost, 127.0.0.1", "http://127.0.0.1:8888/", true},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		require.NoError(t, err)
+		assert.Equal(t, c.bypass, bypassProxy(c.noProxy, u), "%q %s", c.noProxy, c.url)
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	nm := newTestNetManager("http://updates.example.com/p/d/j/version.txt")
+	nm.ProxyURL = proxy.URL
+	got, err := nm.GetRemoteVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "via proxy", got)
+	assert.Equal(t, []string{"http://updates.example.com/p/d/j/version.txt"}, proxied)
+
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer direct.Close()
+	nm.ReqURL = direct.URL
+	nm.NoProxy = "127.0.0.1"
+	got, err = nm.GetRemoteVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "direct", got)
+	assert.Len(t, proxied, 1)
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	v, err := ParseTLSVersion("1.2")
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), v)
+	v, err = ParseTLSVersion("TLS1.3")
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), v)
+	_, err = ParseTLSVersion("1.4")
+	assert.Error(t, err)
+}
+
+// writeClientCert 生成自签名的客户端证书，返回证书、私钥文件与证书本身
+func writeClientCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "rewi-device"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile, cert
+}
+
+func TestTLSOptions(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.0.0"))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644))
+
+	newManager := func() *NetManager {
+		nm := newTestNetManager(srv.URL + "/version.txt")
+		nm.HTTPClient = nil
+		nm.Retries = 0
+		return nm
+	}
+
+	t.Run("CA 与客户端证书", func(t *testing.T) {
+		nm := newManager()
+		nm.CACertFile = caFile
+		nm.ClientCertFile = certFile
+		nm.ClientKeyFile = keyFile
+		nm.MinTLSVersion = tls.VersionTLS12
+		got, err := nm.GetRemoteVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v1.0.0", got)
+	})
+
+	t.Run("未信任的服务器证书", func(t *testing.T) {
+		nm := newManager()
+		nm.Retries = 2
+		_, err := nm.GetRemoteVersion(context.Background())
+		var certErr *CertificateError
+		require.True(t, errors.As(err, &certErr), "%v", err)
+		assert.False(t, certErr.Client)
+		assert.Equal(t, srv.Certificate().Subject.String(), certErr.Subject)
+		assert.Contains(t, err.Error(), certErr.Subject)
+	})
+
+	t.Run("服务器拒绝客户端证书", func(t *testing.T) {
+		otherDir := t.TempDir()
+		otherCert, otherKey, _ := writeClientCert(t, otherDir)
+		nm := newManager()
+		nm.CACertFile = caFile
+		nm.ClientCertFile = otherCert
+		nm.ClientKeyFile = otherKey
+		_, err := nm.GetRemoteVersion(context.Background())
+		var certErr *CertificateError
+		require.True(t, errors.As(err, &certErr), "%v", err)
+		assert.True(t, certErr.Client)
+		assert.Contains(t, err.Error(), otherCert)
+	})
+
+	t.Run("无效的 CA 文件", func(t *testing.T) {
+		bad := filepath.Join(dir, "bad.pem")
+		require.NoError(t, os.WriteFile(bad, []byte("not a certificate"), 0644))
+		nm := newManager()
+		nm.CACertFile = bad
+		_, err := nm.GetRemoteVersion(context.Background())
+		assert.ErrorContains(t, err, bad)
+	})
+}
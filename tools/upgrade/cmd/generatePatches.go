@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"crypto/md5"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/Re-Wi/GoKitReWi/helpers"
@@ -9,13 +11,21 @@ import (
 )
 
 func RunGenerate(cmd *cobra.Command, args []string) error {
+	specs, _ := cmd.Flags().GetStringArray("conflict")
+	conflicts, err := helpers.ParseConflictPolicies(specs)
+	if err != nil {
+		return err
+	}
+
 	config := helpers.DiffGenerator{
 		RepoURL:   helpers.MustGetString(cmd, "repo"),
 		BaseRef:   helpers.MustGetString(cmd, "base"),
 		TargetRef: helpers.MustGetString(cmd, "target"),
 		OutputDir: helpers.MustGetString(cmd, "output"),
 		Workers:   helpers.MustGetInt(cmd, "workers"),
+		Conflicts: conflicts,
 	}
+	config.MergePatterns, _ = cmd.Flags().GetStringArray("merge")
 
 	if err := config.Generate(); err != nil {
 		return fmt.Errorf("\n❌ 差异生成失败: %w", err)
@@ -23,6 +33,21 @@ func RunGenerate(cmd *cobra.Command, args []string) error {
 
 	absPath, _ := filepath.Abs(config.OutputDir)
 	fmt.Printf("\n✅ 差异生成成功！\n输出目录: %s\n", absPath)
+
+	// 打包时 package.json 放在第一个条目，升级时可使用 upgrader --stream 流式应用
+	if archive, _ := cmd.Flags().GetString("archive"); archive != "" {
+		if err := helpers.CreatePackageArchive(config.OutputDir, archive); err != nil {
+			return fmt.Errorf("\n❌ 打包失败: %w", err)
+		}
+		md5Hash, err := helpers.CalculateFileHash(archive, md5.New)
+		if err != nil {
+			return fmt.Errorf("\n❌ 计算哈希失败: %w", err)
+		}
+		if err := os.WriteFile(archive+".md5", []byte(md5Hash), 0644); err != nil {
+			return fmt.Errorf("\n❌ 写入哈希文件失败: %w", err)
+		}
+		fmt.Printf("升级包: %s (MD5 %s)\n", archive, md5Hash)
+	}
 	return nil
 }
 
@@ -40,6 +65,9 @@ func init() {
 	generateCmd.Flags().StringP("target", "t", "HEAD", "目标版本 (默认HEAD)")
 	generateCmd.Flags().StringP("output", "o", "./vX.X.X", "输出目录")
 	generateCmd.Flags().IntP("workers", "w", 4, "并行工作数")
+	generateCmd.Flags().StringArray("merge", []string{}, "按键三方合并本地修改的配置文件通配符 (JSON/YAML)")
+	generateCmd.Flags().StringP("archive", "a", "", "同时打包为 tar.gz 升级包（package.json 在首位，支持流式升级）")
+	generateCmd.Flags().StringArray("conflict", []string{}, "本地修改冲突策略，写入升级包 (glob=abort|overwrite|keep-local|keep-both)")
 
 	generateCmd.MarkFlagRequired("repo")
 	generateCmd.MarkFlagRequired("base")
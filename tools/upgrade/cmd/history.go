@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// historyCmd 列出已保存的版本快照
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List installed version snapshots",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targetDir, _ := cmd.Flags().GetString("output")
+
+		snapshots := newSnapshotManager(cmd, targetDir)
+		index, err := snapshots.LoadIndex()
+		if err != nil {
+			return err
+		}
+		if len(index.Snapshots) == 0 {
+			fmt.Printf("No snapshots in %s\n", snapshots.StateDir)
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "\tVERSION\tTIMESTAMP\tMODE\tSIZE\tID")
+		for i := len(index.Snapshots) - 1; i >= 0; i-- {
+			s := index.Snapshots[i]
+			marker := ""
+			if s.ID == index.Current {
+				marker = "*"
+			}
+			size := "-"
+			if info, err := os.Stat(filepath.Join(snapshots.StateDir, s.Path)); err == nil && !info.IsDir() {
+				size = fmt.Sprintf("%.1f KB", float64(info.Size())/1024)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", marker, s.Version, s.Timestamp, s.Mode, size, s.ID)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().StringP("output", "o", "", "Target directory")
+	historyCmd.Flags().String("state-dir", "", "State directory for snapshots (default <output>.rewi-state)")
+	_ = historyCmd.MarkFlagRequired("output")
+}
@@ -13,6 +13,9 @@ type InfoDetail struct {
 	Value string `json:"value"`
 }
 
+// Version 当前程序版本，发布时通过 -ldflags "-X github.com/Re-Wi/GoKitReWi/tools/upgrade/cmd.Version=vX.Y.Z" 注入
+var Version = "v0.0.0"
+
 // 模拟的键值对数据
 var mockData = map[string]string{
 	//作者
@@ -20,7 +23,7 @@ var mockData = map[string]string{
 	// 邮箱
 	"email": "RejoiceWindow@yeah.net",
 	//版本
-	"version": "v0.0.0",
+	"version": Version,
 	// 描述
 	"description": "增量升级工具",
 	// 文档
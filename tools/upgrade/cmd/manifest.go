@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Re-Wi/GoKitReWi/helpers"
+	"github.com/spf13/cobra"
+)
+
+// manifestCmd 服务端版本清单管理
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Generate and inspect the version manifest of a project on the update server",
+	Long: `Manage <root>/<platform>/<dependency>/<project>/manifest.json.
+
+The manifest lists every release with its publish date, release notes and
+packages (URL, size, SHA-256, MD5 and the base version of delta packages),
+the latest version of each channel with its staged rollout percentage and the
+minimum upgradeReWi version able to read it. sniffer check uses it to show the
+upgrade path and falls back to version.txt when it is missing.
+
+A channel includes the version it points to and every older release. Devices
+on a channel install the newest of those releases whose rollout includes them;
+the decision is a hash of the device id, so it is stable between runs.`,
+}
+
+// manifestGenerateCmd 扫描升级包生成清单
+var manifestGenerateCmd = &cobra.Command{
+	Use:   "generate <project-dir>",
+	Short: "Scan the *.tar.gz packages of a project directory and write manifest.json",
+	Long: `Scan the *.tar.gz packages of a project directory and write manifest.json.
+
+The version and base version of each package come from its package.json; a
+package without one is a full package named <version>.tar.gz. Publish dates,
+release notes and channels of an existing manifest are kept, and --channel is
+moved to the newest release (at --rollout percent when it is new on the
+channel). version.txt is rewritten with the newest fully rolled out stable
+version for clients that do not read the manifest yet.
+
+Examples:
+  upgradeReWi manifest generate ./repo/linux/go/app
+  upgradeReWi manifest generate ./repo/linux/go/app --channel beta --notes "Fix login timeout"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := args[0]
+		opts := helpers.ManifestOptions{Project: filepath.Base(filepath.Clean(dir))}
+		opts.Channel, _ = cmd.Flags().GetString("channel")
+		opts.MinClientVersion, _ = cmd.Flags().GetString("min-client")
+		opts.Notes, _ = cmd.Flags().GetString("notes")
+		opts.Rollout, _ = cmd.Flags().GetInt("rollout")
+		versionTxt, _ := cmd.Flags().GetBool("version-txt")
+
+		if opts.Rollout < 1 || opts.Rollout > 100 {
+			return fmt.Errorf("--rollout must be between 1 and 100")
+		}
+		if opts.MinClientVersion != "" && !helpers.ValidateVersion(opts.MinClientVersion) {
+			return fmt.Errorf("invalid --min-client %q, expected vX.Y.Z", opts.MinClientVersion)
+		}
+		m, err := helpers.GenerateManifest(dir, opts)
+		if err != nil {
+			return err
+		}
+		if err := saveManifest(dir, m, versionTxt); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s (%d releases)\n", filepath.Join(dir, helpers.ManifestFile), len(m.Releases))
+		return printManifest(m)
+	},
+}
+
+// manifestPromoteCmd 将通道指向某个版本
+var manifestPromoteCmd = &cobra.Command{
+	Use:   "promote <project-dir> <version>",
+	Short: "Point a channel at a release, optionally as a staged rollout",
+	Long: `Point a channel at a release, optionally as a staged rollout.
+
+Examples:
+  # Publish v1.4.0 to 5% of the stable devices
+  upgradeReWi manifest promote ./repo/linux/go/app v1.4.0 --channel stable --rollout 5
+
+  # Move beta to v1.5.0-rc1 for every beta device
+  upgradeReWi manifest promote ./repo/linux/go/app v1.5.0-rc1 --channel beta`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, version := args[0], args[1]
+		channel, _ := cmd.Flags().GetString("channel")
+		percent, _ := cmd.Flags().GetInt("rollout")
+		versionTxt, _ := cmd.Flags().GetBool("version-txt")
+
+		m, err := helpers.LoadManifest(filepath.Join(dir, helpers.ManifestFile))
+		if err != nil {
+			return err
+		}
+		previous := m.Channels[channel]
+		if err := m.Promote(channel, version, percent); err != nil {
+			return err
+		}
+		if err := saveManifest(dir, m, versionTxt); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s -> %s (%d%% rollout)\n", channel, displayOr(previous, "(none)"), version, percent)
+		return nil
+	},
+}
+
+// manifestRolloutCmd 调整版本的灰度百分比
+var manifestRolloutCmd = &cobra.Command{
+	Use:   "rollout <project-dir> <version> <percent>",
+	Short: "Change the staged rollout percentage of a release on a channel",
+	Long: `Change the staged rollout percentage of a release on a channel.
+
+Raising the percentage keeps every device that already received the release;
+0 halts the rollout and 100 completes it.
+
+Examples:
+  upgradeReWi manifest rollout ./repo/linux/go/app v1.4.0 25
+  upgradeReWi manifest rollout ./repo/linux/go/app v1.4.0 0 --channel stable`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, version := args[0], args[1]
+		channel, _ := cmd.Flags().GetString("channel")
+		versionTxt, _ := cmd.Flags().GetBool("version-txt")
+		percent, err := strconv.Atoi(strings.TrimSuffix(args[2], "%"))
+		if err != nil {
+			return fmt.Errorf("invalid percentage %q", args[2])
+		}
+
+		m, err := helpers.LoadManifest(filepath.Join(dir, helpers.ManifestFile))
+		if err != nil {
+			return err
+		}
+		release := m.Release(version)
+		if release == nil {
+			return fmt.Errorf("version %s not found in manifest", version)
+		}
+		previous := release.RolloutPercent(channel)
+		if err := m.SetRollout(channel, version, percent); err != nil {
+			return err
+		}
+		if err := saveManifest(dir, m, versionTxt); err != nil {
+			return err
+		}
+		fmt.Printf("%s on %s: %d%% -> %d%%\n", version, channel, previous, percent)
+		if m.Channels[channel] != version {
+			fmt.Printf("Note: %s points to %s, use promote to move it\n", channel, displayOr(m.Channels[channel], "nothing"))
+		}
+		return nil
+	},
+}
+
+// saveManifest 写入清单，并按需将完全发布的最新 stable 版本写入 version.txt
+func saveManifest(dir string, m *helpers.Manifest, versionTxt bool) error {
+	if err := helpers.SaveManifest(filepath.Join(dir, helpers.ManifestFile), m); err != nil {
+		return err
+	}
+	if !versionTxt {
+		return nil
+	}
+	// 不认识清单的旧客户端无法灰度，只给它们完全发布的版本
+	stable, err := m.Resolve(helpers.ChannelStable, "")
+	if err != nil {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(dir, "version.txt"), []byte(stable.Version+"\n"), 0644)
+}
+
+func displayOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// manifestShowCmd 显示本地清单
+var manifestShowCmd = &cobra.Command{
+	Use:   "show <project-dir>",
+	Short: "Print the channels and releases of a manifest",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := helpers.LoadManifest(filepath.Join(args[0], helpers.ManifestFile))
+		if err != nil {
+			return err
+		}
+		return printManifest(m)
+	},
+}
+
+// printManifest 输出通道与发布版本
+func printManifest(m *helpers.Manifest) error {
+	channels := make([]string, 0, len(m.Channels))
+	for channel := range m.Channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	fmt.Printf("project: %s\n", m.Project)
+	for _, channel := range channels {
+		fmt.Printf("  %s: %s\n", channel, m.Channels[channel])
+	}
+	if m.MinClientVersion != "" {
+		fmt.Printf("min client version: %s\n", m.MinClientVersion)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tPUBLISHED\tROLLOUT\tPACKAGE\tBASE\tSIZE")
+	for _, r := range m.Releases {
+		rollout := "-"
+		if len(r.Rollout) > 0 {
+			parts := make([]string, 0, len(r.Rollout))
+			for channel, percent := range r.Rollout {
+				parts = append(parts, fmt.Sprintf("%s=%d%%", channel, percent))
+			}
+			sort.Strings(parts)
+			rollout = strings.Join(parts, ",")
+		}
+		for _, p := range r.Packages {
+			base := "full"
+			if !p.Full() {
+				base = p.BaseVersion
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Version, r.PublishedAt.Local().Format("2006-01-02 15:04"), rollout, p.URL, base, helpers.FormatBytes(p.Size))
+		}
+	}
+	return w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(manifestCmd)
+	manifestCmd.AddCommand(manifestGenerateCmd, manifestShowCmd, manifestPromoteCmd, manifestRolloutCmd)
+
+	manifestGenerateCmd.Flags().String("channel", helpers.ChannelStable, "Channel that points to the newest release")
+	manifestGenerateCmd.Flags().String("min-client", "", "Minimum upgradeReWi version required to use this manifest (vX.Y.Z)")
+	manifestGenerateCmd.Flags().String("notes", "", "Release notes of the newest release (default: package.json description)")
+	manifestGenerateCmd.Flags().Int("rollout", 100, "Rollout percentage when the newest release is new on --channel")
+	for _, c := range []*cobra.Command{manifestGenerateCmd, manifestPromoteCmd, manifestRolloutCmd} {
+		c.Flags().Bool("version-txt", true, "Also write version.txt with the newest fully rolled out stable version for older clients")
+	}
+	for _, c := range []*cobra.Command{manifestPromoteCmd, manifestRolloutCmd} {
+		c.Flags().String("channel", helpers.ChannelStable, "Release channel")
+	}
+	manifestPromoteCmd.Flags().Int("rollout", 100, "Percentage of the channel's devices that receive the release")
+}
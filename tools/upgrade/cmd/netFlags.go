@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Re-Wi/GoKitReWi/helpers"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// bindNetFlags 注册访问更新服务器的公共参数
+func bindNetFlags(cmd *cobra.Command) {
+	cmd.Flags().String("base-url", baseURL, "Update server base URL")
+	cmd.Flags().StringArray("mirror", []string{}, "Mirror base URL with the same layout as --base-url (repeatable, tried in order on failure)")
+	cmd.Flags().StringArrayP("header", "H", []string{}, "Extra request headers (key:value)")
+	cmd.Flags().Duration("timeout", 5*time.Minute, "Timeout for each attempt to receive response headers, and for each stall while reading the body")
+	cmd.Flags().Int("retries", 3, "Number of retries for failed requests")
+	cmd.Flags().BoolP("insecure", "k", false, "Skip TLS certificate verification")
+	cmd.Flags().Int("segments", 4, "Download large files in this many parallel byte ranges when the server supports it")
+	cmd.Flags().Bool("keep-partial", false, "Keep the .part file of a cancelled download so the next run resumes it")
+	cmd.Flags().BoolP("quiet", "q", false, "Do not show download progress")
+	cmd.Flags().String("limit-rate", "", "Maximum download rate shared by all segments, e.g. 500KB/s (default unlimited)")
+	cmd.Flags().String("limit-schedule", "", "Daily local-time windows overriding --limit-rate, e.g. 22:00-06:00=0,12:00-13:00=2MB/s (0 = full speed)")
+	bindAuthFlags(cmd)
+	bindTLSFlags(cmd)
+}
+
+// bindCacheFlags 注册 HTTP 缓存参数，只用于版本检查与描述文件下载，升级包等下载不经过缓存
+func bindCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().String("http-cache", "", "Directory caching version files and descriptions (default <user cache dir>/upgradeReWi/http)")
+	cmd.Flags().Bool("no-cache", false, "Do not use the HTTP cache")
+	cmd.Flags().Bool("offline", false, "Answer from the HTTP cache (with a warning) when the server is unreachable")
+}
+
+// applyCacheFlags 按 bindCacheFlags 注册的参数为 NetManager 配置 HTTP 缓存，需在 newNetManager 之后调用
+func applyCacheFlags(cmd *cobra.Command, nm *helpers.NetManager) error {
+	noCache, _ := cmd.Flags().GetBool("no-cache")
+	offline, _ := cmd.Flags().GetBool("offline")
+	if offline && noCache {
+		return errors.New("--offline requires the HTTP cache, remove --no-cache")
+	}
+	if noCache {
+		return nil
+	}
+	// 带认证的响应不写入缓存，离线时也就没有可用的内容
+	if offline && nm.Auth != nil {
+		return errors.New("--offline cannot be used with --auth, authenticated responses are not cached")
+	}
+	cacheDir, _ := cmd.Flags().GetString("http-cache")
+	if cacheDir == "" {
+		var err error
+		if cacheDir, err = helpers.DefaultHTTPCacheDir(); err != nil {
+			return fmt.Errorf("locate HTTP cache: %w (use --http-cache or --no-cache)", err)
+		}
+	}
+	nm.Cache = helpers.NewHTTPCache(cacheDir)
+	nm.Cache.StaleIfError = offline
+	return nil
+}
+
+// bindTLSFlags 注册 CA、客户端证书、TLS 版本与代理参数
+func bindTLSFlags(cmd *cobra.Command) {
+	cmd.Flags().String("cacert", "", "CA bundle (PEM) used to verify the server instead of the system roots")
+	cmd.Flags().String("cert", "", "Client certificate (PEM) for mutual TLS")
+	cmd.Flags().String("key", "", "Private key (PEM) for --cert (default: read from the --cert file)")
+	cmd.Flags().String("tls-min", "", "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	cmd.Flags().String("proxy", "", "Proxy URL for all requests (default HTTP_PROXY/HTTPS_PROXY)")
+	cmd.Flags().String("noproxy", "", "Comma-separated hosts, domains or CIDRs that bypass --proxy (default NO_PROXY)")
+}
+
+// applyTLSFlags 将 bindTLSFlags 注册的参数写入 NetManager
+func applyTLSFlags(cmd *cobra.Command, nm *helpers.NetManager) error {
+	nm.CACertFile, _ = cmd.Flags().GetString("cacert")
+	nm.ClientCertFile, _ = cmd.Flags().GetString("cert")
+	nm.ClientKeyFile, _ = cmd.Flags().GetString("key")
+	nm.ProxyURL, _ = cmd.Flags().GetString("proxy")
+	nm.NoProxy, _ = cmd.Flags().GetString("noproxy")
+	minTLS, _ := cmd.Flags().GetString("tls-min")
+	version, err := helpers.ParseTLSVersion(minTLS)
+	if err != nil {
+		return err
+	}
+	nm.MinTLSVersion = version
+	return nil
+}
+
+// bindAuthFlags 注册认证参数，密钥只从环境变量或文件读取，不出现在命令行中
+func bindAuthFlags(cmd *cobra.Command) {
+	cmd.Flags().String("auth", "", "Authentication: token, basic, netrc or hmac (default none)")
+	cmd.Flags().String("auth-config", "", "YAML/JSON file with the auth settings; flags override it")
+	cmd.Flags().String("token-env", "REWI_TOKEN", "Environment variable holding the bearer token")
+	cmd.Flags().String("token-file", "", "File holding the bearer token (takes precedence over --token-env)")
+	cmd.Flags().String("auth-user", "", "User name for basic auth")
+	cmd.Flags().String("password-env", "REWI_PASSWORD", "Environment variable holding the basic auth password")
+	cmd.Flags().String("netrc", "", "netrc file (default $NETRC or ~/.netrc)")
+	cmd.Flags().String("hmac-key-id", "", "Key id sent with HMAC signed requests")
+	cmd.Flags().String("hmac-secret-env", "REWI_HMAC_SECRET", "Environment variable holding the HMAC secret")
+	cmd.Flags().String("hmac-secret-file", "", "File holding the HMAC secret (takes precedence over --hmac-secret-env)")
+}
+
+// newAuthProvider 合并 --auth-config 与命令行参数创建认证方式，未配置时返回 nil
+func newAuthProvider(cmd *cobra.Command) (helpers.AuthProvider, error) {
+	cfg := &helpers.AuthConfig{}
+	if path, _ := cmd.Flags().GetString("auth-config"); path != "" {
+		var err error
+		if cfg, err = helpers.LoadAuthConfig(path); err != nil {
+			return nil, fmt.Errorf("load auth config: %w", err)
+		}
+	}
+
+	// 显式指定的参数覆盖配置文件，参数默认值只填补配置文件中缺少的项
+	for flag, field := range map[string]*string{
+		"auth":             &cfg.Type,
+		"token-env":        &cfg.TokenEnv,
+		"token-file":       &cfg.TokenFile,
+		"auth-user":        &cfg.Username,
+		"password-env":     &cfg.PassEnv,
+		"netrc":            &cfg.Netrc,
+		"hmac-key-id":      &cfg.KeyID,
+		"hmac-secret-env":  &cfg.SecretEnv,
+		"hmac-secret-file": &cfg.SecretFile,
+	} {
+		if value, _ := cmd.Flags().GetString(flag); cmd.Flags().Changed(flag) || *field == "" {
+			*field = value
+		}
+	}
+	return helpers.NewAuthProvider(*cfg)
+}
+
+// bindFixtureFlags 注册录制与回放参数
+func bindFixtureFlags(cmd *cobra.Command) {
+	cmd.Flags().String("record", "", "Record requests and responses to this fixture file (.har for HAR, otherwise JSON); appends to an existing file, bodies over 1 MiB are recorded by size only")
+	cmd.Flags().String("replay", "", "Answer requests from this fixture file (JSON or HAR) instead of the network")
+}
+
+// applyFixtureFlags 按 bindFixtureFlags 注册的参数录制或回放，返回的函数保存录制结果
+func applyFixtureFlags(cmd *cobra.Command, nm *helpers.NetManager) (save func() error, err error) {
+	record, _ := cmd.Flags().GetString("record")
+	replay, _ := cmd.Flags().GetString("replay")
+	save = func() error { return nil }
+	if replay != "" {
+		fixtures, err := helpers.LoadFixtures(replay)
+		if err != nil {
+			return nil, err
+		}
+		nm.HTTPClient = &http.Client{Transport: helpers.NewFixtureReplayer(fixtures, helpers.FixtureMatch{})}
+	}
+	if record != "" {
+		fixtures, err := helpers.LoadFixtures(record)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		nm.Recorder = helpers.NewFixtureRecorder(fixtures...)
+		save = func() error {
+			if err := nm.Recorder.Save(record); err != nil {
+				return fmt.Errorf("save fixtures: %w", err)
+			}
+			return nil
+		}
+	}
+	return save, nil
+}
+
+// bindChannelFlags 注册发布通道与灰度使用的设备标识参数
+func bindChannelFlags(cmd *cobra.Command) {
+	cmd.Flags().String("channel", helpers.ChannelStable, "Release channel: stable, beta or nightly")
+	cmd.Flags().String("device-id", "", "Device id deciding staged rollouts (default $REWI_DEVICE_ID or an id saved in the user config dir)")
+}
+
+// channelFlags 返回 bindChannelFlags 注册的通道与设备标识，设备标识不可用时只使用完全发布的版本
+func channelFlags(cmd *cobra.Command) (channel, deviceID string) {
+	channel, _ = cmd.Flags().GetString("channel")
+	deviceID, _ = cmd.Flags().GetString("device-id")
+	if deviceID == "" {
+		var err error
+		if deviceID, err = helpers.DeviceID(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: no device id (%v), staged rollouts are skipped\n", err)
+		}
+	}
+	return channel, deviceID
+}
+
+// newNetManager 根据 bindNetFlags 注册的参数创建 NetManager
+func newNetManager(cmd *cobra.Command) *helpers.NetManager {
+	server, _ := cmd.Flags().GetString("base-url")
+	headers, _ := cmd.Flags().GetStringArray("header")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	retries, _ := cmd.Flags().GetInt("retries")
+	insecure, _ := cmd.Flags().GetBool("insecure")
+	segments, _ := cmd.Flags().GetInt("segments")
+	mirrors, _ := cmd.Flags().GetStringArray("mirror")
+	keepPartial, _ := cmd.Flags().GetBool("keep-partial")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	nm := helpers.NewNetManager()
+	nm.BaseURL = server
+	nm.ReqMethod = "GET"
+	nm.ReqHeaders = headers
+	nm.FollowRedirects = true
+	nm.AllowInsecure = insecure
+	nm.Retries = retries
+	nm.Timeout = timeout
+	nm.HTTPClient.Timeout = timeout
+	nm.Segments = segments
+	nm.KeepPartial = keepPartial
+	nm.Progress = newProgressPrinter(quiet)
+
+	auth, err := newAuthProvider(cmd)
+	if err != nil {
+		fatal("%v", err)
+	}
+	nm.Auth = auth
+
+	if err := applyTLSFlags(cmd, nm); err != nil {
+		fatal("%v", err)
+	}
+
+	limitRate, _ := cmd.Flags().GetString("limit-rate")
+	limitSchedule, _ := cmd.Flags().GetString("limit-schedule")
+	rate, err := helpers.ParseRate(limitRate)
+	if err != nil {
+		fatal("%v", err)
+	}
+	schedule, err := helpers.ParseRateSchedule(limitSchedule)
+	if err != nil {
+		fatal("%v", err)
+	}
+	nm.RateLimit = helpers.NewRateLimiter(rate, schedule)
+
+	nm.Logger = newConsoleLogger()
+
+	if len(mirrors) > 0 {
+		pool, err := helpers.NewMirrorPool(append([]string{server}, mirrors...))
+		if err != nil {
+			fatal("%v", err)
+		}
+		nm.Mirrors = pool
+	}
+	return nm
+}
+
+// newConsoleLogger 输出到 stderr 的 Info 级别日志，用于显示重试、续传与镜像切换
+func newConsoleLogger() *zap.Logger {
+	config := zap.NewDevelopmentConfig()
+	config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	config.DisableStacktrace = true
+	config.DisableCaller = true
+	logger, err := config.Build()
+	if err != nil {
+		return zap.NewNop()
+	}
+	return logger
+}
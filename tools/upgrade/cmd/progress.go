@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Re-Wi/GoKitReWi/helpers"
+)
+
+// progressLogInterval 非终端输出时两行进度日志之间的间隔
+const progressLogInterval = 5 * time.Second
+
+// newProgressPrinter 进度输出到 stderr，不混入重定向到文件或管道的 stdout 数据；
+// stderr 是终端时绘制进度条，否则定期输出进度日志；quiet 时不报告进度
+func newProgressPrinter(quiet bool) helpers.ProgressFunc {
+	if quiet {
+		return nil
+	}
+	// 同一个回调可能被并发的多次传输共用
+	var mu sync.Mutex
+	if isTerminal(os.Stderr) {
+		return func(p helpers.Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			printProgressBar(p)
+		}
+	}
+	var last time.Time
+	return func(p helpers.Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !p.Final && time.Since(last) < progressLogInterval {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "%s %s\n", progressLabel(p), progressStats(p))
+	}
+}
+
+// isTerminal 判断文件是否为字符设备（终端）
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+const progressBarWidth = 30
+
+// printProgressBar 在同一行刷新进度条，传输结束时换行
+func printProgressBar(p helpers.Progress) {
+	bar := strings.Repeat("-", progressBarWidth)
+	if percent := p.Percent(); percent >= 0 {
+		filled := int(percent / 100 * progressBarWidth)
+		if filled > progressBarWidth {
+			filled = progressBarWidth
+		}
+		bar = strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s [%s] %s", progressLabel(p), bar, progressStats(p))
+	if p.Final {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// progressLabel 显示 URL 中的文件名
+func progressLabel(p helpers.Progress) string {
+	name := p.Name
+	if u, err := url.Parse(p.Name); err == nil && u.Path != "" {
+		name = path.Base(u.Path)
+	}
+	if p.Upload {
+		return "upload " + name
+	}
+	return name
+}
+
+// progressStats 已传输/总长度、百分比、速率与剩余时间
+func progressStats(p helpers.Progress) string {
+	stats := helpers.FormatBytes(p.Done)
+	if p.Total > 0 {
+		stats += fmt.Sprintf("/%s %5.1f%%", helpers.FormatBytes(p.Total), p.Percent())
+	}
+	stats += fmt.Sprintf(" %s/s", helpers.FormatBytes(int64(p.Rate)))
+	if !p.Final && p.ETA >= 0 {
+		stats += " ETA " + p.ETA.Round(time.Second).String()
+	}
+	return stats
+}
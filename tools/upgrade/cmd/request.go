@@ -1,29 +1,97 @@
 package cmd
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/Re-Wi/GoKitReWi/helpers"
 	"github.com/spf13/cobra"
 )
 
-var config = helpers.NetManager{
-	BaseURL: baseURL,
-}
+var config = func() *helpers.NetManager {
+	nm := helpers.NewNetManager()
+	nm.BaseURL = baseURL
+	return nm
+}()
+
+// requestOutput request 命令输出响应的方式
+var requestOutput helpers.RequestOutput
 
 // 网络请求
 var requestCmd = &cobra.Command{
 	Use:   "request",
 	Short: "Send HTTP request with custom parameters",
-	RunE:  config.SendRequest,
+	Long: `Send an HTTP request and print the status, headers and body.
+
+Examples:
+  upgradeReWi request -u https://api.example.com/items --json
+  upgradeReWi request -u https://api.example.com/items -d @item.json -H "Content-Type: application/json"
+  upgradeReWi request -u https://api.example.com/upload -F name=report -F file=@report.pdf\;type=application/pdf
+  upgradeReWi request -u https://api.example.com/export -o export.csv --fail --silent
+  upgradeReWi request -u https://api.example.com/items --auth token --as-curl
+  upgradeReWi request -u https://api.example.com/items --record testdata/items.json
+  upgradeReWi request -u https://api.example.com/items --replay testdata/items.json`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		config.Progress = newProgressPrinter(quiet || requestOutput.Silent)
+
+		// 与 curl 一致，带请求体时默认使用 POST
+		if !cmd.Flags().Changed("method") && (config.ReqBody != "" || len(config.ReqForm) > 0) {
+			config.ReqMethod = "POST"
+		}
+
+		auth, err := newAuthProvider(cmd)
+		if err != nil {
+			return err
+		}
+		config.Auth = auth
+		return applyTLSFlags(cmd, config)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if asCurl, _ := cmd.Flags().GetBool("as-curl"); asCurl {
+			command, err := config.CurlCommand(requestOutput)
+			if err != nil {
+				return err
+			}
+			fmt.Println(command)
+			return nil
+		}
+		save, err := applyFixtureFlags(cmd, config)
+		if err != nil {
+			return err
+		}
+		// 请求本身的失败（--fail 的 4xx/5xx 等）不需要打印用法
+		cmd.SilenceUsage = true
+		err = config.SendRequestContext(cmd.Context(), requestOutput)
+		// 失败的请求同样保存，回放时可以复现
+		if saveErr := save(); err == nil {
+			err = saveErr
+		}
+		return err
+	},
 }
 
 func init() {
 	rootCmd.AddCommand(requestCmd)
 	requestCmd.Flags().StringVarP(&config.ReqURL, "url", "u", "", "Target URL (required)")
-	requestCmd.Flags().StringVarP(&config.ReqMethod, "method", "m", "GET", "HTTP method")
+	requestCmd.Flags().StringVarP(&config.ReqMethod, "method", "m", "GET", "HTTP method (default POST when a body or form is given)")
 	requestCmd.Flags().StringArrayVarP(&config.ReqHeaders, "header", "H", []string{}, "Request headers (key:value)")
-	requestCmd.Flags().StringVarP(&config.ReqBody, "body", "b", "", "Request body")
-	requestCmd.Flags().DurationVar(&config.Timeout, "timeout", 30*time.Second, "Request timeout")
+	requestCmd.Flags().StringVarP(&config.ReqBody, "body", "b", "", "Request body, @file reads it from a file (@- for stdin)")
+	requestCmd.Flags().StringVarP(&config.ReqBody, "data", "d", "", "Same as --body")
+	requestCmd.Flags().StringArrayVarP(&config.ReqForm, "form", "F", []string{}, "Multipart form field name=value or name=@file[;type=mime] (repeatable)")
+	requestCmd.Flags().StringVarP(&requestOutput.OutputFile, "output", "o", "", "Write the response body to this file")
+	requestCmd.Flags().BoolVar(&requestOutput.PrettyJSON, "json", false, "Send Accept: application/json and pretty-print JSON responses")
+	requestCmd.Flags().BoolVarP(&requestOutput.Include, "include", "i", false, "Print the status line and headers like curl -i")
+	requestCmd.Flags().BoolVarP(&requestOutput.Silent, "silent", "s", false, "Print only the response body, no progress")
+	requestCmd.Flags().BoolVarP(&config.FailOnError, "fail", "f", false, "Exit with code 22 and no output on HTTP 4xx/5xx")
+	requestCmd.Flags().Bool("as-curl", false, "Print the equivalent curl command (credentials redacted) instead of sending")
+	requestCmd.Flags().DurationVar(&config.Timeout, "timeout", 30*time.Second, "Timeout for each attempt")
+	requestCmd.Flags().IntVar(&config.Retries, "retries", 0, "Retries for connection errors and 408/429/5xx responses (non-idempotent methods only on 429/503)")
+	requestCmd.Flags().BoolVarP(&config.AllowInsecure, "insecure", "k", false, "Skip TLS certificate verification")
+	requestCmd.Flags().BoolVarP(&config.FollowRedirects, "location", "L", true, "Follow redirects")
+	requestCmd.Flags().BoolP("quiet", "q", false, "Do not show upload and download progress")
+	bindAuthFlags(requestCmd)
+	bindTLSFlags(requestCmd)
+	bindFixtureFlags(requestCmd)
 	_ = requestCmd.MarkFlagRequired("url")
 }
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Re-Wi/GoKitReWi/helpers"
+	"github.com/spf13/cobra"
+)
+
+// 按集合文件批量执行请求
+var requestRunCmd = &cobra.Command{
+	Use:   "run <collection.yaml>",
+	Short: "Run a collection of requests with assertions",
+	Long: `Run the named requests of a YAML collection in order, extracting values from
+responses into variables and checking assertions on status, headers and body.
+
+Strings may reference {{name}} variables (collection variables, --var and values
+extracted from earlier responses) and {{env.NAME}} environment variables.
+Extract sources are JSON paths ($.data.items[0].id), header:Name or status.
+
+Example collection:
+  name: smoke
+  variables:
+    base: https://api.example.com
+  requests:
+    - name: login
+      method: POST
+      url: "{{base}}/login"
+      body: '{"user": "{{env.API_USER}}", "password": "{{env.API_PASSWORD}}"}'
+      headers: {Content-Type: application/json}
+      extract: {token: $.token}
+    - name: list items
+      url: "{{base}}/items"
+      headers: {Authorization: "Bearer {{token}}"}
+      assert:
+        status: 200
+        headers: {Content-Type: application/json}
+        body_contains: [items]
+        json: {$.total: 3}
+        max_time: 500ms
+
+Examples:
+  upgradeReWi request run smoke.yaml --var base=http://localhost:8080
+  upgradeReWi request run smoke.yaml --format junit --report smoke.xml
+  upgradeReWi request run smoke.yaml --record testdata/smoke.har
+  upgradeReWi request run smoke.yaml --replay testdata/smoke.har`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if format != "table" && format != "junit" {
+			return fmt.Errorf("unknown format %q, expected table or junit", format)
+		}
+		vars := make(map[string]string)
+		pairs, _ := cmd.Flags().GetStringArray("var")
+		for _, pair := range pairs {
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok || name == "" {
+				return fmt.Errorf("invalid --var %q, expected name=value", pair)
+			}
+			vars[name] = value
+		}
+
+		// 以下为集合与执行结果的错误，不需要打印用法
+		cmd.SilenceUsage = true
+		collection, err := helpers.LoadCollection(args[0])
+		if err != nil {
+			return err
+		}
+
+		nm := helpers.NewNetManager()
+		nm.Timeout, _ = cmd.Flags().GetDuration("timeout")
+		nm.HTTPClient.Timeout = nm.Timeout
+		nm.Retries, _ = cmd.Flags().GetInt("retries")
+		nm.AllowInsecure, _ = cmd.Flags().GetBool("insecure")
+		nm.FollowRedirects, _ = cmd.Flags().GetBool("location")
+		if nm.Auth, err = newAuthProvider(cmd); err != nil {
+			return err
+		}
+		if err := applyTLSFlags(cmd, nm); err != nil {
+			return err
+		}
+		save, err := applyFixtureFlags(cmd, nm)
+		if err != nil {
+			return err
+		}
+
+		failFast, _ := cmd.Flags().GetBool("fail-fast")
+		report, err := nm.RunCollection(cmd.Context(), collection, helpers.CollectionOptions{Variables: vars, FailFast: failFast})
+		if saveErr := save(); err == nil {
+			err = saveErr
+		}
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer = os.Stdout
+		if path, _ := cmd.Flags().GetString("report"); path != "" {
+			file, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			out = file
+		}
+		if format == "junit" {
+			err = report.WriteJUnit(out)
+		} else {
+			err = report.WriteTable(out)
+		}
+		if err != nil {
+			return fmt.Errorf("write report: %w", err)
+		}
+
+		if failed := report.Failed(); failed > 0 {
+			return fmt.Errorf("%d of %d requests failed", failed, len(report.Results))
+		}
+		return nil
+	},
+}
+
+func init() {
+	requestCmd.AddCommand(requestRunCmd)
+	requestRunCmd.Flags().StringArray("var", []string{}, "Set a variable name=value, overriding the collection (repeatable)")
+	requestRunCmd.Flags().String("format", "table", "Report format: table or junit")
+	requestRunCmd.Flags().String("report", "", "Write the report to this file instead of stdout")
+	requestRunCmd.Flags().Bool("fail-fast", false, "Stop after the first failed request")
+	requestRunCmd.Flags().Duration("timeout", 30*time.Second, "Timeout for each attempt")
+	requestRunCmd.Flags().Int("retries", 0, "Retries for connection errors and 408/429/5xx responses (non-idempotent methods only on 429/503)")
+	requestRunCmd.Flags().BoolP("insecure", "k", false, "Skip TLS certificate verification")
+	requestRunCmd.Flags().BoolP("location", "L", true, "Follow redirects")
+	bindAuthFlags(requestRunCmd)
+	bindTLSFlags(requestRunCmd)
+	bindFixtureFlags(requestRunCmd)
+}
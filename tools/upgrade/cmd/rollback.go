@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Re-Wi/GoKitReWi/helpers"
+	"github.com/spf13/cobra"
+)
+
+// rollbackCmd 恢复历史版本快照
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore a previously installed version from its snapshot",
+	Long: `Restore the target directory from a snapshot saved by upgrader.
+
+Examples:
+  # Roll back to the version installed before the current one
+  upgradeReWi rollback -o /opt/app
+
+  # Roll back to a specific version
+  upgradeReWi rollback -o /opt/app --to v1.2.0`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targetDir, _ := cmd.Flags().GetString("output")
+		version, _ := cmd.Flags().GetString("to")
+
+		snapshots := newSnapshotManager(cmd, targetDir)
+		entry, err := snapshots.Restore(targetDir, version)
+		if err != nil {
+			return fmt.Errorf("rollback failed: %w", err)
+		}
+
+		fmt.Printf("Rolled back %s to %s (snapshot %s, %s)\n", targetDir, entry.Version, entry.ID, entry.Timestamp)
+
+		// 回滚后的安装状态以快照版本为准
+		state, err := helpers.NewInstallState(targetDir, entry.Version, "")
+		if err != nil {
+			return fmt.Errorf("record install state: %w", err)
+		}
+		return helpers.SaveInstallState(snapshots.StateDir, state)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().StringP("output", "o", "", "Target directory to restore")
+	rollbackCmd.Flags().String("to", "", "Version to restore (default: the version before the current one)")
+	rollbackCmd.Flags().String("state-dir", "", "State directory for snapshots (default <output>.rewi-state)")
+	_ = rollbackCmd.MarkFlagRequired("output")
+}
@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -11,12 +15,29 @@ var rootCmd = &cobra.Command{
 	Use:   "upgradeReWi",
 	Short: "A CLI tool for compression, decompression, and info details",
 	Long:  `A simple CLI tool that supports creating zip files, extracting zip files, and fetching detailed information by key.`,
+	// 错误由 Execute 统一输出到标准错误，避免重复打印
+	SilenceErrors: true,
 }
 
 func Execute() {
+	// SIGINT/SIGTERM 取消根 context，进行中的传输停止并清理临时文件
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// 第一次信号后恢复默认处理，再次按 Ctrl-C 立即退出
+		<-ctx.Done()
+		stop()
+	}()
+
 	// 执行命令
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		// 标准输出可能是 request 的响应体，错误只写到标准错误
+		fmt.Fprintln(os.Stderr, err)
+		// 错误可以指定退出码，如 request --fail 的 22
+		var exit interface{ ExitCode() int }
+		if errors.As(err, &exit) {
+			os.Exit(exit.ExitCode())
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Re-Wi/GoKitReWi/helpers"
+	"github.com/spf13/cobra"
+)
+
+// selfUpdateCmd 升级 upgradeReWi 自身
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update the upgradeReWi binary itself",
+	Long: `Check the update server for a newer upgradeReWi release and replace the
+running executable with it.
+
+The server layout is the same as for sniffer:
+  <base-url>/<platform>/<dependency>/<project>/version.txt
+  <base-url>/<platform>/<dependency>/<project>/<version>/upgradeReWi-<os>-<arch>[.exe]
+  <base-url>/<platform>/<dependency>/<project>/<version>/upgradeReWi-<os>-<arch>[.exe].md5
+
+The new binary is downloaded next to the current one, verified, synced to disk
+and renamed into place. The previous binary is kept as <executable>.old.
+
+Examples:
+  # Only report whether an update exists
+  upgradeReWi self-update --check-only
+
+  # Update to the latest release
+  upgradeReWi self-update
+
+  # Restore the binary replaced by the last update
+  upgradeReWi self-update --rollback`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		checkOnly, _ := cmd.Flags().GetBool("check-only")
+		rollback, _ := cmd.Flags().GetBool("rollback")
+		force, _ := cmd.Flags().GetBool("force")
+		platform, _ := cmd.Flags().GetString("platform")
+		dependency, _ := cmd.Flags().GetString("dependency")
+		project, _ := cmd.Flags().GetString("project")
+
+		exe, err := helpers.CurrentExecutable()
+		if err != nil {
+			return fmt.Errorf("locate executable: %w", err)
+		}
+
+		if rollback {
+			if err := helpers.RollbackExecutable(exe); err != nil {
+				return fmt.Errorf("rollback failed: %w", err)
+			}
+			fmt.Printf("Restored previous executable %s\n", exe)
+			return nil
+		}
+
+		nm := newNetManager(cmd)
+		ctx := cmd.Context()
+
+		if err := nm.BuildReqURL(platform, dependency, project, "version.txt"); err != nil {
+			return err
+		}
+		latest, err := nm.GetRemoteVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("check latest version: %w", err)
+		}
+
+		fmt.Printf("current version: %s\n", Version)
+		fmt.Printf("latest version:  %s\n", latest)
+		newer, err := helpers.CompareVersions(Version, latest)
+		if err != nil {
+			return err
+		}
+		if newer >= 0 && !force {
+			fmt.Println("up to date")
+			return nil
+		}
+		if checkOnly {
+			fmt.Println("update available")
+			return nil
+		}
+
+		// 发布的 MD5 文件内容为 "<hash>" 或 "<hash>  <filename>"
+		asset := helpers.ExecutableAssetName("upgradeReWi")
+		if err := nm.BuildReqURL(platform, dependency, project, latest+"/"+asset+".md5"); err != nil {
+			return err
+		}
+		sum, err := nm.GetRemoteVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("fetch checksum: %w", err)
+		}
+		fields := strings.Fields(sum)
+		if len(fields) == 0 {
+			return fmt.Errorf("empty checksum for %s", asset)
+		}
+
+		// 与当前文件写在同一目录，保证最后的重命名是原子操作；中断的下载保留为 .new.part，下次继续
+		newPath := exe + ".new"
+		defer os.Remove(newPath)
+		if err := nm.BuildReqURL(platform, dependency, project, latest+"/"+asset); err != nil {
+			return err
+		}
+		nm.Checksum = "md5:" + fields[0]
+		if err := nm.DownloadFileContext(ctx, newPath); err != nil {
+			return fmt.Errorf("download %s: %w", asset, err)
+		}
+
+		if err := helpers.InstallExecutable(newPath, exe); err != nil {
+			return fmt.Errorf("replace executable: %w", err)
+		}
+		fmt.Printf("Updated %s to %s (previous binary kept as %s.old)\n", exe, latest, exe)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(selfUpdateCmd)
+	selfUpdateCmd.Flags().Bool("check-only", false, "Only report whether an update is available")
+	selfUpdateCmd.Flags().Bool("rollback", false, "Restore the executable replaced by the last update")
+	selfUpdateCmd.Flags().BoolP("force", "f", false, "Reinstall even if the current version is up to date")
+	selfUpdateCmd.Flags().StringP("platform", "p", "tools", "平台名称")
+	selfUpdateCmd.Flags().StringP("dependency", "d", "upgrade", "依赖组件名称")
+	selfUpdateCmd.Flags().StringP("project", "j", "upgradeReWi", "项目名称")
+	bindNetFlags(selfUpdateCmd)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Re-Wi/GoKitReWi/helpers"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// serveCmd 本地更新服务器
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a directory as an update server for sniffer and upgrader",
+	Long: `Serve --root with the layout expected by sniffer, upgrader and self-update:
+
+  <root>/<platform>/<dependency>/<project>/version.txt
+  <root>/<platform>/<dependency>/<project>/<version>.tar.gz
+
+Files support Range/If-Range requests and ETags, so resumable and segmented
+downloads work. <file>.md5, .sha1, .sha256 and .sha512 are computed on demand
+when they are not on disk. Directories are listed as JSON.
+
+Examples:
+  upgradeReWi serve --root ./repo
+  upgradeReWi serve --root /srv/updates --addr :443 --tls-cert server.pem --tls-key server.key`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, _ := cmd.Flags().GetString("root")
+		addr, _ := cmd.Flags().GetString("addr")
+		certFile, _ := cmd.Flags().GetString("tls-cert")
+		keyFile, _ := cmd.Flags().GetString("tls-key")
+
+		info, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", root)
+		}
+		if (certFile == "") != (keyFile == "") {
+			return fmt.Errorf("--tls-cert and --tls-key must be used together")
+		}
+
+		logger := newConsoleLogger()
+		defer logger.Sync()
+		srv := &http.Server{
+			Addr:              addr,
+			Handler:           helpers.NewUpdateServer(root, logger),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		// Ctrl-C 时等待进行中的请求结束
+		errc := make(chan error, 1)
+		go func() {
+			logger.Info("Serving updates", zap.String("root", root), zap.String("addr", addr), zap.Bool("tls", certFile != ""))
+			if certFile != "" {
+				errc <- srv.ListenAndServeTLS(certFile, keyFile)
+			} else {
+				errc <- srv.ListenAndServe()
+			}
+		}()
+		select {
+		case err := <-errc:
+			return err
+		case <-cmd.Context().Done():
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			return err
+		}
+		if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String("root", ".", "Repository directory to serve")
+	serveCmd.Flags().String("addr", ":8888", "Listen address")
+	serveCmd.Flags().String("tls-cert", "", "Serve HTTPS with this certificate (PEM)")
+	serveCmd.Flags().String("tls-key", "", "Private key (PEM) for --tls-cert")
+}
@@ -2,12 +2,12 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/Re-Wi/GoKitReWi/helpers"
 	"github.com/spf13/cobra"
-	"go.uber.org/zap"
 )
 
 const (
@@ -33,6 +33,24 @@ var checkCmd = &cobra.Command{
 		platform, _ := cmd.Flags().GetString("platform")
 		dependency, _ := cmd.Flags().GetString("dependency")
 		project, _ := cmd.Flags().GetString("project")
+		target, _ := cmd.Flags().GetString("target")
+		stateDir, _ := cmd.Flags().GetString("state-dir")
+
+		// 部署环境下以安装状态文件记录的版本为当前版本
+		var installed *helpers.InstallState
+		if target != "" {
+			if stateDir == "" {
+				stateDir = helpers.DefaultStateDir(target)
+			}
+			state, err := helpers.LoadInstallState(stateDir)
+			if err != nil {
+				fmt.Printf("Read install state failed: %v \n", err)
+			} else if state == nil {
+				fmt.Printf("No install state for %s \n", target)
+			}
+			installed = state
+			server = true
+		}
 
 		isGitRepo := false
 		// 环境检测逻辑
@@ -69,44 +87,58 @@ var checkCmd = &cobra.Command{
 
 		// 版本检查逻辑
 		var (
-			latest string
-			err    error
+			latest      string
+			manifest    *helpers.Manifest
+			manifestURL string
+			err         error
 		)
 
 		if isGitRepo {
 			latest, err = helpers.GetGitVersion()
 		} else {
-			// 创建 NetManager 实例
-			netM := helpers.NewNetManager()
-			// 设置基础配置
-			netM.BaseURL = baseURL
-			netM.ReqMethod = "GET"
-			netM.ReqHeaders = []string{
-				"User-Agent: MyClient/1.0",
-				"Authorization: Bearer your_token",
-			}
-			netM.Timeout = 15 * time.Second
-			netM.Retries = 3
-			netM.AllowInsecure = false // 生产环境建议为 false
-
-			// 替换默认日志记录器
-			logger, _ := zap.NewDevelopment()
-			defer logger.Sync()
-			netM.Logger = logger
-			// netM.Logger = zap.NewExample() // 替换为实际日志配置
+			// 创建 NetManager 实例，服务器地址、镜像与请求头来自命令行参数
+			netM := newNetManager(cmd)
+			defer netM.Logger.Sync()
+			if err := applyCacheFlags(cmd, netM); err != nil {
+				fatal("%v", err)
+			}
 
 			// 调用 GetRemoteVersion 方法
-			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			ctx, cancel := context.WithTimeout(cmd.Context(), netM.Timeout)
 			defer cancel()
 
-			err = netM.BuildReqURL(platform, dependency, project, "version.txt")
-			if err != nil {
-				fmt.Printf("BuildReqURL failed: %v \n", err)
-			} else {
-				latest, err = netM.GetRemoteVersion(ctx)
+			// 优先读取 manifest.json，服务器没有清单时回退到 version.txt
+			manifest, err = netM.FetchManifest(ctx, platform, dependency, project)
+			if errors.Is(err, helpers.ErrNoManifest) {
+				if verbose {
+					fmt.Println("No manifest on the server, falling back to version.txt")
+				}
+				err = netM.BuildReqURL(platform, dependency, project, "version.txt")
+				if err != nil {
+					fmt.Printf("BuildReqURL failed: %v \n", err)
+				} else {
+					latest, err = netM.GetRemoteVersion(ctx)
+				}
+			} else if err == nil {
+				manifestURL = netM.ReqURL
+				channel, deviceID := channelFlags(cmd)
+				var release *helpers.Release
+				if release, err = manifest.Resolve(channel, deviceID); err == nil {
+					latest = release.Version
+					printRollout(manifest, channel, deviceID, release)
+				}
+			}
+			if err == nil && netM.RespCache == helpers.CacheStale {
+				fmt.Printf("Warning: server unreachable, showing the cached version from %s ago \n", netM.RespAge)
 			}
 			if verbose {
-				fmt.Printf("StatusCode: %v, ReqURL: %v \n", netM.RespCode, netM.ReqURL)
+				if netM.Auth != nil {
+					fmt.Printf("Auth: %v \n", netM.Auth)
+				}
+				fmt.Printf("StatusCode: %v, ReqURL: %v \n", netM.RespCode, helpers.RedactURL(netM.ReqURL))
+				if netM.RespCache != "" {
+					fmt.Printf("Cache: %s, Age: %v \n", netM.RespCache, netM.RespAge)
+				}
 				if err != nil {
 					fmt.Printf("StatusCode: %v, Error: %v \n", netM.RespCode, err)
 				}
@@ -119,10 +151,99 @@ var checkCmd = &cobra.Command{
 			fmt.Printf("Check failure: %v \n", err)
 		} else {
 			fmt.Printf("latest version: %s\n", latest)
+			if installed != nil {
+				fmt.Printf("installed version: %s (%s)\n", installed.Version, installed.InstalledAt)
+				// 已安装的版本可能比通道中的更新（例如从 beta 安装），只有更新的版本才提示升级
+				cmp, err := helpers.CompareVersions(latest, installed.Version)
+				if err != nil && latest != installed.Version {
+					cmp = 1 // 不是 vX.Y.Z 格式时只能按是否相同判断
+				}
+				switch {
+				case cmp > 0:
+					fmt.Println("update available")
+				case cmp < 0:
+					fmt.Println("installed version is newer than the latest on the server")
+				default:
+					fmt.Println("up to date")
+				}
+			}
+			if manifest != nil {
+				current := ""
+				if installed != nil {
+					current = installed.Version
+				}
+				printUpgradePath(manifest, manifestURL, current, latest, verbose)
+			}
 		}
 	},
 }
 
+// printRollout 输出通道信息，通道最新版本仍在灰度且不包含本设备时说明原因
+func printRollout(manifest *helpers.Manifest, channel, deviceID string, release *helpers.Release) {
+	fmt.Printf("channel: %s\n", channel)
+	if percent := release.RolloutPercent(channel); percent < 100 {
+		fmt.Printf("rollout: %s is available to %d%% of devices, including this one\n", release.Version, percent)
+	}
+	head, err := manifest.Latest(channel)
+	if err != nil || head.Version == release.Version {
+		return
+	}
+	fmt.Printf("rollout: %s is available to %d%% of devices, not yet to this one", head.Version, head.RolloutPercent(channel))
+	if deviceID != "" {
+		fmt.Printf(" (bucket %d)", helpers.RolloutBucket(deviceID, manifest.Project, head.Version))
+	}
+	fmt.Println()
+}
+
+// printUpgradePath 输出清单给出的升级路径、下载大小与发布说明
+func printUpgradePath(manifest *helpers.Manifest, manifestURL, installed, latest string, verbose bool) {
+	if release := manifest.Release(latest); release != nil {
+		fmt.Printf("published: %s\n", release.PublishedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if manifest.MinClientVersion != "" {
+		if c, err := helpers.CompareVersions(Version, manifest.MinClientVersion); err == nil && c < 0 {
+			fmt.Printf("Warning: this manifest requires upgradeReWi %s or newer (running %s), run self-update first\n", manifest.MinClientVersion, Version)
+		}
+	}
+	if installed == latest {
+		return
+	}
+
+	path, err := manifest.UpgradePath(installed, latest)
+	if err != nil {
+		fmt.Printf("upgrade path: %v\n", err)
+		return
+	}
+	var total int64
+	fmt.Println("upgrade path:")
+	for _, step := range path {
+		from, kind := step.From, "delta"
+		if step.Package.Full() {
+			kind = "full"
+		}
+		if from == "" {
+			from = "(none)"
+		}
+		fmt.Printf("  %s -> %s  %s  %s\n", from, step.To, kind, helpers.FormatBytes(step.Package.Size))
+		if verbose {
+			if u, err := step.Package.ResolveURL(manifestURL); err == nil {
+				fmt.Printf("    %s sha256:%s\n", helpers.RedactURL(u), step.Package.SHA256)
+			}
+		}
+		total += step.Package.Size
+	}
+	fmt.Printf("total download: %s\n", helpers.FormatBytes(total))
+
+	for _, step := range path {
+		if release := manifest.Release(step.To); release != nil && release.Notes != "" {
+			fmt.Printf("release notes %s:\n", step.To)
+			for _, line := range strings.Split(strings.TrimSpace(release.Notes), "\n") {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+	}
+}
+
 // descCmd 获取描述文件
 var fetchCmd = &cobra.Command{
 	Use:   "fetch",
@@ -132,6 +253,8 @@ var fetchCmd = &cobra.Command{
 		platform, _ := cmd.Flags().GetString("platform")
 		dependency, _ := cmd.Flags().GetString("dependency")
 		project, _ := cmd.Flags().GetString("project")
+		checksum, _ := cmd.Flags().GetString("checksum")
+		checksumSidecar, _ := cmd.Flags().GetBool("checksum-sidecar")
 
 		if platform == "" || dependency == "" || project == "" || output == "" {
 			fmt.Println("Error: Parameters required in non-Git mode")
@@ -153,25 +276,20 @@ var fetchCmd = &cobra.Command{
 		}
 
 		// 初始化网络管理器
-		nm := helpers.NewNetManager()
-		nm.BaseURL = baseURL
-		nm.ReqURL = "/download"
-		nm.ReqMethod = "GET"
-		nm.ReqHeaders = []string{
-			"Authorization: Bearer token",
-			"X-Custom-Header: value",
+		nm := newNetManager(cmd)
+		defer nm.Logger.Sync()
+		if err := applyCacheFlags(cmd, nm); err != nil {
+			fatal("%v", err)
 		}
-		nm.AllowInsecure = false
-		nm.FollowRedirects = true
-		nm.Timeout = 30 * time.Second
-		nm.Retries = 5
+		nm.Checksum = checksum
+		nm.ChecksumSidecar = checksumSidecar
 
 		err := nm.BuildReqURL(platform, dependency, project, output)
 		if err != nil {
 			fmt.Printf("BuildReqURL failed: %v \n", err)
 		} else {
 			// 执行下载
-			err = nm.DownloadFile(output)
+			err = nm.DownloadFileContext(cmd.Context(), output)
 			if err != nil {
 				fmt.Printf("Download failed: %v \n", err)
 			} else {
@@ -192,10 +310,20 @@ func init() {
 	fetchCmd.Flags().StringP("platform", "p", "", "平台名称")
 	fetchCmd.Flags().StringP("dependency", "d", "", "依赖组件名称")
 	fetchCmd.Flags().StringP("project", "j", "", "项目名称")
+	fetchCmd.Flags().String("checksum", "", "期望的文件摘要 (algorithm:hex，支持 md5/sha1/sha256/sha512)")
+	fetchCmd.Flags().Bool("checksum-sidecar", false, "自动获取 <url>.sha256 或 <url>.md5 校验下载的文件")
 
 	checkCmd.Flags().StringP("platform", "p", "", "平台名称")
 	checkCmd.Flags().StringP("dependency", "d", "", "依赖组件名称")
 	checkCmd.Flags().StringP("project", "j", "", "项目名称")
 	checkCmd.Flags().BoolP("verbose", "v", false, "显示详细输出")
 	checkCmd.Flags().BoolP("server", "s", false, "请求服务器而跳过 git仓库 检查")
+	checkCmd.Flags().StringP("target", "t", "", "已安装目录，读取其安装状态作为当前版本（隐含 --server）")
+	checkCmd.Flags().String("state-dir", "", "安装状态目录 (默认 <target>.rewi-state)")
+
+	bindNetFlags(checkCmd)
+	bindCacheFlags(checkCmd)
+	bindChannelFlags(checkCmd)
+	bindNetFlags(fetchCmd)
+	bindCacheFlags(fetchCmd)
 }
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Re-Wi/GoKitReWi/helpers"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd 显示已安装版本及完整性
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the installed version and verify its integrity",
+	Long: `Print the version recorded by upgrader for a target directory and
+compare the installed files with the recorded files manifest.
+
+Exits with an error when files were modified, removed or added since install.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targetDir, _ := cmd.Flags().GetString("output")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+
+		stateDir := newSnapshotManager(cmd, targetDir).StateDir
+		state, err := helpers.LoadInstallState(stateDir)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			return fmt.Errorf("no install state for %s in %s", targetDir, stateDir)
+		}
+
+		fmt.Printf("Version:      %s\n", state.Version)
+		fmt.Printf("Installed at: %s\n", state.InstalledAt)
+		if state.PackageHash != "" {
+			fmt.Printf("Package MD5:  %s\n", state.PackageHash)
+		}
+		fmt.Printf("Files:        %d (digest %s)\n", len(state.Files), state.ManifestDigest)
+
+		report, err := state.Verify(targetDir)
+		if err != nil {
+			return err
+		}
+		if report.Intact() {
+			fmt.Println("Integrity:    OK")
+			return nil
+		}
+
+		fmt.Printf("Integrity:    %d modified, %d missing, %d extra\n",
+			len(report.Modified), len(report.Missing), len(report.Extra))
+		printPaths := func(label string, paths []string) {
+			limit := 10
+			if verbose {
+				limit = len(paths)
+			}
+			for i, p := range paths {
+				if i == limit {
+					fmt.Printf("  ... %d more (use --verbose)\n", len(paths)-limit)
+					break
+				}
+				fmt.Printf("  %-9s %s\n", label, p)
+			}
+		}
+		printPaths("modified", report.Modified)
+		printPaths("missing", report.Missing)
+		printPaths("extra", report.Extra)
+		return fmt.Errorf("installation in %s differs from version %s", targetDir, state.Version)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringP("output", "o", "", "Target directory")
+	statusCmd.Flags().String("state-dir", "", "State directory (default <output>.rewi-state)")
+	statusCmd.Flags().BoolP("verbose", "v", false, "List every differing file")
+	_ = statusCmd.MarkFlagRequired("output")
+}
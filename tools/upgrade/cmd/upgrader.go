@@ -4,7 +4,12 @@ import (
 	"crypto/md5"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
 
+	"github.com/Re-Wi/GoKitReWi/handlers"
 	"github.com/Re-Wi/GoKitReWi/helpers"
 	"github.com/spf13/cobra"
 )
@@ -12,8 +17,34 @@ import (
 var upgraderCmd = &cobra.Command{
 	Use:   "upgrader",
 	Short: "System upgrade tool",
-	Long:  "Validate and apply system upgrade package",
-	Run:   upgradeMain,
+	Long: `Validate and apply system upgrade package.
+
+The package is read from --input (with <input>.md5 next to it), or downloaded
+with --url / --from-repo. Downloads are verified against the sha256 recorded in
+the server's manifest.json, or the .md5 published next to the package when there
+is no manifest, and cached under <state-dir>/downloads.
+
+Examples:
+  upgradeReWi upgrader -i v2.tar.gz -o /opt/app
+  upgradeReWi upgrader --url https://updates.example.com/app/v2.tar.gz -o /opt/app
+  upgradeReWi upgrader --from-repo linux/app/server@v2.0.0 --base-url https://updates.example.com -o /opt/app
+  upgradeReWi upgrader --from-repo linux/app/server --channel beta --base-url https://updates.example.com -o /opt/app
+
+When the server publishes manifest.json, --from-repo without a version installs
+the newest release of --channel whose staged rollout includes this device, and
+prefers a delta package built for the installed version. An installed version
+newer than the channel release is never downgraded unless @version is given.
+
+Snapshots are off by default. --keep N saves a full copy of the install after
+every upgrade (and once before the first one), which enables rollback and lets
+overwritten local edits be rebuilt from the pristine files; each snapshot costs
+about the size of the install in tar.gz mode.
+
+Config files listed for three-way merge fail the upgrade when local and upstream
+changed the same key. With --merge-conflict markers the file is written with
+<<<<<<< local / ======= / >>>>>>> upstream blocks instead, and upgrader exits
+with status 2 so they get resolved by hand.`,
+	Run: upgradeMain,
 }
 
 func verifyFileExist(path string) error {
@@ -23,6 +54,9 @@ func verifyFileExist(path string) error {
 	return nil
 }
 
+// exitUnresolvedConflicts 升级已完成，但有配置文件写入了冲突标记
+const exitUnresolvedConflicts = 2
+
 func fatal(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
 	os.Exit(1)
@@ -32,8 +66,27 @@ func upgradeMain(cmd *cobra.Command, args []string) {
 
 	tarPath, _ := cmd.Flags().GetString("input")
 	targetDir, _ := cmd.Flags().GetString("output")
-	if tarPath == "" || targetDir == "" {
-		fatal("Input and output are required")
+	pkgURL, _ := cmd.Flags().GetString("url")
+	fromRepo, _ := cmd.Flags().GetString("from-repo")
+	if targetDir == "" {
+		fatal("Output is required")
+	}
+	sources := 0
+	for _, s := range []string{tarPath, pkgURL, fromRepo} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		fatal("Exactly one of --input, --url or --from-repo is required")
+	}
+
+	// 远程升级包先下载并校验到缓存目录，之后按本地升级包处理
+	if tarPath == "" {
+		var err error
+		if tarPath, err = downloadPackage(cmd, targetDir, pkgURL, fromRepo); err != nil {
+			fatal("Download package failed: %v", err)
+		}
 	}
 
 	hashPath := tarPath + ".md5"
@@ -50,73 +103,318 @@ func upgradeMain(cmd *cobra.Command, args []string) {
 		fatal("Tar validation failed: %v", err)
 	}
 
-	// Step 2: Extract tar.gz to temp dir
-	patchTempDir, err := os.MkdirTemp("", "patch-")
+	// 流式模式边解压边原地应用，不解压整个升级包，也不暂存完整的新版本目录
+	stream, _ := cmd.Flags().GetBool("stream")
+	config := helpers.PatchApp{
+		TargetDir: targetDir,
+	}
+
+	var (
+		pkg       *handlers.UpdatePackage
+		pkgStream *helpers.PackageStream
+	)
+	if stream {
+		pkgStream, err = helpers.OpenPackageStream(tarPath)
+		if err != nil {
+			fatal("Open package failed: %v", err)
+		}
+		defer pkgStream.Close()
+		pkg = pkgStream.Package
+	} else {
+		// Step 2: Extract tar.gz to temp dir
+		patchTempDir, err := os.MkdirTemp("", "patch-")
+		if err != nil {
+			fatal("Create temp dir failed: %v", err)
+		}
+		defer os.RemoveAll(patchTempDir)
+
+		newTempDir, err := os.MkdirTemp("", "new-")
+		if err != nil {
+			fatal("Create temp dir failed: %v", err)
+		}
+		defer os.RemoveAll(newTempDir)
+
+		err = helpers.ExtractTarGz(tarPath, patchTempDir)
+		if err != nil {
+			fmt.Printf("Error extracting zip: %v\n", err)
+		}
+		fmt.Printf("Successfully extracted zip to: %s\n", patchTempDir)
+
+		// Step 3: Parse package.json
+		config.PatchTempDir = patchTempDir
+		config.NewTempDir = newTempDir
+
+		pkg, err = config.ParsePackageJSON(patchTempDir)
+		if err != nil {
+			fatal("Package.json error: %v", err)
+		}
+	}
+
+	snapshots := newSnapshotManager(cmd, targetDir)
+
+	// 校验已安装版本是否为升级包的基准版本
+	state, err := helpers.LoadInstallState(snapshots.StateDir)
 	if err != nil {
-		fatal("Create temp dir failed: %v", err)
+		fatal("Load install state failed: %v", err)
+	}
+	force, _ := cmd.Flags().GetBool("force")
+	switch {
+	case state == nil:
+		fmt.Printf("No install state in %s, skipping base version check\n", snapshots.StateDir)
+	case pkg.BaseVersion != "" && state.Version != pkg.BaseVersion:
+		if !force {
+			fatal("Package upgrades %s -> %s, but %s is installed (use --force to apply anyway)", pkg.BaseVersion, pkg.Version, state.Version)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: package base version %s does not match installed %s\n", pkg.BaseVersion, state.Version)
+	}
+	// 流式升级原地修改文件，失败时按日志恢复；没有快照时成功后就无法再回滚
+	if stream && snapshots.Keep == 0 && !force {
+		fatal("--stream changes %s in place and --keep 0 leaves no snapshot to roll back to (use --keep N, or --force to stream anyway)", targetDir)
+	}
+	if snapshots.Keep != 0 {
+		// 首次升级时还没有任何快照，先保存升级前的目录，保证第一次升级也能回滚
+		index, err := snapshots.LoadIndex()
+		if err != nil {
+			fatal("Load snapshot index failed: %v", err)
+		}
+		if exists, _, _, _ := helpers.PathInfo(targetDir); exists && len(index.Snapshots) == 0 {
+			// 快照以当前安装的版本命名，未知时使用升级包的基准版本
+			label := "pre-" + pkg.Version
+			if state != nil {
+				label = state.Version
+			} else if pkg.BaseVersion != "" {
+				label = pkg.BaseVersion
+			}
+			if entry, err := snapshots.Save(targetDir, label); err != nil {
+				fatal("Snapshot before upgrade failed: %v", err)
+			} else {
+				fmt.Printf("Saved snapshot of current installation: %s\n", entry.ID)
+			}
+		}
+	}
+
+	// Step 4: Process files
+	// 以当前安装目录为基础构建新版本，未变更的文件原样保留
+	if exists, _, _, _ := helpers.PathInfo(targetDir); exists && !stream {
+		if err := helpers.CopyDir(targetDir, config.NewTempDir); err != nil {
+			fatal("Stage target dir failed: %v", err)
+		}
 	}
-	defer os.RemoveAll(patchTempDir)
 
-	newTempDir, err := os.MkdirTemp("", "new-")
+	config.MergeConflict, _ = cmd.Flags().GetString("merge-conflict")
+	if config.MergeConflict != helpers.MergeOnConflictFail && config.MergeConflict != helpers.MergeOnConflictMarkers {
+		fatal("Unknown --merge-conflict %q (fail or markers)", config.MergeConflict)
+	}
+	config.Conflicts, err = newConflictResolver(cmd, pkg)
 	if err != nil {
-		fatal("Create temp dir failed: %v", err)
+		fatal("Conflict policy error: %v", err)
+	}
+	if snapshots.Keep != 0 {
+		pristineDir, cleanupPristine := pristineFromSnapshot(snapshots)
+		defer cleanupPristine()
+		config.PristineDir = pristineDir
+	}
+
+	var applyErr error
+	if stream {
+		// 工作目录与目标目录同级，保证暂存文件可以直接重命名到目标目录
+		workDir, err := os.MkdirTemp(filepath.Dir(filepath.Clean(targetDir)), ".rewi-stream-")
+		if err != nil {
+			fatal("Create work dir failed: %v", err)
+		}
+		defer os.RemoveAll(workDir)
+		config.NewTempDir = workDir
+
+		applyErr = config.ApplyStream(cmd.Context(), pkgStream)
+	} else {
+		workers, _ := cmd.Flags().GetInt("workers")
+		applyErr = config.ApplyFiles(cmd.Context(), pkg.Files, workers)
+	}
+	reportConflicts(cmd, config.Conflicts.Conflicts())
+	if applyErr != nil {
+		// fatal 直接退出进程，延迟清理不会执行；被取消（Ctrl-C）时同样清理暂存目录
+		// 流式升级在 ApplyStream 返回前已按日志恢复了目标目录
+		os.RemoveAll(config.NewTempDir)
+		if !stream {
+			os.RemoveAll(config.PatchTempDir)
+		}
+		fatal("Apply files failed: %v", applyErr)
 	}
-	defer os.RemoveAll(newTempDir)
 
-	err = helpers.ExtractTarGz(tarPath, patchTempDir)
+	if !stream {
+		// 升级完成，并保存到临时文件夹，删除目标文件夹所有文件，将临时文件夹所有文件复制到目标文件夹
+		err = os.RemoveAll(targetDir)
+		if err != nil {
+			fatal("Remove target dir failed: %v", err)
+		}
+		err = os.MkdirAll(targetDir, 0755)
+		if err != nil {
+			fatal("Create target dir failed: %v", err)
+		}
+
+		err = helpers.CopyDir(config.NewTempDir, targetDir)
+		if err != nil {
+			fatal("Copy new dir failed: %v", err)
+		}
+	}
+
+	// 记录安装状态
+	newState, err := helpers.NewInstallState(targetDir, pkg.Version, strings.TrimSpace(string(expectedHashData)))
+	if err == nil {
+		err = helpers.SaveInstallState(snapshots.StateDir, newState)
+	}
 	if err != nil {
-		fmt.Printf("Error extracting zip: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Warning: write install state failed: %v\n", err)
 	}
-	fmt.Printf("Successfully extracted zip to: %s\n", patchTempDir)
 
-	// Step 3: Parse package.json
-	config := helpers.PatchApp{
-		TargetDir:    targetDir,
-		PatchTempDir: patchTempDir,
-		NewTempDir:   newTempDir,
+	if snapshots.Keep != 0 {
+		if entry, err := snapshots.Save(targetDir, pkg.Version); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: snapshot after upgrade failed: %v\n", err)
+		} else {
+			fmt.Printf("Saved snapshot %s (%s)\n", entry.ID, entry.Mode)
+		}
+	}
+
+	// 写入了冲突标记的配置无法直接使用，以非零状态退出提醒运维处理
+	var unresolved []string
+	for _, c := range config.Conflicts.Conflicts() {
+		if c.Unresolved {
+			unresolved = append(unresolved, c.Path)
+		}
+	}
+	if len(unresolved) > 0 {
+		fmt.Fprintf(os.Stderr, "\n*** WARNING: upgrade applied, but %d config file(s) contain merge conflict markers ***\n", len(unresolved))
+		for _, p := range unresolved {
+			fmt.Fprintf(os.Stderr, "    %s\n", filepath.Join(targetDir, p))
+		}
+		fmt.Fprintln(os.Stderr, "Resolve the <<<<<<< / ======= / >>>>>>> blocks before starting the application.")
+		os.Exit(exitUnresolvedConflicts)
+	}
+
+	fmt.Println("Upgrade completed successfully")
+}
+
+// newSnapshotManager 根据命令行参数创建快照管理器
+func newSnapshotManager(cmd *cobra.Command, targetDir string) *helpers.SnapshotManager {
+	stateDir, _ := cmd.Flags().GetString("state-dir")
+	keep, _ := cmd.Flags().GetInt("keep")
+	mode, _ := cmd.Flags().GetString("snapshot-mode")
+	if stateDir == "" {
+		stateDir = helpers.DefaultStateDir(targetDir)
 	}
+	return &helpers.SnapshotManager{
+		StateDir: stateDir,
+		Keep:     keep,
+		Mode:     mode,
+	}
+}
+
+// downloadPackage 从 URL 或更新服务器下载升级包，返回缓存中的本地路径；
+// 升级包来自清单时用清单中的 SHA256 校验，否则用服务器上的 <pkg>.md5 校验
+func downloadPackage(cmd *cobra.Command, targetDir, pkgURL, fromRepo string) (string, error) {
+	nm := newNetManager(cmd)
+	ctx := cmd.Context()
 
-	pkg, err := config.ParsePackageJSON(patchTempDir)
+	pkg := &helpers.ReleasePackage{URL: pkgURL}
+	if fromRepo != "" {
+		ref, err := helpers.ParseRepoRef(fromRepo)
+		if err != nil {
+			return "", err
+		}
+		// 服务器有版本清单时按通道、灰度与已安装版本选择升级包
+		ref.Channel, ref.DeviceID = channelFlags(cmd)
+		if state, err := helpers.LoadInstallState(newSnapshotManager(cmd, targetDir).StateDir); err == nil && state != nil {
+			ref.Installed = state.Version
+		}
+		if force, _ := cmd.Flags().GetBool("force"); !force {
+			ref.ClientVersion = Version
+		}
+		if pkg, err = nm.ResolveRepoPackage(ctx, ref); err != nil {
+			return "", err
+		}
+	}
+
+	cacheDir, _ := cmd.Flags().GetString("cache-dir")
+	if cacheDir == "" {
+		cacheDir = filepath.Join(newSnapshotManager(cmd, targetDir).StateDir, "downloads")
+	}
+	fmt.Printf("Downloading %s\n", pkg.URL)
+	return nm.DownloadPackage(ctx, pkg, cacheDir)
+}
+
+// newConflictResolver 合并命令行与升级包中的冲突策略，命令行优先
+func newConflictResolver(cmd *cobra.Command, pkg *handlers.UpdatePackage) (*helpers.ConflictResolver, error) {
+	specs, _ := cmd.Flags().GetStringArray("conflict")
+	defaultPolicy, _ := cmd.Flags().GetString("conflict-default")
+
+	rules, err := helpers.ParseConflictPolicies(specs)
 	if err != nil {
-		fatal("Package.json error: %v", err)
+		return nil, err
+	}
+	for _, rule := range pkg.ConflictPolicies {
+		if err := helpers.ValidateConflictPolicy(rule.Policy); err != nil {
+			return nil, fmt.Errorf("package policy for %s: %w", rule.Pattern, err)
+		}
+	}
+	if err := helpers.ValidateConflictPolicy(defaultPolicy); err != nil {
+		return nil, err
 	}
 
-	// Step 4: Process files
-	for _, file := range pkg.Files {
-		switch file.Status {
-		case "added":
-			if err := config.ProcessAdded(file); err != nil {
-				fatal("Process added failed: %v", err)
+	return &helpers.ConflictResolver{
+		Rules:   append(rules, pkg.ConflictPolicies...),
+		Default: defaultPolicy,
+	}, nil
+}
+
+// pristineFromSnapshot 按需解压当前版本的快照，作为未经本地修改的基准文件来源
+func pristineFromSnapshot(snapshots *helpers.SnapshotManager) (func() (string, error), func()) {
+	var (
+		once sync.Once
+		dir  string
+		err  error
+	)
+	prepare := func() (string, error) {
+		once.Do(func() {
+			var entry *helpers.SnapshotEntry
+			if entry, err = snapshots.Current(); err != nil {
+				return
 			}
-		case "modified":
-			if err := config.ProcessModified(file); err != nil {
-				fatal("Process modified failed: %v", err)
+			if entry == nil {
+				err = fmt.Errorf("no snapshot of the installed version in %s", snapshots.StateDir)
+				return
 			}
-		case "deleted":
-			if err := config.ProcessDeleted(file); err != nil {
-				fatal("Process deleted failed: %v", err)
+			if dir, err = os.MkdirTemp("", "pristine-"); err != nil {
+				return
 			}
-		default:
-			fatal("Unknown status: %s", file.Status)
+			err = snapshots.Materialize(entry, dir)
+		})
+		return dir, err
+	}
+	cleanup := func() {
+		if dir != "" {
+			os.RemoveAll(dir)
 		}
 	}
+	return prepare, cleanup
+}
 
-	// 升级完成，并保存到临时文件夹，删除目标文件夹所有文件，将临时文件夹所有文件复制到目标文件夹
-	err = os.RemoveAll(targetDir)
-	if err != nil {
-		fatal("Remove target dir failed: %v", err)
-	}
-	err = os.MkdirAll(targetDir, 0755)
-	if err != nil {
-		fatal("Create target dir failed: %v", err)
+// reportConflicts 输出冲突列表，并按需写入报告文件
+func reportConflicts(cmd *cobra.Command, conflicts []helpers.Conflict) {
+	if len(conflicts) > 0 {
+		fmt.Printf("%d conflict(s) with locally modified files:\n", len(conflicts))
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "  PATH\tSTATUS\tPOLICY\tACTION")
+		for _, c := range conflicts {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", c.Path, c.Status, c.Policy, c.Action)
+		}
+		w.Flush()
 	}
 
-	err = helpers.CopyDir(newTempDir, targetDir)
-	if err != nil {
-		fatal("Copy new dir failed: %v", err)
+	if reportPath, _ := cmd.Flags().GetString("conflict-report"); reportPath != "" {
+		if err := helpers.WriteConflictReport(conflicts, reportPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: write conflict report failed: %v\n", err)
+		}
 	}
-
-	fmt.Println("Upgrade completed successfully")
 }
 
 func init() {
@@ -124,4 +422,19 @@ func init() {
 	// 输入升级包，输出指定目录
 	upgraderCmd.Flags().StringP("input", "i", "", "Input tar.gz file")
 	upgraderCmd.Flags().StringP("output", "o", "", "Output directory")
+	upgraderCmd.Flags().StringP("url", "u", "", "Download the package (and <url>.md5) from this URL instead of --input")
+	upgraderCmd.Flags().String("from-repo", "", "Download the package from the update server: platform/dependency/project@version (latest if omitted)")
+	upgraderCmd.Flags().String("cache-dir", "", "Directory for downloaded packages (default <state-dir>/downloads)")
+	bindNetFlags(upgraderCmd)
+	bindChannelFlags(upgraderCmd)
+	upgraderCmd.Flags().IntP("workers", "w", 4, "Number of files patched in parallel")
+	upgraderCmd.Flags().Bool("stream", false, "Apply entries in place while reading the archive (package.json must be the first entry); a failure restores the replaced files, needs --keep N or --force")
+	upgraderCmd.Flags().StringArray("conflict", []string{}, "Conflict policy for locally modified files (glob=abort|overwrite|keep-local|keep-both)")
+	upgraderCmd.Flags().String("conflict-default", helpers.ConflictAbort, "Conflict policy when no glob matches")
+	upgraderCmd.Flags().String("merge-conflict", helpers.MergeOnConflictFail, "When local and upstream change the same key of a merged config: fail, or markers to write conflict markers into the file (exit status 2)")
+	upgraderCmd.Flags().String("conflict-report", "", "Write the conflict report to this JSON file")
+	upgraderCmd.Flags().Bool("force", false, "Apply even if the installed version is not the package base version, the manifest requires a newer upgradeReWi, or --stream without snapshots")
+	upgraderCmd.Flags().String("state-dir", "", "State directory for install state and snapshots (default <output>.rewi-state)")
+	upgraderCmd.Flags().Int("keep", 0, "Number of installed versions to keep as snapshots for rollback; each is a full copy of the install (0 disables, negative keeps all)")
+	upgraderCmd.Flags().String("snapshot-mode", helpers.SnapshotTarGz, "Snapshot mode: tar.gz or hardlink")
 }
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Re-Wi/GoKitReWi/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadPackageDowngrade(t *testing.T) {
+	content := []byte("v1.2.0 package")
+	digest := sha256.Sum256(content)
+	manifest := helpers.Manifest{
+		Project:  "app",
+		Channels: map[string]string{helpers.ChannelStable: "v1.2.0", helpers.ChannelBeta: "v1.3.0"},
+		Releases: []helpers.Release{
+			{Version: "v1.3.0", Packages: []helpers.ReleasePackage{{URL: "v1.3.0.tar.gz"}}},
+			{Version: "v1.2.0", Packages: []helpers.ReleasePackage{{URL: "v1.2.0.tar.gz", Size: int64(len(content)), SHA256: hex.EncodeToString(digest[:])}}},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/linux/go/app/manifest.json":
+			json.NewEncoder(w).Encode(manifest)
+		case "/linux/go/app/v1.2.0.tar.gz":
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	targetDir := filepath.Join(t.TempDir(), "app")
+	stateDir := filepath.Join(t.TempDir(), "state")
+	// 设备之前从 beta 通道安装了 v1.3.0
+	require.NoError(t, helpers.SaveInstallState(stateDir, &helpers.InstallState{Version: "v1.3.0"}))
+
+	cmd := upgraderCmd
+	cmd.SetContext(context.Background())
+	for flag, value := range map[string]string{
+		"base-url":  srv.URL,
+		"state-dir": stateDir,
+		"channel":   helpers.ChannelStable,
+		"device-id": "device",
+		"quiet":     "true",
+		"retries":   "0",
+	} {
+		require.NoError(t, cmd.Flags().Set(flag, value))
+	}
+
+	_, err := downloadPackage(cmd, targetDir, "", "linux/go/app")
+	assert.ErrorContains(t, err, "installed version v1.3.0 is newer than v1.2.0 on channel stable")
+
+	path, err := downloadPackage(cmd, targetDir, "", "linux/go/app@v1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(stateDir, "downloads", "v1.2.0.tar.gz"), path)
+	// 服务器没有 .md5 文件，由清单校验后在缓存中生成
+	md5Data, err := os.ReadFile(path + ".md5")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", md5.Sum(content)), string(md5Data))
+}